@@ -15,13 +15,15 @@ const (
 	DEFAULT_CLI_CONF_DELAY       = 0
 	DEFAULT_CLI_CONF_VERBOSE     = false
 	DEFAULT_CLI_CONF_RETRY       = 0
+	DEFAULT_CLI_CONF_OUTPUT      = OUTPUT_JSON
+	DEFAULT_CLI_CONF_WHERE       = ""
 )
 
 var cliRootCmd = cobra.Command{
 	Use:     "rc [HOST] COMMAND",
 	Short:   "Send a COMMAND to a HOST running the remote-control service",
 	Long:    "Send a COMMAND to a HOST running the remote-control service\n\n  HOST        the hostname or ip address of the host to run the command on\n              (omit to read the host(s) from STDIN, 1 host per line)\n\n  COMMAND     the command to run on the host",
-	Example: "  rc host1.example.com \"uname -a\" -c config.json\n\n  cat hosts.txt | rc \"uname -a\" -c config.json",
+	Example: "  rc host1.example.com \"uname -a\" -c config.json\n\n  cat hosts.txt | rc \"uname -a\" -c config.json\n\n  cat hosts.txt | rc \"apt-get update\" --where 'os=ubuntu,mem>8G' -c config.json",
 	Args:    cobra.RangeArgs(1, 2),
 	Version: VERSION,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -29,34 +31,69 @@ var cliRootCmd = cobra.Command{
 	},
 }
 
+var cliFactsCmd = cobra.Command{
+	Use:     "facts [HOST...]",
+	Short:   "Gather facts from HOST(s) running the remote-control service",
+	Long:    "Gather facts (os, kernel, cpu, memory, uptime, load, addresses, disks and custom facts) from HOST(s) running the remote-control service\n\n  HOST        the hostname or ip address of the host to gather facts from\n              (omit to read the host(s) from STDIN, 1 host per line)",
+	Example: "  rc facts host1.example.com -c config.json\n\n  cat hosts.txt | rc facts --output table -c config.json",
+	Args:    cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runFacts(args)
+	},
+}
+
 type cliConfig struct {
-	ConfigFile    string `json:"configFile"`
-	Port          int    `json:"port"`
-	KeyDir        string `json:"keyDir"`
-	KeyName       string `json:"keyName"`
-	LogLevel      string `json:"logLevel"`
-	BatchSize     int    `json:"batchSize"`
-	Delay         int    `json:"delay"`
-	Verbose       bool   `json:"verbose"`
-	Retry         int    `json:"retry"`
-	TlsSkipVerify bool   `json:"tlsSkipVerify"`
-	TlsCaFile     string `json:"tlsCaFile"`
-	TlsDisable    bool   `json:"tlsDisable"`
+	ConfigFile        string `json:"configFile"`
+	Port              int    `json:"port"`
+	KeyDir            string `json:"keyDir"`
+	KeyName           string `json:"keyName"`
+	LogLevel          string `json:"logLevel"`
+	BatchSize         int    `json:"batchSize"`
+	Delay             int    `json:"delay"`
+	Verbose           bool   `json:"verbose"`
+	Retry             int    `json:"retry"`
+	TlsSkipVerify     bool   `json:"tlsSkipVerify"`
+	TlsCaFile         string `json:"tlsCaFile"`
+	TlsDisable        bool   `json:"tlsDisable"`
+	Output            string `json:"output"`
+	Where             string `json:"where"`
+	PingInterval      int    `json:"pingInterval"`
+	PingTimeout       int    `json:"pingTimeout"`
+	SignMessages      bool   `json:"signMessages"`
+	UseAgent          bool   `json:"useAgent"`
+	PassphraseCommand string `json:"passphraseCommand"`
+	CertFile          string `json:"certFile"`
+	TlsCertFile       string `json:"tlsCertFile"`
+	TlsKeyFile        string `json:"tlsKeyFile"`
+	TlsPin            string `json:"tlsPin"`
+	KnownHostsFile    string `json:"knownHostsFile"`
 }
 
 var cliConf cliConfig = cliConfig{
-	ConfigFile:    DEFAULT_CLI_CONF_CONFIG_FILE,
-	Port:          config.DEFAULT_PORT,
-	KeyDir:        config.DEFAULT_KEY_DIR,
-	KeyName:       config.DEFAULT_KEY_NAME,
-	LogLevel:      config.DEFAULT_LOG_LEVEL,
-	BatchSize:     DEFAULT_CLI_CONF_BATCH_SIZE,
-	Verbose:       DEFAULT_CLI_CONF_VERBOSE,
-	Delay:         DEFAULT_CLI_CONF_DELAY,
-	Retry:         DEFAULT_CLI_CONF_RETRY,
-	TlsCaFile:     config.DEFAULT_TLS_CA_FILE,
-	TlsSkipVerify: config.DEFAULT_TLS_SKIP_VERIFY,
-	TlsDisable:    config.DEFAULT_TLS_DISABLE,
+	ConfigFile:        DEFAULT_CLI_CONF_CONFIG_FILE,
+	Port:              config.DEFAULT_PORT,
+	KeyDir:            config.DEFAULT_KEY_DIR,
+	KeyName:           config.DEFAULT_KEY_NAME,
+	LogLevel:          config.DEFAULT_LOG_LEVEL,
+	BatchSize:         DEFAULT_CLI_CONF_BATCH_SIZE,
+	Verbose:           DEFAULT_CLI_CONF_VERBOSE,
+	Delay:             DEFAULT_CLI_CONF_DELAY,
+	Retry:             DEFAULT_CLI_CONF_RETRY,
+	TlsCaFile:         config.DEFAULT_TLS_CA_FILE,
+	TlsSkipVerify:     config.DEFAULT_TLS_SKIP_VERIFY,
+	TlsDisable:        config.DEFAULT_TLS_DISABLE,
+	Output:            DEFAULT_CLI_CONF_OUTPUT,
+	Where:             DEFAULT_CLI_CONF_WHERE,
+	PingInterval:      config.DEFAULT_PING_INTERVAL,
+	PingTimeout:       config.DEFAULT_PING_TIMEOUT,
+	SignMessages:      config.DEFAULT_SIGN_MESSAGES,
+	UseAgent:          config.DEFAULT_USE_AGENT,
+	PassphraseCommand: config.DEFAULT_PASSPHRASE_COMMAND,
+	CertFile:          config.DEFAULT_CERT_FILE,
+	TlsCertFile:       config.DEFAULT_TLS_CERT_FILE,
+	TlsKeyFile:        config.DEFAULT_TLS_KEY_FILE,
+	TlsPin:            config.DEFAULT_TLS_PIN,
+	KnownHostsFile:    config.DEFAULT_KNOWN_HOSTS_FILE,
 }
 
 func init() {
@@ -72,6 +109,20 @@ func init() {
 	cliRootCmd.PersistentFlags().StringVarP(&cliConf.TlsCaFile, "tls-ca-file", "", config.DEFAULT_TLS_CA_FILE, "path to the ca certificate file to use")
 	cliRootCmd.PersistentFlags().BoolVarP(&cliConf.TlsSkipVerify, "tls-skip-verify", "", config.DEFAULT_TLS_SKIP_VERIFY, "skip verification of the server certificate")
 	cliRootCmd.PersistentFlags().BoolVarP(&cliConf.TlsDisable, "tls-disable", "", config.DEFAULT_TLS_DISABLE, "don't use TLS when connecting to the server")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.Where, "where", "w", DEFAULT_CLI_CONF_WHERE, "only use hosts (read from STDIN) whose facts match the filter (ex: os=ubuntu,mem>8G)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.PingInterval, "ping-interval", "", config.DEFAULT_PING_INTERVAL, "how often to ping the server (in ms, 0 disables pings)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.PingTimeout, "ping-timeout", "", config.DEFAULT_PING_TIMEOUT, "how long to wait for the server to answer a ping (in ms)")
+	cliRootCmd.PersistentFlags().BoolVarP(&cliConf.SignMessages, "sign-messages", "", config.DEFAULT_SIGN_MESSAGES, "sign each message with the client key")
+	cliRootCmd.PersistentFlags().BoolVarP(&cliConf.UseAgent, "use-agent", "", config.DEFAULT_USE_AGENT, "sign with a key held by ssh-agent (SSH_AUTH_SOCK).  key-name selects the key by comment or fingerprint")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.PassphraseCommand, "passphrase-command", "", config.DEFAULT_PASSPHRASE_COMMAND, "a command that prints the passphrase of an encrypted private key")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.CertFile, "cert-file", "", config.DEFAULT_CERT_FILE, "an OpenSSH or X.509 (PEM) certificate for the client key")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.TlsCertFile, "tls-cert-file", "", config.DEFAULT_TLS_CERT_FILE, "the path to the TLS client certificate to use")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.TlsKeyFile, "tls-key-file", "", config.DEFAULT_TLS_KEY_FILE, "the path to the private key of the TLS client certificate")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.TlsPin, "tls-pin", "", config.DEFAULT_TLS_PIN, "only trust servers whose public key has one of these (comma separated) sha256/<base64> SPKI fingerprints")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.KnownHostsFile, "known-hosts-file", "", config.DEFAULT_KNOWN_HOSTS_FILE, "trust servers by the SPKI fingerprints recorded in this file on first use (like ssh known_hosts)")
+	cliFactsCmd.Flags().StringVarP(&cliConf.Output, "output", "o", DEFAULT_CLI_CONF_OUTPUT, "the output format.  can be one of: json, table")
+
+	cliRootCmd.AddCommand(&cliFactsCmd)
 
 	// Default configuration settings
 	viper.SetDefault("configFile", DEFAULT_CLI_CONF_CONFIG_FILE)
@@ -86,6 +137,18 @@ func init() {
 	viper.SetDefault("tlsCaFile", config.DEFAULT_TLS_CA_FILE)
 	viper.SetDefault("tlsSkipVerify", config.DEFAULT_TLS_SKIP_VERIFY)
 	viper.SetDefault("tlsDisable", config.DEFAULT_TLS_DISABLE)
+	viper.SetDefault("output", DEFAULT_CLI_CONF_OUTPUT)
+	viper.SetDefault("where", DEFAULT_CLI_CONF_WHERE)
+	viper.SetDefault("pingInterval", config.DEFAULT_PING_INTERVAL)
+	viper.SetDefault("pingTimeout", config.DEFAULT_PING_TIMEOUT)
+	viper.SetDefault("signMessages", config.DEFAULT_SIGN_MESSAGES)
+	viper.SetDefault("useAgent", config.DEFAULT_USE_AGENT)
+	viper.SetDefault("passphraseCommand", config.DEFAULT_PASSPHRASE_COMMAND)
+	viper.SetDefault("certFile", config.DEFAULT_CERT_FILE)
+	viper.SetDefault("tlsCertFile", config.DEFAULT_TLS_CERT_FILE)
+	viper.SetDefault("tlsKeyFile", config.DEFAULT_TLS_KEY_FILE)
+	viper.SetDefault("tlsPin", config.DEFAULT_TLS_PIN)
+	viper.SetDefault("knownHostsFile", config.DEFAULT_KNOWN_HOSTS_FILE)
 
 	// Environment Variables
 	viper.SetEnvPrefix("RC")
@@ -101,6 +164,18 @@ func init() {
 	_ = viper.BindEnv("tlsCaFile")
 	_ = viper.BindEnv("tlsSkipVerify")
 	_ = viper.BindEnv("tlsDisable")
+	_ = viper.BindEnv("output")
+	_ = viper.BindEnv("where")
+	_ = viper.BindEnv("pingInterval")
+	_ = viper.BindEnv("pingTimeout")
+	_ = viper.BindEnv("signMessages")
+	_ = viper.BindEnv("useAgent")
+	_ = viper.BindEnv("passphraseCommand")
+	_ = viper.BindEnv("certFile")
+	_ = viper.BindEnv("tlsCertFile")
+	_ = viper.BindEnv("tlsKeyFile")
+	_ = viper.BindEnv("tlsPin")
+	_ = viper.BindEnv("knownHostsFile")
 
 	// Flags
 	_ = viper.BindPFlag("configFile", cliRootCmd.PersistentFlags().Lookup("config-file"))
@@ -115,6 +190,18 @@ func init() {
 	_ = viper.BindPFlag("tlsSkipVerify", cliRootCmd.PersistentFlags().Lookup("tls-skip-verify"))
 	_ = viper.BindPFlag("tlsCaFile", cliRootCmd.PersistentFlags().Lookup("tls-ca-file"))
 	_ = viper.BindPFlag("tlsDisable", cliRootCmd.PersistentFlags().Lookup("tls-disable"))
+	_ = viper.BindPFlag("output", cliFactsCmd.Flags().Lookup("output"))
+	_ = viper.BindPFlag("where", cliRootCmd.PersistentFlags().Lookup("where"))
+	_ = viper.BindPFlag("pingInterval", cliRootCmd.PersistentFlags().Lookup("ping-interval"))
+	_ = viper.BindPFlag("pingTimeout", cliRootCmd.PersistentFlags().Lookup("ping-timeout"))
+	_ = viper.BindPFlag("signMessages", cliRootCmd.PersistentFlags().Lookup("sign-messages"))
+	_ = viper.BindPFlag("useAgent", cliRootCmd.PersistentFlags().Lookup("use-agent"))
+	_ = viper.BindPFlag("passphraseCommand", cliRootCmd.PersistentFlags().Lookup("passphrase-command"))
+	_ = viper.BindPFlag("certFile", cliRootCmd.PersistentFlags().Lookup("cert-file"))
+	_ = viper.BindPFlag("tlsCertFile", cliRootCmd.PersistentFlags().Lookup("tls-cert-file"))
+	_ = viper.BindPFlag("tlsKeyFile", cliRootCmd.PersistentFlags().Lookup("tls-key-file"))
+	_ = viper.BindPFlag("tlsPin", cliRootCmd.PersistentFlags().Lookup("tls-pin"))
+	_ = viper.BindPFlag("knownHostsFile", cliRootCmd.PersistentFlags().Lookup("known-hosts-file"))
 
 	// Config File
 	viper.SetConfigType("json")
@@ -9,18 +9,30 @@ import (
 
 func TestCliConf(t *testing.T) {
 	want := cliConfig{
-		ConfigFile:    DEFAULT_CLI_CONF_CONFIG_FILE,
-		Port:          config.DEFAULT_PORT,
-		KeyDir:        config.DEFAULT_KEY_DIR,
-		KeyName:       config.DEFAULT_KEY_NAME,
-		LogLevel:      config.DEFAULT_LOG_LEVEL,
-		BatchSize:     DEFAULT_CLI_CONF_BATCH_SIZE,
-		Delay:         DEFAULT_CLI_CONF_DELAY,
-		Verbose:       DEFAULT_CLI_CONF_VERBOSE,
-		Retry:         DEFAULT_CLI_CONF_RETRY,
-		TlsCaFile:     config.DEFAULT_TLS_CA_FILE,
-		TlsSkipVerify: config.DEFAULT_TLS_SKIP_VERIFY,
-		TlsDisable:    config.DEFAULT_TLS_DISABLE,
+		ConfigFile:        DEFAULT_CLI_CONF_CONFIG_FILE,
+		Port:              config.DEFAULT_PORT,
+		KeyDir:            config.DEFAULT_KEY_DIR,
+		KeyName:           config.DEFAULT_KEY_NAME,
+		LogLevel:          config.DEFAULT_LOG_LEVEL,
+		BatchSize:         DEFAULT_CLI_CONF_BATCH_SIZE,
+		Delay:             DEFAULT_CLI_CONF_DELAY,
+		Verbose:           DEFAULT_CLI_CONF_VERBOSE,
+		Retry:             DEFAULT_CLI_CONF_RETRY,
+		TlsCaFile:         config.DEFAULT_TLS_CA_FILE,
+		TlsSkipVerify:     config.DEFAULT_TLS_SKIP_VERIFY,
+		TlsDisable:        config.DEFAULT_TLS_DISABLE,
+		Output:            DEFAULT_CLI_CONF_OUTPUT,
+		Where:             DEFAULT_CLI_CONF_WHERE,
+		PingInterval:      config.DEFAULT_PING_INTERVAL,
+		PingTimeout:       config.DEFAULT_PING_TIMEOUT,
+		SignMessages:      config.DEFAULT_SIGN_MESSAGES,
+		UseAgent:          config.DEFAULT_USE_AGENT,
+		PassphraseCommand: config.DEFAULT_PASSPHRASE_COMMAND,
+		CertFile:          config.DEFAULT_CERT_FILE,
+		TlsCertFile:       config.DEFAULT_TLS_CERT_FILE,
+		TlsKeyFile:        config.DEFAULT_TLS_KEY_FILE,
+		TlsPin:            config.DEFAULT_TLS_PIN,
+		KnownHostsFile:    config.DEFAULT_KNOWN_HOSTS_FILE,
 	}
 
 	if !reflect.DeepEqual(cliConf, want) {
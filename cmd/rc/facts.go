@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cthayer/remote_control/internal/logger"
+	"github.com/cthayer/remote_control/pkg/facts"
+)
+
+const (
+	OUTPUT_JSON  = "json"
+	OUTPUT_TABLE = "table"
+)
+
+type factsRet struct {
+	Host  string
+	Facts *facts.Facts
+	Err   error
+}
+
+func runFacts(hosts []string) {
+	// load configuration
+	if err := initializeConfig(); err != nil {
+		_, _ = os.Stderr.WriteString("Failed to load configuration\n")
+		panic(err)
+	}
+
+	// setup logger
+	log := logger.GetLogger()
+	defer log.Sync()
+
+	if len(hosts) == 0 {
+		var err error
+
+		if hosts, err = readHosts(os.Stdin); err != nil {
+			// an error occurred while processing STDIN
+			_, _ = os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+	}
+
+	where, err := parseFilter(cliConf.Where)
+
+	if err != nil {
+		_, _ = os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+
+	var results []factsRet
+	exitCode := 0
+
+	for _, ret := range gatherFacts(hosts) {
+		if ret.Err != nil {
+			_, _ = os.Stderr.WriteString(ret.Host + ": " + ret.Err.Error() + "\n")
+			exitCode = 1
+		}
+
+		if ret.Err != nil || where.Match(ret.Facts) {
+			results = append(results, ret)
+		}
+	}
+
+	switch cliConf.Output {
+	case OUTPUT_TABLE:
+		err = writeFactsTable(os.Stdout, results)
+	default:
+		err = writeFactsJson(os.Stdout, results)
+	}
+
+	if err != nil {
+		_, _ = os.Stderr.WriteString("Error writing facts: " + err.Error() + "\n")
+		exitCode = 1
+	}
+
+	os.Exit(exitCode)
+}
+
+func readHosts(r io.Reader) ([]string, error) {
+	var hosts []string
+
+	line := bufio.NewScanner(r)
+
+	for line.Scan() {
+		host := strings.ToLower(strings.TrimSpace(line.Text()))
+
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, line.Err()
+}
+
+// gatherFacts queries the facts from all hosts, cliConf.BatchSize hosts at a time.  The results are in the same order
+// as hosts.
+func gatherFacts(hosts []string) []factsRet {
+	results := make([]factsRet, len(hosts))
+	batchWaitGroup := sync.WaitGroup{}
+
+	for start := 0; start < len(hosts); start += cliConf.BatchSize {
+		if start > 0 && cliConf.Delay > 0 {
+			// wait between batches
+			<-time.After(time.Duration(cliConf.Delay * int(time.Millisecond)))
+		}
+
+		end := start + cliConf.BatchSize
+
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+
+		// query all hosts in the batch in parallel
+		for i := start; i < end; i++ {
+			batchWaitGroup.Add(1)
+
+			go func(i int) {
+				defer batchWaitGroup.Done()
+
+				results[i].Host = hosts[i]
+				results[i].Facts, results[i].Err = sendFacts(hosts[i], 0)
+			}(i)
+		}
+
+		// wait for currently executing batch to finish
+		batchWaitGroup.Wait()
+	}
+
+	return results
+}
+
+func sendFacts(host string, tryCount int) (*facts.Facts, error) {
+	conn, errConnect := connect(host, tryCount)
+
+	if errConnect != nil {
+		return nil, errConnect
+	}
+
+	defer func() {
+		_ = <-conn.Stop()
+	}()
+
+	f := <-conn.Facts()
+
+	if f == nil {
+		return nil, errors.New("No facts received")
+	}
+
+	return f, nil
+}
+
+func writeFactsJson(w io.Writer, results []factsRet) error {
+	out := map[string]*facts.Facts{}
+
+	for _, ret := range results {
+		if ret.Err == nil {
+			out[ret.Host] = ret.Facts
+		}
+	}
+
+	jsonStr, err := json.MarshalIndent(out, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(jsonStr, '\n'))
+
+	return err
+}
+
+func writeFactsTable(w io.Writer, results []factsRet) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "HOST\tOS\tKERNEL\tCPUS\tMEMORY\tUPTIME\tLOAD\tVERSION")
+
+	for _, ret := range results {
+		if ret.Err != nil {
+			continue
+		}
+
+		f := ret.Facts
+
+		_, _ = fmt.Fprintln(tw, strings.Join([]string{
+			ret.Host,
+			strings.TrimSpace(f.Os + " " + f.OsVersion),
+			f.Kernel,
+			strconv.Itoa(f.Cpus),
+			formatBytes(f.Memory.Total),
+			(time.Duration(f.Uptime) * time.Second).String(),
+			strconv.FormatFloat(f.Load.One, 'f', 2, 64),
+			f.Version,
+		}, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// formatBytes formats a byte count using binary units (K, M, G, T)
+func formatBytes(b uint64) string {
+	units := []string{"", "K", "M", "G", "T", "P"}
+	value := float64(b)
+	i := 0
+
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+
+	if i == 0 {
+		return strconv.FormatUint(b, 10)
+	}
+
+	return strconv.FormatFloat(value, 'f', 1, 64) + units[i]
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/cthayer/remote_control/pkg/facts"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[uint64]string{
+		0:                      "0",
+		512:                    "512",
+		1536:                   "1.5K",
+		8 * 1024 * 1024 * 1024: "8.0G",
+	}
+
+	for b, want := range tests {
+		if got := formatBytes(b); got != want {
+			t.Errorf("formatBytes(%d) = %s, wanted %s", b, got, want)
+		}
+	}
+}
+
+func TestReadHosts(t *testing.T) {
+	hosts, err := readHosts(strings.NewReader("Host1\n\n  host2  \n"))
+
+	if err != nil {
+		t.Errorf("readHosts() error = %v, wanted %v", err, nil)
+	}
+
+	if strings.Join(hosts, ",") != "host1,host2" {
+		t.Errorf("readHosts() = %v, wanted [host1 host2]", hosts)
+	}
+}
+
+func TestWriteFactsTable(t *testing.T) {
+	var out bytes.Buffer
+
+	results := []factsRet{
+		{Host: "host1", Facts: &facts.Facts{Os: "ubuntu", OsVersion: "20.04", Kernel: "5.4.0", Cpus: 4, Version: "1.0.0"}},
+		{Host: "host2", Err: errors.New("connection refused")},
+	}
+
+	if err := writeFactsTable(&out, results); err != nil {
+		t.Errorf("writeFactsTable() error = %v, wanted %v", err, nil)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("writeFactsTable() wrote %d lines, wanted 2: %s", len(lines), out.String())
+	}
+
+	if !strings.HasPrefix(lines[1], "host1") || !strings.Contains(lines[1], "ubuntu 20.04") {
+		t.Errorf("writeFactsTable() row = %s, wanted host1 with os ubuntu 20.04", lines[1])
+	}
+}
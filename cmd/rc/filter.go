@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cthayer/remote_control/pkg/facts"
+)
+
+// filter is a list of conditions on host facts that must all be true for a host to match
+//
+// The expression language is a comma separated list of `<fact><op><value>` conditions, for example
+// `os=ubuntu,mem>8G,custom.role.tier!=db`.
+//
+//   - <fact> is a (dot separated) path into the facts JSON, or one of the shortcuts in factAliases
+//   - <op> is one of: =, !=, >, >=, <, <=, ~ (regular expression match)
+//   - <value> is compared as a number when both sides are numbers (K, M, G, T and P suffixes are allowed), otherwise
+//     as a case insensitive string
+type filter []condition
+
+type condition struct {
+	Fact  string
+	Op    string
+	Value string
+	regex *regexp.Regexp
+}
+
+var conditionPattern = regexp.MustCompile(`^\s*([A-Za-z0-9_.\-]+)\s*(!=|>=|<=|=|>|<|~)\s*(.*?)\s*$`)
+
+var factAliases = map[string]string{
+	"mem":    "memory.total",
+	"memory": "memory.total",
+	"load":   "load.one",
+	"host":   "hostname",
+}
+
+var sizeSuffixes = map[string]float64{
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+	"P": 1 << 50,
+}
+
+func parseFilter(expr string) (filter, error) {
+	var f filter
+
+	if strings.TrimSpace(expr) == "" {
+		return f, nil
+	}
+
+	for _, part := range strings.Split(expr, ",") {
+		matches := conditionPattern.FindStringSubmatch(part)
+
+		if matches == nil {
+			return nil, errors.New("invalid filter condition: " + part)
+		}
+
+		c := condition{Fact: matches[1], Op: matches[2], Value: matches[3]}
+
+		if alias, ok := factAliases[c.Fact]; ok {
+			c.Fact = alias
+		}
+
+		if c.Op == "~" {
+			regex, err := regexp.Compile(c.Value)
+
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid filter condition: "+part)
+			}
+
+			c.regex = regex
+		}
+
+		f = append(f, c)
+	}
+
+	return f, nil
+}
+
+func (f filter) Match(hostFacts *facts.Facts) bool {
+	if len(f) == 0 {
+		return true
+	}
+
+	if hostFacts == nil {
+		return false
+	}
+
+	// use the JSON representation of the facts so that custom facts can be matched the same way as the builtin ones
+	var values map[string]interface{}
+
+	jsonStr, err := json.Marshal(hostFacts)
+
+	if err != nil || json.Unmarshal(jsonStr, &values) != nil {
+		return false
+	}
+
+	for _, c := range f {
+		if !c.match(values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *condition) match(values map[string]interface{}) bool {
+	value, ok := lookupFact(values, c.Fact)
+
+	if !ok {
+		// a missing fact only matches when asking for it to be different
+		return c.Op == "!="
+	}
+
+	actual := factString(value)
+
+	if c.regex != nil {
+		return c.regex.MatchString(actual)
+	}
+
+	a, aErr := parseNumber(actual)
+	b, bErr := parseNumber(c.Value)
+
+	if aErr == nil && bErr == nil {
+		switch c.Op {
+		case "=":
+			return a == b
+		case "!=":
+			return a != b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		}
+	}
+
+	switch c.Op {
+	case "=":
+		return strings.EqualFold(actual, c.Value)
+	case "!=":
+		return !strings.EqualFold(actual, c.Value)
+	}
+
+	// ordering requires numbers
+	return false
+}
+
+func lookupFact(values map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = values
+
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+
+		if !ok {
+			return nil, false
+		}
+
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func factString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	}
+
+	jsonStr, _ := json.Marshal(value)
+
+	return string(jsonStr)
+}
+
+func parseNumber(value string) (float64, error) {
+	multiplier := 1.0
+	value = strings.TrimSpace(value)
+
+	if len(value) > 1 {
+		if m, ok := sizeSuffixes[strings.ToUpper(value[len(value)-1:])]; ok {
+			multiplier = m
+			value = value[:len(value)-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+
+	return number * multiplier, err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cthayer/remote_control/pkg/facts"
+)
+
+func TestParseFilter(t *testing.T) {
+	f, err := parseFilter("os=ubuntu, mem>8G,custom.role~^web")
+
+	if err != nil {
+		t.Errorf("parseFilter() error = %v, wanted %v", err, nil)
+	}
+
+	if len(f) != 3 {
+		t.Fatalf("parseFilter() returned %d conditions, wanted 3", len(f))
+	}
+
+	if f[1].Fact != "memory.total" || f[1].Op != ">" || f[1].Value != "8G" {
+		t.Errorf("parseFilter() condition = %v, wanted memory.total > 8G", f[1])
+	}
+
+	if _, err := parseFilter("os"); err == nil {
+		t.Error("parseFilter() should fail for a condition without an operator")
+	}
+
+	if _, err := parseFilter("os~("); err == nil {
+		t.Error("parseFilter() should fail for an invalid regular expression")
+	}
+
+	if f, err := parseFilter(""); err != nil || len(f) != 0 {
+		t.Errorf("parseFilter(\"\") = %v, %v, wanted an empty filter", f, err)
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	hostFacts := &facts.Facts{
+		Hostname: "web1.example.com",
+		Os:       "ubuntu",
+		Cpus:     4,
+		Memory:   facts.Memory{Total: 16 * 1024 * 1024 * 1024},
+		Load:     facts.Load{One: 0.5},
+		Custom: map[string]interface{}{
+			"role": map[string]interface{}{"tier": "frontend"},
+		},
+	}
+
+	tests := map[string]bool{
+		"":                              true,
+		"os=ubuntu":                     true,
+		"os=Ubuntu":                     true,
+		"os!=ubuntu":                    false,
+		"os=centos":                     false,
+		"mem>8G":                        true,
+		"mem>=16G":                      true,
+		"mem<8G":                        false,
+		"cpus=4,load<1":                 true,
+		"cpus=4,load>1":                 false,
+		"host~^web[0-9]+":               true,
+		"custom.role.tier=frontend":     true,
+		"custom.role.tier!=db":          true,
+		"custom.missing=value":          false,
+		"custom.missing!=value":         true,
+		"os>ubuntu":                     false,
+		"os=ubuntu,custom.role.tier=db": false,
+	}
+
+	for expr, want := range tests {
+		f, err := parseFilter(expr)
+
+		if err != nil {
+			t.Errorf("parseFilter(%q) error = %v", expr, err)
+			continue
+		}
+
+		if got := f.Match(hostFacts); got != want {
+			t.Errorf("Match(%q) = %v, wanted %v", expr, got, want)
+		}
+	}
+
+	if f, _ := parseFilter("os=ubuntu"); f.Match(nil) {
+		t.Error("Match() should not match hosts without facts")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cthayer/remote_control/pkg/client"
+)
+
+// promptHostKey asks on the terminal whether to trust a server whose fingerprint is not in the known hosts file.
+// Servers are refused when there is no terminal to ask on.
+func promptHostKey(host string, fingerprint string) (bool, error) {
+	tty, err := os.OpenFile(TTY_PATH, os.O_RDWR, 0)
+
+	if err != nil {
+		return false, errors.Wrap(client.ErrUnknownHost, "no terminal to confirm the fingerprint of "+host)
+	}
+
+	defer tty.Close()
+
+	_, _ = fmt.Fprintf(tty, "The authenticity of host '%s' can't be established.\n", host)
+	_, _ = fmt.Fprintf(tty, "Its certificate fingerprint is %s.\n", fingerprint)
+	_, _ = fmt.Fprint(tty, "Are you sure you want to continue connecting (yes/no)? ")
+
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+
+	if err != nil {
+		return false, err
+	}
+
+	return strings.ToLower(strings.TrimSpace(answer)) == "yes", nil
+}
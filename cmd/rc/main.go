@@ -6,6 +6,7 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -53,6 +54,12 @@ func main() {
 	<-done
 }
 
+type summary struct {
+	Succeeded []string
+	Failed    []string
+	Excluded  []string
+}
+
 func runCommand(args []string) {
 	// load configuration
 	if err := initializeConfig(); err != nil {
@@ -64,25 +71,43 @@ func runCommand(args []string) {
 	log := logger.GetLogger()
 	defer log.Sync()
 
+	where, err := parseFilter(cliConf.Where)
+
+	if err != nil {
+		_, _ = os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+
 	if len(args) == 1 {
-		processStdin(args[0])
+		processStdin(args[0], where)
 		os.Exit(0)
 		return
 	}
 
-	resp, err := sendCommand(strings.ToLower(strings.TrimSpace(args[0])), args[1], 0)
+	host := strings.ToLower(strings.TrimSpace(args[0]))
+
+	if len(where) > 0 {
+		sum := summary{}
+
+		if len(filterHosts([]string{host}, where, &sum)) == 0 {
+			// same as a host that is excluded from a list of hosts: the command isn't sent, which isn't a failure
+			_, _ = os.Stderr.WriteString("excluded: " + host + " does not match --where\n")
+			os.Exit(0)
+		}
+	}
+
+	resp, err := sendCommand(host, args[1], 0)
 
 	writeResponse("", resp, err)
 
-	os.Exit(resp.ExitCode)
+	os.Exit(exitCode(resp, err))
 }
 
-func processStdin(command string) {
+func processStdin(command string, where filter) {
 	var batch []string
 
-	batchWaitGroup := sync.WaitGroup{}
+	sum := summary{}
 	line := bufio.NewScanner(os.Stdin)
-	respChan := make(chan sendCmdRet, cliConf.BatchSize)
 	firstBatch := true
 
 	for line.Scan() {
@@ -105,48 +130,97 @@ func processStdin(command string) {
 				firstBatch = false
 			}
 
-			// send the command to all hosts in the batch in parallel
-			for _, h := range batch {
-				batchWaitGroup.Add(1)
-				go handleBackgroundCommand(&batchWaitGroup, h, command, respChan)
-			}
+			processBatch(batch, command, where, &sum)
 
 			// start a new batch
 			batch = []string{}
-
-			// wait for currently executing batch to finish
-			batchWaitGroup.Wait()
-
-			// re-sync results to print to terminal properly
-			for i := 0; i < cliConf.BatchSize; i++ {
-				ret := <-respChan
-
-				writeResponse(ret.Host, ret.Resp, ret.Err)
-			}
 		}
 	}
 
 	if len(batch) > 0 {
 		// process any remaining hosts (partial batch size)
-		for _, h := range batch {
-			batchWaitGroup.Add(1)
-			go handleBackgroundCommand(&batchWaitGroup, h, command, respChan)
+		processBatch(batch, command, where, &sum)
+	}
+
+	if err := line.Err(); err != nil {
+		// an error occurred while processing STDIN
+		_, _ = os.Stderr.WriteString(err.Error() + "\n")
+	}
+
+	writeSummary(&sum)
+}
+
+func processBatch(batch []string, command string, where filter, sum *summary) {
+	hosts := batch
+
+	if len(where) > 0 {
+		// only send the command to the hosts whose facts match the filter
+		hosts = filterHosts(batch, where, sum)
+	}
+
+	batchWaitGroup := sync.WaitGroup{}
+	respChan := make(chan sendCmdRet, len(hosts))
+
+	// send the command to all hosts in the batch in parallel
+	for _, h := range hosts {
+		batchWaitGroup.Add(1)
+		go handleBackgroundCommand(&batchWaitGroup, h, command, respChan)
+	}
+
+	// wait for currently executing batch to finish
+	batchWaitGroup.Wait()
+
+	// re-sync results to print to terminal properly
+	for range hosts {
+		ret := <-respChan
+
+		writeResponse(ret.Host, ret.Resp, ret.Err)
+
+		if exitCode(ret.Resp, ret.Err) == 0 {
+			sum.Succeeded = append(sum.Succeeded, ret.Host)
+		} else {
+			sum.Failed = append(sum.Failed, ret.Host)
 		}
+	}
+}
 
-		// wait for currently executing batch to finish
-		batchWaitGroup.Wait()
+func filterHosts(batch []string, where filter, sum *summary) []string {
+	var hosts []string
 
-		// re-sync results to print to terminal properly
-		for i := 0; i < cliConf.BatchSize; i++ {
-			ret := <-respChan
+	log := logger.GetLogger()
 
-			writeResponse(ret.Host, ret.Resp, ret.Err)
+	for _, ret := range gatherFacts(batch) {
+		if ret.Err != nil {
+			// hosts whose facts are unknown can't match the filter
+			log.Debug("excluding host, unable to gather facts", zap.String("host", ret.Host), zap.Error(ret.Err))
+			sum.Excluded = append(sum.Excluded, ret.Host)
+			continue
+		}
+
+		if !where.Match(ret.Facts) {
+			log.Debug("excluding host, facts do not match filter", zap.String("host", ret.Host))
+			sum.Excluded = append(sum.Excluded, ret.Host)
+			continue
 		}
+
+		hosts = append(hosts, ret.Host)
 	}
 
-	if err := line.Err(); err != nil {
-		// an error occurred while processing STDIN
-		_, _ = os.Stderr.WriteString(err.Error() + "\n")
+	return hosts
+}
+
+func writeSummary(sum *summary) {
+	// the output of a single host speaks for itself
+	if len(sum.Succeeded)+len(sum.Failed)+len(sum.Excluded) <= 1 {
+		return
+	}
+
+	_, _ = os.Stderr.WriteString("\n---- summary ----\n")
+	_, _ = os.Stderr.WriteString("succeeded: " + strconv.Itoa(len(sum.Succeeded)) + "\n")
+	_, _ = os.Stderr.WriteString("failed: " + strconv.Itoa(len(sum.Failed)) + " " + strings.Join(sum.Failed, " ") + "\n")
+
+	if len(sum.Excluded) > 0 {
+		_, _ = os.Stderr.WriteString("excluded: " + strconv.Itoa(len(sum.Excluded)) + " " + strings.Join(sum.Excluded, " ") + "\n")
 	}
 }
 
@@ -197,18 +271,55 @@ func writeResponse(host string, resp *rc_protocol.Response, err error) {
 	_, _ = os.Stdout.WriteString(green(resp.Stdout) + "\n")
 }
 
+// exitCode is the exit code of rc for the response of a host: the command's exit code or 1 when no response was received
+func exitCode(resp *rc_protocol.Response, err error) int {
+	if err != nil || resp == nil {
+		return 1
+	}
+
+	return resp.ExitCode
+}
+
 func sendCommand(host string, command string, tryCount int) (*rc_protocol.Response, error) {
+	conn, errConnect := connect(host, tryCount)
+
+	if errConnect != nil {
+		return nil, errConnect
+	}
+
+	defer func() {
+		_ = <-conn.Stop()
+	}()
+
+	resp := <-conn.Send(command, rc_protocol.MessageOptions{})
+
+	return resp, nil
+}
+
+func connect(host string, tryCount int) (client.Client, error) {
 	log := logger.GetLogger()
 
 	conf := config.Config{
-		Port:          cliConf.Port,
-		Host:          host,
-		KeyDir:        cliConf.KeyDir,
-		KeyName:       cliConf.KeyName,
-		LogLevel:      cliConf.LogLevel,
-		TlsSkipVerify: cliConf.TlsSkipVerify,
-		TlsCaFile:     cliConf.TlsCaFile,
-		TlsDisable:    cliConf.TlsDisable,
+		Port:              cliConf.Port,
+		Host:              host,
+		KeyDir:            cliConf.KeyDir,
+		KeyName:           cliConf.KeyName,
+		LogLevel:          cliConf.LogLevel,
+		TlsSkipVerify:     cliConf.TlsSkipVerify,
+		TlsCaFile:         cliConf.TlsCaFile,
+		TlsDisable:        cliConf.TlsDisable,
+		PingInterval:      cliConf.PingInterval,
+		PingTimeout:       cliConf.PingTimeout,
+		SignMessages:      cliConf.SignMessages,
+		UseAgent:          cliConf.UseAgent,
+		PassphraseCommand: cliConf.PassphraseCommand,
+		PassphrasePrompt:  promptPassphrase,
+		HostKeyPrompt:     promptHostKey,
+		CertFile:          cliConf.CertFile,
+		TlsCertFile:       cliConf.TlsCertFile,
+		TlsKeyFile:        cliConf.TlsKeyFile,
+		TlsPin:            cliConf.TlsPin,
+		KnownHostsFile:    cliConf.KnownHostsFile,
 	}
 
 	conn := client.NewClient(conf)
@@ -216,22 +327,17 @@ func sendCommand(host string, command string, tryCount int) (*rc_protocol.Respon
 	errConnect := <-conn.Start()
 
 	if errConnect != nil {
-		if tryCount < cliConf.Retry {
+		// the server won't accept the key on another attempt
+		if tryCount < cliConf.Retry && !client.IsAuthError(errConnect) {
 			// retry the connection after a slight delay
 			log.Debug("connection retry attempt", zap.String("host", host), zap.Int("retry", tryCount+1), zap.Int("maxRetry", cliConf.Retry))
-			return sendCommand(host, command, tryCount+1)
+			return connect(host, tryCount+1)
 		}
 
 		return nil, errConnect
 	}
 
-	defer func() {
-		_ = <-conn.Stop()
-	}()
-
-	resp := <-conn.Send(command, rc_protocol.MessageOptions{})
-
-	return resp, nil
+	return conn, nil
 }
 
 func setupSignalHandler() chan bool {
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/pkg/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *rc_protocol.Response
+		err  error
+		want int
+	}{
+		{"success", &rc_protocol.Response{ExitCode: 0}, nil, 0},
+		{"failed command", &rc_protocol.Response{ExitCode: 3}, nil, 3},
+		{"no response", nil, nil, 1},
+		{"error", nil, errors.New("connection refused"), 1},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.resp, tt.err); got != tt.want {
+			t.Errorf("exitCode() for %s = %d, wanted %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSendCommand_Connect_Error(t *testing.T) {
+	// a port that nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	saved := cliConf
+	defer func() { cliConf = saved }()
+
+	cliConf.Port = port
+	cliConf.Retry = 0
+	cliConf.TlsDisable = true
+	cliConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	cliConf.KeyName = "client"
+
+	resp, err := sendCommand("127.0.0.1", "echo hello", 0)
+
+	if err == nil || resp != nil {
+		t.Fatalf("sendCommand() = %v, %v, wanted a connection error", resp, err)
+	}
+
+	if got := exitCode(resp, err); got != 1 {
+		t.Errorf("exitCode() after a connection error = %d, wanted 1", got)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+)
+
+const (
+	TTY_PATH = "/dev/tty"
+)
+
+// promptPassphrase asks for the passphrase of an encrypted private key on the terminal.  STDIN can't be used since it
+// may be the list of hosts.
+func promptPassphrase(path string) ([]byte, error) {
+	tty, err := os.OpenFile(TTY_PATH, os.O_RDWR, 0)
+
+	if err != nil {
+		return nil, errors.Wrap(auth.ErrPassphraseRequired, "no terminal to ask for the passphrase")
+	}
+
+	defer tty.Close()
+
+	_, _ = fmt.Fprintf(tty, "Enter passphrase for %s: ", path)
+
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+
+	_, _ = fmt.Fprintln(tty)
+
+	return passphrase, err
+}
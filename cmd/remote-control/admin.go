@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/cthayer/remote_control/internal/server"
+)
+
+const (
+	ADMIN_REQUEST_TIMEOUT = 10 * time.Second
+	// ADMIN_URL is the base url of the admin API (the host is ignored since the requests go to the admin socket)
+	ADMIN_URL = "http://remote-control"
+)
+
+var adminJson = false
+
+var adminCmd = cobra.Command{
+	Use:          "admin",
+	Short:        "Inspects and controls the running remote-control service through its admin socket",
+	Long:         "Inspects and controls the running remote-control service\n\nThe requests are sent to the admin API on the unix socket set by adminSocket\n (only root and the user running the service may use it)",
+	Example:      "  remote-control admin status\n  remote-control admin commands\n  remote-control admin kill 42",
+	SilenceUsage: true,
+}
+
+type adminStatus struct {
+	Status           string   `json:"status"`
+	Reasons          []string `json:"reasons"`
+	QueueDepth       int      `json:"queueDepth"`
+	QueueCapacity    int      `json:"queueCapacity"`
+	RunningCommands  int      `json:"runningCommands"`
+	Workers          int      `json:"workers"`
+	WorkerSaturation float64  `json:"workerSaturation"`
+	Draining         bool     `json:"draining"`
+	Connections      int      `json:"connections"`
+	LogLevel         string   `json:"logLevel"`
+}
+
+type adminClient struct {
+	Id               uint64  `json:"id"`
+	Key              string  `json:"key"`
+	RemoteAddr       string  `json:"remoteAddr"`
+	ConnectedSeconds float64 `json:"connectedSeconds"`
+}
+
+type adminCommand struct {
+	Id         uint64  `json:"id"`
+	Key        string  `json:"key"`
+	Command    string  `json:"command"`
+	State      string  `json:"state"`
+	Pid        int     `json:"pid"`
+	AgeSeconds float64 `json:"ageSeconds"`
+}
+
+type adminLogLevel struct {
+	Level string `json:"level"`
+}
+
+func init() {
+	adminCmd.PersistentFlags().BoolVarP(&adminJson, "json", "", false, "print the responses of the admin API as JSON")
+
+	adminCmd.AddCommand(
+		&cobra.Command{
+			Use:   "status",
+			Short: "Shows the worker utilization, queue and drain state of the service",
+			Args:  cobra.ExactArgs(0),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var status adminStatus
+
+				return adminRequest(http.MethodGet, server.ADMIN_PATH_STATUS, nil, &status, func(w io.Writer) {
+					printAdminStatus(w, &status)
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "clients",
+			Short: "Lists the connected clients",
+			Args:  cobra.ExactArgs(0),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var clients []adminClient
+
+				return adminRequest(http.MethodGet, server.ADMIN_PATH_CLIENTS, nil, &clients, func(w io.Writer) {
+					printAdminClients(w, clients)
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "commands",
+			Short: "Lists the running and queued commands",
+			Args:  cobra.ExactArgs(0),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var commands []adminCommand
+
+				return adminRequest(http.MethodGet, server.ADMIN_PATH_COMMANDS, nil, &commands, func(w io.Writer) {
+					printAdminCommands(w, commands)
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "kill ID",
+			Short: "Kills a running command (or cancels a queued one)",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+					return errors.New("invalid command id: " + args[0])
+				}
+
+				return adminRequest(http.MethodDelete, server.ADMIN_PATH_COMMANDS+"/"+args[0], nil, nil, nil)
+			},
+		},
+		&cobra.Command{
+			Use:   "disconnect ID",
+			Short: "Disconnects a client",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+					return errors.New("invalid client id: " + args[0])
+				}
+
+				return adminRequest(http.MethodDelete, server.ADMIN_PATH_CLIENTS+"/"+args[0], nil, nil, nil)
+			},
+		},
+		&cobra.Command{
+			Use:   "drain",
+			Short: "Stops accepting new commands and lets the running ones finish",
+			Args:  cobra.ExactArgs(0),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var status adminStatus
+
+				return adminRequest(http.MethodPut, server.ADMIN_PATH_DRAIN, nil, &status, func(w io.Writer) {
+					printAdminStatus(w, &status)
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "resume",
+			Short: "Accepts new commands again after a drain",
+			Args:  cobra.ExactArgs(0),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var status adminStatus
+
+				return adminRequest(http.MethodDelete, server.ADMIN_PATH_DRAIN, nil, &status, func(w io.Writer) {
+					printAdminStatus(w, &status)
+				})
+			},
+		},
+		&cobra.Command{
+			Use:   "log-level [LEVEL]",
+			Short: "Shows or changes the log level (error, warn, info or debug) of the service",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var level adminLogLevel
+
+				method := http.MethodGet
+				var body interface{}
+
+				if len(args) > 0 {
+					method = http.MethodPut
+					body = adminLogLevel{Level: args[0]}
+				}
+
+				return adminRequest(method, server.ADMIN_PATH_LOG_LEVEL, body, &level, func(w io.Writer) {
+					_, _ = fmt.Fprintln(w, level.Level)
+				})
+			},
+		},
+	)
+
+	// errors from the admin API aren't usage errors
+	for _, cmd := range adminCmd.Commands() {
+		cmd.SilenceUsage = true
+	}
+
+	cliRootCmd.AddCommand(&adminCmd)
+}
+
+// adminRequest sends a request to the admin API and prints the response (as JSON with --json)
+func adminRequest(method string, path string, body interface{}, resp interface{}, print func(io.Writer)) error {
+	if err := loadConfig(); err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	socket := cliConf.AdminSocket
+
+	if socket == "" {
+		return errors.New("the admin socket is not configured (set adminSocket or --admin-socket)")
+	}
+
+	var reqBody io.Reader
+
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequest(method, ADMIN_URL+path, reqBody)
+
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{
+		Timeout: ADMIN_REQUEST_TIMEOUT,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return errors.Wrap(err, "failed to reach the admin socket "+socket)
+	}
+
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var adminErr struct {
+			Error string `json:"error"`
+		}
+
+		if json.Unmarshal(data, &adminErr) == nil && adminErr.Error != "" {
+			return errors.New(adminErr.Error)
+		}
+
+		return errors.New(res.Status)
+	}
+
+	if resp == nil || print == nil {
+		return nil
+	}
+
+	if adminJson {
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+
+	if err := json.Unmarshal(data, resp); err != nil {
+		return errors.Wrap(err, "invalid response from the admin API")
+	}
+
+	print(os.Stdout)
+
+	return nil
+}
+
+func printAdminStatus(w io.Writer, status *adminStatus) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	_, _ = fmt.Fprintf(tw, "Status:\t%s\n", status.Status)
+
+	for _, reason := range status.Reasons {
+		_, _ = fmt.Fprintf(tw, "Reason:\t%s\n", reason)
+	}
+
+	_, _ = fmt.Fprintf(tw, "Workers:\t%d/%d busy (%.0f%%)\n", status.RunningCommands, status.Workers, status.WorkerSaturation*100)
+	_, _ = fmt.Fprintf(tw, "Queue:\t%d/%d\n", status.QueueDepth, status.QueueCapacity)
+	_, _ = fmt.Fprintf(tw, "Connections:\t%d\n", status.Connections)
+	_, _ = fmt.Fprintf(tw, "Draining:\t%t\n", status.Draining)
+	_, _ = fmt.Fprintf(tw, "Log Level:\t%s\n", status.LogLevel)
+
+	_ = tw.Flush()
+}
+
+func printAdminClients(w io.Writer, clients []adminClient) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "ID\tKEY\tREMOTE ADDRESS\tCONNECTED")
+
+	for _, c := range clients {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", c.Id, c.Key, c.RemoteAddr, formatSeconds(c.ConnectedSeconds))
+	}
+
+	_ = tw.Flush()
+}
+
+func printAdminCommands(w io.Writer, commands []adminCommand) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "ID\tKEY\tSTATE\tPID\tAGE\tCOMMAND")
+
+	for _, c := range commands {
+		pid := "-"
+
+		if c.Pid != 0 {
+			pid = strconv.Itoa(c.Pid)
+		}
+
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", c.Id, c.Key, c.State, pid, formatSeconds(c.AgeSeconds), c.Command)
+	}
+
+	_ = tw.Flush()
+}
+
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
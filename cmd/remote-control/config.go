@@ -30,31 +30,124 @@ var cliRootCmd = cobra.Command{
 }
 
 type cliConfig struct {
-	ConfigFile  string
-	Port        int
-	CertDir     string
-	Ciphers     string
-	LogLevel    string
-	Host        string
-	PidFile     string
-	TlsKeyFile  string
-	TlsCertFile string
+	ConfigFile             string
+	Port                   int
+	CertDir                string
+	Ciphers                string
+	LogLevel               string
+	Host                   string
+	PidFile                string
+	TlsKeyFile             string
+	TlsCertFile            string
+	FactsDir               string
+	HealthPath             string
+	ReadyPath              string
+	HealthHost             string
+	HealthPort             int
+	MetricsPath            string
+	MetricsHost            string
+	MetricsPort            int
+	PingInterval           int
+	PingTimeout            int
+	IdleTimeout            int
+	AuthMaxClockSkew       int
+	MessageSigning         string
+	AuthorizedKeysFile     string
+	RevokedKeysFile        string
+	KeyValidityFile        string
+	SshCaFile              string
+	X509CaFile             string
+	SshCertPrincipals      []string
+	SshCertExtensions      []string
+	AuthMode               string
+	TlsClientCaFile        string
+	TlsExpiryWarning       int
+	TlsSelfSigned          bool
+	UnixSocket             string
+	UnixSocketMode         string
+	UnixSocketGroup        string
+	UnixSocketAllow        []string
+	Listen                 []string
+	Listeners              []config.Listener
+	AllowedOrigins         []string
+	AdminSocket            string
+	MaxConnections         int
+	MaxIpConnections       int
+	IpMessageRate          int
+	KeyMessageRate         int
+	MessageBurst           int
+	AuthFailureLimit       int
+	AuthLockout            int
+	AuthLockoutMax         int
+	MaxMessageSize         int
+	Cors                   bool
+	GrpcHost               string
+	GrpcPort               int
+	ServerNames            []string
+	AllowUnboundSignatures bool
 }
 
 var cliConf cliConfig = cliConfig{
-	ConfigFile:  DEFAULT_CLI_CONF_CONFIG_FILE,
-	Port:        config.DEFAULT_PORT,
-	CertDir:     config.DEFAULT_CERT_DIR,
-	Ciphers:     config.DEFAULT_CIPHERS,
-	LogLevel:    config.DEFAULT_LOG_LEVEL,
-	Host:        config.DEFAULT_HOST,
-	PidFile:     DEFAULT_CLI_CONF_PID_FILE,
-	TlsKeyFile:  config.DEFAULT_TLS_KEY_FILE,
-	TlsCertFile: config.DEFAULT_TLS_CERT_FILE,
+	ConfigFile:             DEFAULT_CLI_CONF_CONFIG_FILE,
+	Port:                   config.DEFAULT_PORT,
+	CertDir:                config.DEFAULT_CERT_DIR,
+	Ciphers:                config.DEFAULT_CIPHERS,
+	LogLevel:               config.DEFAULT_LOG_LEVEL,
+	Host:                   config.DEFAULT_HOST,
+	PidFile:                DEFAULT_CLI_CONF_PID_FILE,
+	TlsKeyFile:             config.DEFAULT_TLS_KEY_FILE,
+	TlsCertFile:            config.DEFAULT_TLS_CERT_FILE,
+	FactsDir:               config.DEFAULT_FACTS_DIR,
+	HealthPath:             config.DEFAULT_HEALTH_PATH,
+	ReadyPath:              config.DEFAULT_READY_PATH,
+	HealthHost:             config.DEFAULT_HEALTH_HOST,
+	HealthPort:             config.DEFAULT_HEALTH_PORT,
+	MetricsPath:            config.DEFAULT_METRICS_PATH,
+	MetricsHost:            config.DEFAULT_METRICS_HOST,
+	MetricsPort:            config.DEFAULT_METRICS_PORT,
+	PingInterval:           config.DEFAULT_ENGINE_OPTIONS_PING_INTERVAL,
+	PingTimeout:            config.DEFAULT_ENGINE_OPTIONS_PING_TIMEOUT,
+	IdleTimeout:            config.DEFAULT_IDLE_TIMEOUT,
+	AuthMaxClockSkew:       config.DEFAULT_AUTH_MAX_CLOCK_SKEW,
+	MessageSigning:         config.DEFAULT_MESSAGE_SIGNING,
+	AuthorizedKeysFile:     config.DEFAULT_AUTHORIZED_KEYS_FILE,
+	RevokedKeysFile:        config.DEFAULT_REVOKED_KEYS_FILE,
+	KeyValidityFile:        config.DEFAULT_KEY_VALIDITY_FILE,
+	SshCaFile:              config.DEFAULT_SSH_CA_FILE,
+	X509CaFile:             config.DEFAULT_X509_CA_FILE,
+	AuthMode:               config.DEFAULT_AUTH_MODE,
+	TlsClientCaFile:        config.DEFAULT_TLS_CLIENT_CA_FILE,
+	TlsExpiryWarning:       config.DEFAULT_TLS_EXPIRY_WARNING,
+	TlsSelfSigned:          config.DEFAULT_TLS_SELF_SIGNED,
+	UnixSocket:             config.DEFAULT_UNIX_SOCKET,
+	UnixSocketMode:         config.DEFAULT_UNIX_SOCKET_MODE,
+	UnixSocketGroup:        config.DEFAULT_UNIX_SOCKET_GROUP,
+	AdminSocket:            config.DEFAULT_ADMIN_SOCKET,
+	MaxConnections:         config.DEFAULT_MAX_CONNECTIONS,
+	MaxIpConnections:       config.DEFAULT_MAX_IP_CONNECTIONS,
+	IpMessageRate:          config.DEFAULT_IP_MESSAGE_RATE,
+	KeyMessageRate:         config.DEFAULT_KEY_MESSAGE_RATE,
+	MessageBurst:           config.DEFAULT_MESSAGE_BURST,
+	AuthFailureLimit:       config.DEFAULT_AUTH_FAILURE_LIMIT,
+	AuthLockout:            config.DEFAULT_AUTH_LOCKOUT,
+	AuthLockoutMax:         config.DEFAULT_AUTH_LOCKOUT_MAX,
+	MaxMessageSize:         config.DEFAULT_MAX_MESSAGE_SIZE,
+	Cors:                   config.DEFAULT_CORS,
+	GrpcHost:               config.DEFAULT_GRPC_HOST,
+	GrpcPort:               config.DEFAULT_GRPC_PORT,
+	AllowUnboundSignatures: config.DEFAULT_ALLOW_UNBOUND_SIGNATURES,
 }
 
 var onConfigUpdateFuncs []func() error = make([]func() error, 0)
 
+// allowedOriginsFlag holds the value of --allowed-origins, which is decoded into cliConf.AllowedOrigins along with the
+// config file
+var allowedOriginsFlag []string
+
+// serverNamesFlag, sshCertPrincipalsFlag, sshCertExtensionsFlag and unixSocketAllowFlag hold the values of
+// --server-names, --ssh-cert-principals, --ssh-cert-extensions and --unix-socket-allow (see allowedOriginsFlag)
+var serverNamesFlag, sshCertPrincipalsFlag, sshCertExtensionsFlag, unixSocketAllowFlag []string
+
 func init() {
 	cliRootCmd.PersistentFlags().StringVarP(&cliConf.ConfigFile, "config-file", "c", DEFAULT_CLI_CONF_CONFIG_FILE, "path to JSON formatted configuration file")
 	cliRootCmd.PersistentFlags().IntVarP(&cliConf.Port, "port", "p", config.DEFAULT_PORT, "port to listen on")
@@ -65,6 +158,51 @@ func init() {
 	cliRootCmd.PersistentFlags().StringVarP(&cliConf.PidFile, "pid-file", "", DEFAULT_CLI_CONF_PID_FILE, "the file to write the pid to (used for initv style services")
 	cliRootCmd.PersistentFlags().StringVarP(&cliConf.TlsKeyFile, "tls-key-file", "", config.DEFAULT_TLS_KEY_FILE, "the path to the private key to use for TLS")
 	cliRootCmd.PersistentFlags().StringVarP(&cliConf.TlsCertFile, "tls-cert-file", "", config.DEFAULT_TLS_CERT_FILE, "the path to the certificate to use for TLS")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.FactsDir, "facts-dir", "", config.DEFAULT_FACTS_DIR, "path to the folder that contains custom facts (JSON files or executables)")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.HealthPath, "health-path", "", config.DEFAULT_HEALTH_PATH, "the path of the (unauthenticated) liveness endpoint")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.ReadyPath, "ready-path", "", config.DEFAULT_READY_PATH, "the path of the (unauthenticated) readiness endpoint")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.HealthHost, "health-host", "", config.DEFAULT_HEALTH_HOST, "the interface to bind the separate health listener to")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.HealthPort, "health-port", "", config.DEFAULT_HEALTH_PORT, "serve the health endpoints on this separate plaintext port (0 serves them on the main port)")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.MetricsPath, "metrics-path", "", config.DEFAULT_METRICS_PATH, "the path of the (unauthenticated) prometheus metrics endpoint")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.MetricsHost, "metrics-host", "", config.DEFAULT_METRICS_HOST, "the interface to bind the separate metrics listener to")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.MetricsPort, "metrics-port", "", config.DEFAULT_METRICS_PORT, "serve the metrics endpoint on this separate plaintext port (0 disables it)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.PingInterval, "ping-interval", "", config.DEFAULT_ENGINE_OPTIONS_PING_INTERVAL, "how often to ping clients (in ms, 0 disables pings)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.PingTimeout, "ping-timeout", "", config.DEFAULT_ENGINE_OPTIONS_PING_TIMEOUT, "how long to wait for a client to answer a ping (in ms)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.IdleTimeout, "idle-timeout", "", config.DEFAULT_IDLE_TIMEOUT, "close connections that have not sent a message in this long (in ms, 0 disables)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.AuthMaxClockSkew, "auth-max-clock-skew", "", config.DEFAULT_AUTH_MAX_CLOCK_SKEW, "how far (in ms) the timestamp of a client's signature may differ from the server's clock")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.MessageSigning, "message-signing", "", config.DEFAULT_MESSAGE_SIGNING, "whether messages must be signed with the client key: required, optional or off")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.AuthorizedKeysFile, "authorized-keys-file", "", config.DEFAULT_AUTHORIZED_KEYS_FILE, "an OpenSSH authorized_keys file of client keys (used alongside cert-dir)")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.RevokedKeysFile, "revoked-keys-file", "", config.DEFAULT_REVOKED_KEYS_FILE, "a file of revoked client key names or fingerprints (one per line)")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.KeyValidityFile, "key-validity-file", "", config.DEFAULT_KEY_VALIDITY_FILE, "a json file of notBefore/notAfter times by client key name or fingerprint")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.SshCaFile, "ssh-ca-file", "", config.DEFAULT_SSH_CA_FILE, "a file of SSH certificate authority public keys (authorized_keys format) whose user certificates are trusted")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.X509CaFile, "x509-ca-file", "", config.DEFAULT_X509_CA_FILE, "a PEM file of X.509 certificate authorities whose client certificates are trusted")
+	cliRootCmd.PersistentFlags().StringSliceVarP(&sshCertPrincipalsFlag, "ssh-cert-principals", "", nil, "the only principals that SSH certificates are accepted for (default: any principal of the certificate)")
+	cliRootCmd.PersistentFlags().StringSliceVarP(&sshCertExtensionsFlag, "ssh-cert-extensions", "", nil, "the extensions that SSH certificates must have to be accepted")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.AuthMode, "auth-mode", "", config.DEFAULT_AUTH_MODE, "how clients authenticate: signature (the Authorization header), mtls (a TLS client certificate) or both")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.TlsClientCaFile, "tls-client-ca-file", "", config.DEFAULT_TLS_CLIENT_CA_FILE, "a PEM file of certificate authorities whose TLS client certificates are accepted")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.TlsExpiryWarning, "tls-expiry-warning", "", config.DEFAULT_TLS_EXPIRY_WARNING, "warn when the TLS certificate expires within this many days")
+	cliRootCmd.PersistentFlags().BoolVarP(&cliConf.TlsSelfSigned, "tls-self-signed", "", config.DEFAULT_TLS_SELF_SIGNED, "generate a self-signed TLS key pair in tlsCertFile and tlsKeyFile when they do not exist")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.UnixSocket, "unix-socket", "", config.DEFAULT_UNIX_SOCKET, "also listen on this unix socket (clients are identified by their peer credentials)")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.UnixSocketMode, "unix-socket-mode", "", config.DEFAULT_UNIX_SOCKET_MODE, "the file permissions of the unix socket (octal)")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.UnixSocketGroup, "unix-socket-group", "", config.DEFAULT_UNIX_SOCKET_GROUP, "the group (name or id) that owns the unix socket")
+	cliRootCmd.PersistentFlags().StringSliceVarP(&unixSocketAllowFlag, "unix-socket-allow", "", nil, "the users (name or uid) and groups (@name or @gid) allowed to connect to the unix sockets (default: nobody)")
+	cliRootCmd.PersistentFlags().StringSliceVarP(&cliConf.Listen, "listen", "", nil, "listen on these addresses (host:port, unix://<path>, systemd or systemd:<name>) instead of host:port and unix-socket")
+	cliRootCmd.PersistentFlags().StringSliceVarP(&allowedOriginsFlag, "allowed-origins", "", nil, "the origins (ex: https://console.example.com or https://*.example.com) allowed to connect from a browser besides the server's own")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.AdminSocket, "admin-socket", "", config.DEFAULT_ADMIN_SOCKET, "the path of the unix socket of the local admin API (disabled when empty)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.MaxConnections, "max-connections", "", config.DEFAULT_MAX_CONNECTIONS, "the maximum number of websocket connections (0 for no limit)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.MaxIpConnections, "max-ip-connections", "", config.DEFAULT_MAX_IP_CONNECTIONS, "the maximum number of websocket connections from one IP address (0 for no limit)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.IpMessageRate, "ip-message-rate", "", config.DEFAULT_IP_MESSAGE_RATE, "the number of connection attempts and messages per minute allowed from one IP address (0 for no limit)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.KeyMessageRate, "key-message-rate", "", config.DEFAULT_KEY_MESSAGE_RATE, "the number of messages per minute allowed from one client key (0 for no limit)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.MessageBurst, "message-burst", "", config.DEFAULT_MESSAGE_BURST, "how many messages above ip-message-rate and key-message-rate can be sent at once")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.AuthFailureLimit, "auth-failure-limit", "", config.DEFAULT_AUTH_FAILURE_LIMIT, "lock out an IP address after this many consecutive authentication failures (0 disables the lockout)")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.AuthLockout, "auth-lockout", "", config.DEFAULT_AUTH_LOCKOUT, "how long (in ms) an IP address is first locked out for, doubling with each further failure")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.AuthLockoutMax, "auth-lockout-max", "", config.DEFAULT_AUTH_LOCKOUT_MAX, "the longest (in ms) that an IP address is locked out for")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.MaxMessageSize, "max-message-size", "", config.DEFAULT_MAX_MESSAGE_SIZE, "the maximum size (in bytes) of a websocket message (0 for no limit)")
+	cliRootCmd.PersistentFlags().BoolVarP(&cliConf.Cors, "cors", "", config.DEFAULT_CORS, "answer CORS requests from allowed-origins on the health, readiness and metrics endpoints and /v1/exec")
+	cliRootCmd.PersistentFlags().StringVarP(&cliConf.GrpcHost, "grpc-host", "", config.DEFAULT_GRPC_HOST, "the interface to bind the gRPC listener to")
+	cliRootCmd.PersistentFlags().IntVarP(&cliConf.GrpcPort, "grpc-port", "", config.DEFAULT_GRPC_PORT, "serve the gRPC API on this port (0 disables it)")
+	cliRootCmd.PersistentFlags().StringSliceVarP(&serverNamesFlag, "server-names", "", nil, "the names (ex: host name, FQDN or IP address) that clients connect to the server by, which their Authorization headers must be bound to")
+	cliRootCmd.PersistentFlags().BoolVarP(&cliConf.AllowUnboundSignatures, "allow-unbound-signatures", "", config.DEFAULT_ALLOW_UNBOUND_SIGNATURES, "accept the Authorization headers of older clients, which are not bound to a server, when server-names is set")
 
 	// Default configuration settings
 	viper.SetDefault("configFile", DEFAULT_CLI_CONF_CONFIG_FILE)
@@ -76,6 +214,45 @@ func init() {
 	viper.SetDefault("tlsKeyFile", config.DEFAULT_TLS_KEY_FILE)
 	viper.SetDefault("tlsCertFile", config.DEFAULT_TLS_CERT_FILE)
 	viper.SetDefault("logLevel", config.DEFAULT_LOG_LEVEL)
+	viper.SetDefault("factsDir", config.DEFAULT_FACTS_DIR)
+	viper.SetDefault("healthPath", config.DEFAULT_HEALTH_PATH)
+	viper.SetDefault("readyPath", config.DEFAULT_READY_PATH)
+	viper.SetDefault("healthHost", config.DEFAULT_HEALTH_HOST)
+	viper.SetDefault("healthPort", config.DEFAULT_HEALTH_PORT)
+	viper.SetDefault("metricsPath", config.DEFAULT_METRICS_PATH)
+	viper.SetDefault("metricsHost", config.DEFAULT_METRICS_HOST)
+	viper.SetDefault("metricsPort", config.DEFAULT_METRICS_PORT)
+	viper.SetDefault("pingInterval", config.DEFAULT_ENGINE_OPTIONS_PING_INTERVAL)
+	viper.SetDefault("pingTimeout", config.DEFAULT_ENGINE_OPTIONS_PING_TIMEOUT)
+	viper.SetDefault("idleTimeout", config.DEFAULT_IDLE_TIMEOUT)
+	viper.SetDefault("authMaxClockSkew", config.DEFAULT_AUTH_MAX_CLOCK_SKEW)
+	viper.SetDefault("messageSigning", config.DEFAULT_MESSAGE_SIGNING)
+	viper.SetDefault("authorizedKeysFile", config.DEFAULT_AUTHORIZED_KEYS_FILE)
+	viper.SetDefault("revokedKeysFile", config.DEFAULT_REVOKED_KEYS_FILE)
+	viper.SetDefault("keyValidityFile", config.DEFAULT_KEY_VALIDITY_FILE)
+	viper.SetDefault("sshCaFile", config.DEFAULT_SSH_CA_FILE)
+	viper.SetDefault("x509CaFile", config.DEFAULT_X509_CA_FILE)
+	viper.SetDefault("authMode", config.DEFAULT_AUTH_MODE)
+	viper.SetDefault("tlsClientCaFile", config.DEFAULT_TLS_CLIENT_CA_FILE)
+	viper.SetDefault("tlsExpiryWarning", config.DEFAULT_TLS_EXPIRY_WARNING)
+	viper.SetDefault("tlsSelfSigned", config.DEFAULT_TLS_SELF_SIGNED)
+	viper.SetDefault("unixSocket", config.DEFAULT_UNIX_SOCKET)
+	viper.SetDefault("unixSocketMode", config.DEFAULT_UNIX_SOCKET_MODE)
+	viper.SetDefault("unixSocketGroup", config.DEFAULT_UNIX_SOCKET_GROUP)
+	viper.SetDefault("adminSocket", config.DEFAULT_ADMIN_SOCKET)
+	viper.SetDefault("maxConnections", config.DEFAULT_MAX_CONNECTIONS)
+	viper.SetDefault("maxIpConnections", config.DEFAULT_MAX_IP_CONNECTIONS)
+	viper.SetDefault("ipMessageRate", config.DEFAULT_IP_MESSAGE_RATE)
+	viper.SetDefault("keyMessageRate", config.DEFAULT_KEY_MESSAGE_RATE)
+	viper.SetDefault("messageBurst", config.DEFAULT_MESSAGE_BURST)
+	viper.SetDefault("authFailureLimit", config.DEFAULT_AUTH_FAILURE_LIMIT)
+	viper.SetDefault("authLockout", config.DEFAULT_AUTH_LOCKOUT)
+	viper.SetDefault("authLockoutMax", config.DEFAULT_AUTH_LOCKOUT_MAX)
+	viper.SetDefault("maxMessageSize", config.DEFAULT_MAX_MESSAGE_SIZE)
+	viper.SetDefault("cors", config.DEFAULT_CORS)
+	viper.SetDefault("grpcHost", config.DEFAULT_GRPC_HOST)
+	viper.SetDefault("grpcPort", config.DEFAULT_GRPC_PORT)
+	viper.SetDefault("allowUnboundSignatures", config.DEFAULT_ALLOW_UNBOUND_SIGNATURES)
 
 	// Environment Variables
 	viper.SetEnvPrefix("RC")
@@ -88,6 +265,51 @@ func init() {
 	_ = viper.BindEnv("tlsKey")
 	_ = viper.BindEnv("tlsCertFile")
 	_ = viper.BindEnv("ciphersFile")
+	_ = viper.BindEnv("factsDir")
+	_ = viper.BindEnv("healthPath")
+	_ = viper.BindEnv("readyPath")
+	_ = viper.BindEnv("healthHost")
+	_ = viper.BindEnv("healthPort")
+	_ = viper.BindEnv("metricsPath")
+	_ = viper.BindEnv("metricsHost")
+	_ = viper.BindEnv("metricsPort")
+	_ = viper.BindEnv("pingInterval")
+	_ = viper.BindEnv("pingTimeout")
+	_ = viper.BindEnv("idleTimeout")
+	_ = viper.BindEnv("authMaxClockSkew")
+	_ = viper.BindEnv("messageSigning")
+	_ = viper.BindEnv("authorizedKeysFile")
+	_ = viper.BindEnv("revokedKeysFile")
+	_ = viper.BindEnv("keyValidityFile")
+	_ = viper.BindEnv("sshCaFile")
+	_ = viper.BindEnv("x509CaFile")
+	_ = viper.BindEnv("authMode")
+	_ = viper.BindEnv("tlsClientCaFile")
+	_ = viper.BindEnv("tlsExpiryWarning")
+	_ = viper.BindEnv("tlsSelfSigned")
+	_ = viper.BindEnv("unixSocket")
+	_ = viper.BindEnv("unixSocketMode")
+	_ = viper.BindEnv("unixSocketGroup")
+	_ = viper.BindEnv("listen")
+	_ = viper.BindEnv("allowedOrigins")
+	_ = viper.BindEnv("adminSocket")
+	_ = viper.BindEnv("maxConnections")
+	_ = viper.BindEnv("maxIpConnections")
+	_ = viper.BindEnv("ipMessageRate")
+	_ = viper.BindEnv("keyMessageRate")
+	_ = viper.BindEnv("messageBurst")
+	_ = viper.BindEnv("authFailureLimit")
+	_ = viper.BindEnv("authLockout")
+	_ = viper.BindEnv("authLockoutMax")
+	_ = viper.BindEnv("maxMessageSize")
+	_ = viper.BindEnv("cors")
+	_ = viper.BindEnv("grpcHost")
+	_ = viper.BindEnv("grpcPort")
+	_ = viper.BindEnv("serverNames")
+	_ = viper.BindEnv("unixSocketAllow")
+	_ = viper.BindEnv("sshCertPrincipals")
+	_ = viper.BindEnv("sshCertExtensions")
+	_ = viper.BindEnv("allowUnboundSignatures")
 
 	// Flags
 	_ = viper.BindPFlag("configFile", cliRootCmd.PersistentFlags().Lookup("config-file"))
@@ -99,30 +321,62 @@ func init() {
 	_ = viper.BindPFlag("tlsKeyFile", cliRootCmd.PersistentFlags().Lookup("tls-key-file"))
 	_ = viper.BindPFlag("tlsCertFile", cliRootCmd.PersistentFlags().Lookup("tls-cert-file"))
 	_ = viper.BindPFlag("ciphers", cliRootCmd.PersistentFlags().Lookup("ciphers"))
+	_ = viper.BindPFlag("factsDir", cliRootCmd.PersistentFlags().Lookup("facts-dir"))
+	_ = viper.BindPFlag("healthPath", cliRootCmd.PersistentFlags().Lookup("health-path"))
+	_ = viper.BindPFlag("readyPath", cliRootCmd.PersistentFlags().Lookup("ready-path"))
+	_ = viper.BindPFlag("healthHost", cliRootCmd.PersistentFlags().Lookup("health-host"))
+	_ = viper.BindPFlag("healthPort", cliRootCmd.PersistentFlags().Lookup("health-port"))
+	_ = viper.BindPFlag("metricsPath", cliRootCmd.PersistentFlags().Lookup("metrics-path"))
+	_ = viper.BindPFlag("metricsHost", cliRootCmd.PersistentFlags().Lookup("metrics-host"))
+	_ = viper.BindPFlag("metricsPort", cliRootCmd.PersistentFlags().Lookup("metrics-port"))
+	_ = viper.BindPFlag("pingInterval", cliRootCmd.PersistentFlags().Lookup("ping-interval"))
+	_ = viper.BindPFlag("pingTimeout", cliRootCmd.PersistentFlags().Lookup("ping-timeout"))
+	_ = viper.BindPFlag("idleTimeout", cliRootCmd.PersistentFlags().Lookup("idle-timeout"))
+	_ = viper.BindPFlag("authMaxClockSkew", cliRootCmd.PersistentFlags().Lookup("auth-max-clock-skew"))
+	_ = viper.BindPFlag("messageSigning", cliRootCmd.PersistentFlags().Lookup("message-signing"))
+	_ = viper.BindPFlag("authorizedKeysFile", cliRootCmd.PersistentFlags().Lookup("authorized-keys-file"))
+	_ = viper.BindPFlag("revokedKeysFile", cliRootCmd.PersistentFlags().Lookup("revoked-keys-file"))
+	_ = viper.BindPFlag("keyValidityFile", cliRootCmd.PersistentFlags().Lookup("key-validity-file"))
+	_ = viper.BindPFlag("sshCaFile", cliRootCmd.PersistentFlags().Lookup("ssh-ca-file"))
+	_ = viper.BindPFlag("x509CaFile", cliRootCmd.PersistentFlags().Lookup("x509-ca-file"))
+	_ = viper.BindPFlag("authMode", cliRootCmd.PersistentFlags().Lookup("auth-mode"))
+	_ = viper.BindPFlag("tlsClientCaFile", cliRootCmd.PersistentFlags().Lookup("tls-client-ca-file"))
+	_ = viper.BindPFlag("tlsExpiryWarning", cliRootCmd.PersistentFlags().Lookup("tls-expiry-warning"))
+	_ = viper.BindPFlag("tlsSelfSigned", cliRootCmd.PersistentFlags().Lookup("tls-self-signed"))
+	_ = viper.BindPFlag("unixSocket", cliRootCmd.PersistentFlags().Lookup("unix-socket"))
+	_ = viper.BindPFlag("unixSocketMode", cliRootCmd.PersistentFlags().Lookup("unix-socket-mode"))
+	_ = viper.BindPFlag("unixSocketGroup", cliRootCmd.PersistentFlags().Lookup("unix-socket-group"))
+	_ = viper.BindPFlag("listen", cliRootCmd.PersistentFlags().Lookup("listen"))
+	_ = viper.BindPFlag("allowedOrigins", cliRootCmd.PersistentFlags().Lookup("allowed-origins"))
+	_ = viper.BindPFlag("adminSocket", cliRootCmd.PersistentFlags().Lookup("admin-socket"))
+	_ = viper.BindPFlag("maxConnections", cliRootCmd.PersistentFlags().Lookup("max-connections"))
+	_ = viper.BindPFlag("maxIpConnections", cliRootCmd.PersistentFlags().Lookup("max-ip-connections"))
+	_ = viper.BindPFlag("ipMessageRate", cliRootCmd.PersistentFlags().Lookup("ip-message-rate"))
+	_ = viper.BindPFlag("keyMessageRate", cliRootCmd.PersistentFlags().Lookup("key-message-rate"))
+	_ = viper.BindPFlag("messageBurst", cliRootCmd.PersistentFlags().Lookup("message-burst"))
+	_ = viper.BindPFlag("authFailureLimit", cliRootCmd.PersistentFlags().Lookup("auth-failure-limit"))
+	_ = viper.BindPFlag("authLockout", cliRootCmd.PersistentFlags().Lookup("auth-lockout"))
+	_ = viper.BindPFlag("authLockoutMax", cliRootCmd.PersistentFlags().Lookup("auth-lockout-max"))
+	_ = viper.BindPFlag("maxMessageSize", cliRootCmd.PersistentFlags().Lookup("max-message-size"))
+	_ = viper.BindPFlag("cors", cliRootCmd.PersistentFlags().Lookup("cors"))
+	_ = viper.BindPFlag("grpcHost", cliRootCmd.PersistentFlags().Lookup("grpc-host"))
+	_ = viper.BindPFlag("grpcPort", cliRootCmd.PersistentFlags().Lookup("grpc-port"))
+	_ = viper.BindPFlag("serverNames", cliRootCmd.PersistentFlags().Lookup("server-names"))
+	_ = viper.BindPFlag("unixSocketAllow", cliRootCmd.PersistentFlags().Lookup("unix-socket-allow"))
+	_ = viper.BindPFlag("sshCertPrincipals", cliRootCmd.PersistentFlags().Lookup("ssh-cert-principals"))
+	_ = viper.BindPFlag("sshCertExtensions", cliRootCmd.PersistentFlags().Lookup("ssh-cert-extensions"))
+	_ = viper.BindPFlag("allowUnboundSignatures", cliRootCmd.PersistentFlags().Lookup("allow-unbound-signatures"))
 
 	// Config File
 	viper.SetConfigType("json")
 }
 
 func initializeConfig() error {
-	// update the config struct
-	if err := updateConfig(); err != nil {
+	if err := loadConfig(); err != nil {
 		return err
 	}
 
 	if cliConf.ConfigFile != "" {
-		// read config file
-		viper.SetConfigFile(cliConf.ConfigFile)
-
-		if err := viper.ReadInConfig(); err != nil {
-			return err
-		}
-
-		// update the config struct
-		if err := updateConfig(); err != nil {
-			return err
-		}
-
 		// watch for changes in the config file
 		viper.OnConfigChange(func(e fsnotify.Event) {
 			_, _ = os.Stdout.WriteString("Config file changed: " + e.Name + "\n")
@@ -144,6 +398,28 @@ func initializeConfig() error {
 	return err
 }
 
+// loadConfig reads the flags, environment variables and config file into the config structs
+func loadConfig() error {
+	// update the config struct
+	if err := updateConfig(); err != nil {
+		return err
+	}
+
+	if cliConf.ConfigFile == "" {
+		return nil
+	}
+
+	// read config file
+	viper.SetConfigFile(cliConf.ConfigFile)
+
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+
+	// update the config struct
+	return updateConfig()
+}
+
 func reloadConfig() {
 	log := logger.GetLogger()
 	defer log.Sync()
@@ -183,6 +459,15 @@ func reloadConfig() {
 }
 
 func updateConfig() error {
+	// lists are decoded into the existing ones, which would keep the entries that have been removed from the config
+	// file (the --listen flag holds its own value)
+	cliConf.Listeners = nil
+	cliConf.AllowedOrigins = nil
+	cliConf.ServerNames = nil
+	cliConf.UnixSocketAllow = nil
+	cliConf.SshCertPrincipals = nil
+	cliConf.SshCertExtensions = nil
+
 	return viper.Unmarshal(&cliConf)
 }
 
@@ -4,23 +4,103 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
 	"github.com/cthayer/remote_control/internal/config"
 )
 
 func TestCliConf(t *testing.T) {
 	want := cliConfig{
-		ConfigFile:  DEFAULT_CLI_CONF_CONFIG_FILE,
-		Port:        config.DEFAULT_PORT,
-		CertDir:     config.DEFAULT_CERT_DIR,
-		Ciphers:     config.DEFAULT_CIPHERS,
-		LogLevel:    config.DEFAULT_LOG_LEVEL,
-		Host:        config.DEFAULT_HOST,
-		PidFile:     DEFAULT_CLI_CONF_PID_FILE,
-		TlsKeyFile:  config.DEFAULT_TLS_KEY_FILE,
-		TlsCertFile: config.DEFAULT_TLS_CERT_FILE,
+		ConfigFile:             DEFAULT_CLI_CONF_CONFIG_FILE,
+		Port:                   config.DEFAULT_PORT,
+		CertDir:                config.DEFAULT_CERT_DIR,
+		Ciphers:                config.DEFAULT_CIPHERS,
+		LogLevel:               config.DEFAULT_LOG_LEVEL,
+		Host:                   config.DEFAULT_HOST,
+		PidFile:                DEFAULT_CLI_CONF_PID_FILE,
+		TlsKeyFile:             config.DEFAULT_TLS_KEY_FILE,
+		TlsCertFile:            config.DEFAULT_TLS_CERT_FILE,
+		FactsDir:               config.DEFAULT_FACTS_DIR,
+		HealthPath:             config.DEFAULT_HEALTH_PATH,
+		ReadyPath:              config.DEFAULT_READY_PATH,
+		HealthHost:             config.DEFAULT_HEALTH_HOST,
+		HealthPort:             config.DEFAULT_HEALTH_PORT,
+		MetricsPath:            config.DEFAULT_METRICS_PATH,
+		MetricsHost:            config.DEFAULT_METRICS_HOST,
+		MetricsPort:            config.DEFAULT_METRICS_PORT,
+		PingInterval:           config.DEFAULT_ENGINE_OPTIONS_PING_INTERVAL,
+		PingTimeout:            config.DEFAULT_ENGINE_OPTIONS_PING_TIMEOUT,
+		IdleTimeout:            config.DEFAULT_IDLE_TIMEOUT,
+		AuthMaxClockSkew:       config.DEFAULT_AUTH_MAX_CLOCK_SKEW,
+		MessageSigning:         config.DEFAULT_MESSAGE_SIGNING,
+		AuthorizedKeysFile:     config.DEFAULT_AUTHORIZED_KEYS_FILE,
+		RevokedKeysFile:        config.DEFAULT_REVOKED_KEYS_FILE,
+		KeyValidityFile:        config.DEFAULT_KEY_VALIDITY_FILE,
+		SshCaFile:              config.DEFAULT_SSH_CA_FILE,
+		X509CaFile:             config.DEFAULT_X509_CA_FILE,
+		AuthMode:               config.DEFAULT_AUTH_MODE,
+		TlsClientCaFile:        config.DEFAULT_TLS_CLIENT_CA_FILE,
+		TlsExpiryWarning:       config.DEFAULT_TLS_EXPIRY_WARNING,
+		TlsSelfSigned:          config.DEFAULT_TLS_SELF_SIGNED,
+		UnixSocket:             config.DEFAULT_UNIX_SOCKET,
+		UnixSocketMode:         config.DEFAULT_UNIX_SOCKET_MODE,
+		UnixSocketGroup:        config.DEFAULT_UNIX_SOCKET_GROUP,
+		AdminSocket:            config.DEFAULT_ADMIN_SOCKET,
+		MaxConnections:         config.DEFAULT_MAX_CONNECTIONS,
+		MaxIpConnections:       config.DEFAULT_MAX_IP_CONNECTIONS,
+		IpMessageRate:          config.DEFAULT_IP_MESSAGE_RATE,
+		KeyMessageRate:         config.DEFAULT_KEY_MESSAGE_RATE,
+		MessageBurst:           config.DEFAULT_MESSAGE_BURST,
+		AuthFailureLimit:       config.DEFAULT_AUTH_FAILURE_LIMIT,
+		AuthLockout:            config.DEFAULT_AUTH_LOCKOUT,
+		AuthLockoutMax:         config.DEFAULT_AUTH_LOCKOUT_MAX,
+		MaxMessageSize:         config.DEFAULT_MAX_MESSAGE_SIZE,
+		Cors:                   config.DEFAULT_CORS,
+		GrpcHost:               config.DEFAULT_GRPC_HOST,
+		GrpcPort:               config.DEFAULT_GRPC_PORT,
+		AllowUnboundSignatures: config.DEFAULT_ALLOW_UNBOUND_SIGNATURES,
 	}
 
 	if !reflect.DeepEqual(cliConf, want) {
 		t.Errorf("GetConfig() = %v, wanted %v", cliConf, want)
 	}
 }
+
+func TestListenerConfigs(t *testing.T) {
+	// the flags, viper and cliConf are global: restore them for the other tests
+	flag := cliRootCmd.PersistentFlags().Lookup("listen")
+	savedListen := flag.Value.(pflag.SliceValue).GetSlice()
+	savedChanged := flag.Changed
+	savedListeners := viper.Get("listeners")
+	savedConf := cliConf
+
+	defer func() {
+		_ = flag.Value.(pflag.SliceValue).Replace(savedListen)
+		flag.Changed = savedChanged
+
+		viper.Set("listeners", savedListeners)
+		cliConf = savedConf
+	}()
+
+	viper.Set("listeners", []map[string]interface{}{
+		{"address": "127.0.0.1:4515", "tlsCertFile": "/etc/rc/server.pem", "tlsKeyFile": "/etc/rc/server-key.pem"},
+	})
+
+	if err := cliRootCmd.PersistentFlags().Set("listen", "unix:///run/rc.sock"); err != nil {
+		t.Fatalf("Error setting --listen: %v", err)
+	}
+
+	if err := updateConfig(); err != nil {
+		t.Fatalf("updateConfig() error = %v", err)
+	}
+
+	want := []config.Listener{
+		{Address: "127.0.0.1:4515", TlsCertFile: "/etc/rc/server.pem", TlsKeyFile: "/etc/rc/server-key.pem"},
+		{Address: "unix:///run/rc.sock"},
+	}
+
+	if got := listenerConfigs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("listenerConfigs() = %v, wanted %v", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/internal/handover"
+	"github.com/cthayer/remote_control/internal/logger"
+	"github.com/cthayer/remote_control/internal/server"
+)
+
+var (
+	// set once the sockets have been handed over to a new process
+	handedOver = false
+)
+
+// handoverServer starts the executable (which may have been upgraded since this process started) with the same
+// arguments and hands the listening sockets of srv over to it.  This process can stop once it returns.
+func handoverServer(srv server.Server) error {
+	log := logger.GetLogger()
+
+	executable, err := os.Executable()
+
+	if err != nil {
+		return err
+	}
+
+	files, addresses, err := srv.ListenerFiles()
+
+	if err != nil {
+		return err
+	}
+
+	// the new process has its own copies
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	log.Info("Handing over to a new process", zap.String("executable", executable), zap.Strings("addresses", addresses))
+
+	process, err := handover.Start(executable, os.Args[1:], files, addresses, SERVER_START_TIMEOUT*time.Second)
+
+	if err != nil {
+		return err
+	}
+
+	// the socket files belong to the new process now
+	srv.KeepSocketFiles()
+
+	log.Info("New process is ready, stopping this one", zap.Int("pid", process.Pid))
+
+	return nil
+}
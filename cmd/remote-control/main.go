@@ -11,8 +11,10 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/internal/handover"
 	"github.com/cthayer/remote_control/internal/logger"
 	"github.com/cthayer/remote_control/internal/server"
+	"github.com/cthayer/remote_control/internal/systemd"
 )
 
 const (
@@ -85,14 +87,31 @@ func runServer() {
 		return
 	}
 
+	if handover.Inherited() {
+		// take over as the main process of the service from the process that started this one
+		notifySystemd(systemd.STATE_MAINPID + strconv.Itoa(os.Getpid()))
+	}
+
+	notifySystemd(systemd.STATE_READY)
+
+	// let the process that handed its sockets over stop
+	if err := handover.Ready(); err != nil {
+		log.Error("Failed to tell the previous process that the server is ready", zap.Error(err))
+	}
+
 	// setup OS signal handler
-	done := setupSignalHandler()
+	done := setupSignalHandler(srv)
 
-	// wait until signaled to exit (SIGINT or SIGTERM) -- SIGHUP to reload config
+	// wait until signaled to exit (SIGINT or SIGTERM) -- SIGHUP to reload config, SIGUSR1 to drain, SIGUSR2 to hand over
 	<-done
 
 	log.Info("Shutting down")
 
+	// the new process is the main process of the service after a handover
+	if !handedOver {
+		notifySystemd(systemd.STATE_STOPPING)
+	}
+
 	// stop the server
 	errChan = srv.Stop()
 
@@ -120,9 +139,66 @@ func updateServerConfig(conf *config.Config) {
 	conf.LogLevel = cliConf.LogLevel
 	conf.TlsKeyFile = cliConf.TlsKeyFile
 	conf.TlsCertFile = cliConf.TlsCertFile
+	conf.FactsDir = cliConf.FactsDir
+	conf.Version = VERSION
+	conf.HealthPath = cliConf.HealthPath
+	conf.ReadyPath = cliConf.ReadyPath
+	conf.HealthHost = cliConf.HealthHost
+	conf.HealthPort = cliConf.HealthPort
+	conf.MetricsPath = cliConf.MetricsPath
+	conf.MetricsHost = cliConf.MetricsHost
+	conf.MetricsPort = cliConf.MetricsPort
+	conf.EngineOptions.PingInterval = cliConf.PingInterval
+	conf.EngineOptions.PingTimeout = cliConf.PingTimeout
+	conf.IdleTimeout = cliConf.IdleTimeout
+	conf.AuthMaxClockSkew = cliConf.AuthMaxClockSkew
+	conf.MessageSigning = cliConf.MessageSigning
+	conf.AuthorizedKeysFile = cliConf.AuthorizedKeysFile
+	conf.RevokedKeysFile = cliConf.RevokedKeysFile
+	conf.KeyValidityFile = cliConf.KeyValidityFile
+	conf.SshCaFile = cliConf.SshCaFile
+	conf.X509CaFile = cliConf.X509CaFile
+	conf.AuthMode = cliConf.AuthMode
+	conf.TlsClientCaFile = cliConf.TlsClientCaFile
+	conf.TlsExpiryWarning = cliConf.TlsExpiryWarning
+	conf.TlsSelfSigned = cliConf.TlsSelfSigned
+	conf.UnixSocket = cliConf.UnixSocket
+	conf.UnixSocketMode = cliConf.UnixSocketMode
+	conf.UnixSocketGroup = cliConf.UnixSocketGroup
+	conf.Listeners = listenerConfigs()
+	conf.AdminSocket = cliConf.AdminSocket
+	conf.MaxConnections = cliConf.MaxConnections
+	conf.MaxIpConnections = cliConf.MaxIpConnections
+	conf.IpMessageRate = cliConf.IpMessageRate
+	conf.KeyMessageRate = cliConf.KeyMessageRate
+	conf.MessageBurst = cliConf.MessageBurst
+	conf.AuthFailureLimit = cliConf.AuthFailureLimit
+	conf.AuthLockout = cliConf.AuthLockout
+	conf.AuthLockoutMax = cliConf.AuthLockoutMax
+	conf.MaxMessageSize = cliConf.MaxMessageSize
+	conf.AllowedOrigins = cliConf.AllowedOrigins
+	conf.Cors = cliConf.Cors
+	conf.GrpcHost = cliConf.GrpcHost
+	conf.GrpcPort = cliConf.GrpcPort
+	conf.ServerNames = cliConf.ServerNames
+	conf.UnixSocketAllow = cliConf.UnixSocketAllow
+	conf.SshCertPrincipals = cliConf.SshCertPrincipals
+	conf.SshCertExtensions = cliConf.SshCertExtensions
+	conf.AllowUnboundSignatures = cliConf.AllowUnboundSignatures
+}
+
+// listenerConfigs returns the listeners of the config file followed by the addresses of --listen
+func listenerConfigs() []config.Listener {
+	listeners := append([]config.Listener{}, cliConf.Listeners...)
+
+	for _, address := range cliConf.Listen {
+		listeners = append(listeners, config.Listener{Address: address})
+	}
+
+	return listeners
 }
 
-func setupSignalHandler() chan bool {
+func setupSignalHandler(srv server.Server) chan bool {
 	log := logger.GetLogger()
 
 	sigs := make(chan os.Signal, 1)
@@ -130,6 +206,11 @@ func setupSignalHandler() chan bool {
 
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
+	// without any signals, Notify would relay all of them
+	if extraSignals := append(append([]os.Signal{}, drainSignals...), handoverSignals...); len(extraSignals) > 0 {
+		signal.Notify(sigs, extraSignals...)
+	}
+
 	go func() {
 		defer close(done)
 
@@ -142,7 +223,23 @@ func setupSignalHandler() chan bool {
 			case syscall.SIGINT, syscall.SIGTERM:
 				done <- true
 			case syscall.SIGHUP:
+				notifySystemd(systemd.STATE_RELOADING)
 				reloadConfig()
+				notifySystemd(systemd.STATE_READY)
+			default:
+				if containsSignal(drainSignals, sig) {
+					srv.Drain()
+				}
+
+				if containsSignal(handoverSignals, sig) {
+					if err := handoverServer(srv); err != nil {
+						log.Error("Failed to hand over to a new process, keeping this one", zap.Error(err))
+						continue
+					}
+
+					handedOver = true
+					done <- true
+				}
 			}
 		}
 	}()
@@ -150,6 +247,23 @@ func setupSignalHandler() chan bool {
 	return done
 }
 
+func containsSignal(signals []os.Signal, sig os.Signal) bool {
+	for _, s := range signals {
+		if s == sig {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notifySystemd tells systemd about the state of the server when it runs as a `Type=notify` service
+func notifySystemd(state string) {
+	if err := systemd.Notify(state); err != nil {
+		logger.GetLogger().Warn("Failed to notify systemd", zap.Error(err), zap.String("state", state))
+	}
+}
+
 func writePidFile() error {
 	return ioutil.WriteFile(cliConf.PidFile, []byte(strconv.Itoa(os.Getpid())), 0644)
 }
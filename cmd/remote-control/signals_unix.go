@@ -0,0 +1,15 @@
+//+build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// drainSignals make the server drain (stop taking new commands) without exiting
+	drainSignals = []os.Signal{syscall.SIGUSR1}
+	// handoverSignals make the server hand its sockets over to a new process (ex: after an upgrade) and exit
+	handoverSignals = []os.Signal{syscall.SIGUSR2}
+)
@@ -0,0 +1,13 @@
+//+build windows
+
+package main
+
+import (
+	"os"
+)
+
+var (
+	// there are no signals to drain the server or hand it over on windows
+	drainSignals    []os.Signal
+	handoverSignals []os.Signal
+)
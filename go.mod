@@ -5,15 +5,21 @@ go 1.14
 require (
 	github.com/cthayer/go-rc-protocol v0.1.3
 	github.com/fsnotify/fsnotify v1.4.9
+	github.com/golang/protobuf v1.4.2
 	github.com/gookit/color v1.2.5
 	github.com/gorilla/mux v1.7.4
 	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/go-multierror v1.1.0
 	github.com/magefile/mage v1.9.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.7.1
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.6.2
 	go.uber.org/zap v1.14.1
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
 	golang.org/x/tools v0.0.0-20191029190741-b9c20aec41a5
+	google.golang.org/grpc v1.30.0
+	google.golang.org/protobuf v1.23.0
 )
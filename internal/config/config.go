@@ -1,13 +1,73 @@
 package config
 
 type Config struct {
-	Port        int    `json:"port"`
-	Host        string `json:"host"`
-	CertDir     string `json:"certDir"`
-	Ciphers     string `json:"ciphers"`
-	LogLevel    string `json:"logLevel"`
-	TlsCertFile string `json:"tlsCertFile"`
-	TlsKeyFile  string `json:"tlsKeyFile"`
+	Port                   int           `json:"port"`
+	Host                   string        `json:"host"`
+	CertDir                string        `json:"certDir"`
+	Ciphers                string        `json:"ciphers"`
+	LogLevel               string        `json:"logLevel"`
+	TlsCertFile            string        `json:"tlsCertFile"`
+	TlsKeyFile             string        `json:"tlsKeyFile"`
+	FactsDir               string        `json:"factsDir"`
+	HealthPath             string        `json:"healthPath"`
+	ReadyPath              string        `json:"readyPath"`
+	HealthHost             string        `json:"healthHost"`
+	HealthPort             int           `json:"healthPort"`
+	Version                string        `json:"-"`
+	MetricsPath            string        `json:"metricsPath"`
+	MetricsHost            string        `json:"metricsHost"`
+	MetricsPort            int           `json:"metricsPort"`
+	EngineOptions          EngineOptions `json:"engineOptions"`
+	IdleTimeout            int           `json:"idleTimeout"`
+	AuthMaxClockSkew       int           `json:"authMaxClockSkew"`
+	MessageSigning         string        `json:"messageSigning"`
+	AuthorizedKeysFile     string        `json:"authorizedKeysFile"`
+	RevokedKeysFile        string        `json:"revokedKeysFile"`
+	KeyValidityFile        string        `json:"keyValidityFile"`
+	SshCaFile              string        `json:"sshCaFile"`
+	X509CaFile             string        `json:"x509CaFile"`
+	SshCertPrincipals      []string      `json:"sshCertPrincipals"`
+	SshCertExtensions      []string      `json:"sshCertExtensions"`
+	AuthMode               string        `json:"authMode"`
+	TlsClientCaFile        string        `json:"tlsClientCaFile"`
+	TlsExpiryWarning       int           `json:"tlsExpiryWarning"`
+	TlsSelfSigned          bool          `json:"tlsSelfSigned"`
+	UnixSocket             string        `json:"unixSocket"`
+	UnixSocketMode         string        `json:"unixSocketMode"`
+	UnixSocketGroup        string        `json:"unixSocketGroup"`
+	UnixSocketAllow        []string      `json:"unixSocketAllow"`
+	Listeners              []Listener    `json:"listeners"`
+	AdminSocket            string        `json:"adminSocket"`
+	MaxConnections         int           `json:"maxConnections"`
+	MaxIpConnections       int           `json:"maxIpConnections"`
+	IpMessageRate          int           `json:"ipMessageRate"`
+	KeyMessageRate         int           `json:"keyMessageRate"`
+	MessageBurst           int           `json:"messageBurst"`
+	AuthFailureLimit       int           `json:"authFailureLimit"`
+	AuthLockout            int           `json:"authLockout"`
+	AuthLockoutMax         int           `json:"authLockoutMax"`
+	MaxMessageSize         int           `json:"maxMessageSize"`
+	AllowedOrigins         []string      `json:"allowedOrigins"`
+	Cors                   bool          `json:"cors"`
+	GrpcHost               string        `json:"grpcHost"`
+	GrpcPort               int           `json:"grpcPort"`
+	ServerNames            []string      `json:"serverNames"`
+	AllowUnboundSignatures bool          `json:"allowUnboundSignatures"`
+}
+
+// Listener is an address that the server listens on, with its own TLS settings
+//
+// The address is `<host>:<port>`, `unix://<path>`, `systemd` (all of the sockets passed by systemd socket activation)
+// or `systemd:<name>` (the sockets named `<name>` by the FileDescriptorName of the socket unit).  TCP and systemd
+// listeners without their own key pair use tlsCertFile, tlsKeyFile and tlsClientCaFile.  Unix socket listeners only
+// use TLS when they have their own key pair.
+type Listener struct {
+	Address         string `json:"address"`
+	TlsCertFile     string `json:"tlsCertFile"`
+	TlsKeyFile      string `json:"tlsKeyFile"`
+	TlsClientCaFile string `json:"tlsClientCaFile"`
+	UnixSocketMode  string `json:"unixSocketMode"`
+	UnixSocketGroup string `json:"unixSocketGroup"`
 }
 
 type EngineOptions struct {
@@ -25,6 +85,58 @@ const (
 	DEFAULT_LOG_LEVEL                    = "info"
 	DEFAULT_TLS_KEY_FILE                 = ""
 	DEFAULT_TLS_CERT_FILE                = ""
+	DEFAULT_FACTS_DIR                    = "/etc/rc/facts.d"
+	DEFAULT_VERSION                      = "dev"
+	DEFAULT_HEALTH_PATH                  = "/healthz"
+	DEFAULT_READY_PATH                   = "/readyz"
+	DEFAULT_HEALTH_HOST                  = ""
+	DEFAULT_HEALTH_PORT                  = 0
+	DEFAULT_METRICS_PATH                 = "/metrics"
+	DEFAULT_METRICS_HOST                 = ""
+	DEFAULT_METRICS_PORT                 = 0
+	DEFAULT_IDLE_TIMEOUT                 = 0
+	DEFAULT_AUTH_MAX_CLOCK_SKEW          = 300000
+	DEFAULT_MESSAGE_SIGNING              = MESSAGE_SIGNING_OPTIONAL
+	DEFAULT_AUTHORIZED_KEYS_FILE         = ""
+	DEFAULT_REVOKED_KEYS_FILE            = ""
+	DEFAULT_KEY_VALIDITY_FILE            = ""
+	DEFAULT_SSH_CA_FILE                  = ""
+	DEFAULT_X509_CA_FILE                 = ""
+	DEFAULT_AUTH_MODE                    = AUTH_MODE_SIGNATURE
+	DEFAULT_TLS_CLIENT_CA_FILE           = ""
+	DEFAULT_TLS_EXPIRY_WARNING           = 14
+	DEFAULT_TLS_SELF_SIGNED              = false
+	DEFAULT_UNIX_SOCKET                  = ""
+	DEFAULT_UNIX_SOCKET_MODE             = "0660"
+	DEFAULT_UNIX_SOCKET_GROUP            = ""
+	DEFAULT_ADMIN_SOCKET                 = ""
+	DEFAULT_MAX_CONNECTIONS              = 0
+	DEFAULT_MAX_IP_CONNECTIONS           = 0
+	DEFAULT_IP_MESSAGE_RATE              = 0
+	DEFAULT_KEY_MESSAGE_RATE             = 0
+	DEFAULT_MESSAGE_BURST                = 10
+	DEFAULT_AUTH_FAILURE_LIMIT           = 0
+	DEFAULT_AUTH_LOCKOUT                 = 60000
+	DEFAULT_AUTH_LOCKOUT_MAX             = 3600000
+	DEFAULT_MAX_MESSAGE_SIZE             = 0
+	DEFAULT_CORS                         = false
+	DEFAULT_GRPC_HOST                    = ""
+	DEFAULT_GRPC_PORT                    = 0
+	DEFAULT_ALLOW_UNBOUND_SIGNATURES     = false
+)
+
+const (
+	MESSAGE_SIGNING_REQUIRED = "required"
+	MESSAGE_SIGNING_OPTIONAL = "optional"
+	MESSAGE_SIGNING_OFF      = "off"
+
+	AUTH_MODE_SIGNATURE = "signature"
+	AUTH_MODE_MTLS      = "mtls"
+	AUTH_MODE_BOTH      = "both"
+
+	LISTEN_ADDRESS_UNIX_PREFIX    = "unix://"
+	LISTEN_ADDRESS_SYSTEMD        = "systemd"
+	LISTEN_ADDRESS_SYSTEMD_PREFIX = "systemd:"
 )
 
 var config Config = Config{
@@ -35,6 +147,48 @@ var config Config = Config{
 	TlsCertFile: DEFAULT_TLS_CERT_FILE,
 	TlsKeyFile:  DEFAULT_TLS_KEY_FILE,
 	LogLevel:    DEFAULT_LOG_LEVEL,
+	FactsDir:    DEFAULT_FACTS_DIR,
+	Version:     DEFAULT_VERSION,
+	HealthPath:  DEFAULT_HEALTH_PATH,
+	ReadyPath:   DEFAULT_READY_PATH,
+	HealthHost:  DEFAULT_HEALTH_HOST,
+	HealthPort:  DEFAULT_HEALTH_PORT,
+	MetricsPath: DEFAULT_METRICS_PATH,
+	MetricsHost: DEFAULT_METRICS_HOST,
+	MetricsPort: DEFAULT_METRICS_PORT,
+	EngineOptions: EngineOptions{
+		PingTimeout:  DEFAULT_ENGINE_OPTIONS_PING_TIMEOUT,
+		PingInterval: DEFAULT_ENGINE_OPTIONS_PING_INTERVAL,
+	},
+	IdleTimeout:            DEFAULT_IDLE_TIMEOUT,
+	AuthMaxClockSkew:       DEFAULT_AUTH_MAX_CLOCK_SKEW,
+	MessageSigning:         DEFAULT_MESSAGE_SIGNING,
+	AuthorizedKeysFile:     DEFAULT_AUTHORIZED_KEYS_FILE,
+	RevokedKeysFile:        DEFAULT_REVOKED_KEYS_FILE,
+	KeyValidityFile:        DEFAULT_KEY_VALIDITY_FILE,
+	SshCaFile:              DEFAULT_SSH_CA_FILE,
+	X509CaFile:             DEFAULT_X509_CA_FILE,
+	AuthMode:               DEFAULT_AUTH_MODE,
+	TlsClientCaFile:        DEFAULT_TLS_CLIENT_CA_FILE,
+	TlsExpiryWarning:       DEFAULT_TLS_EXPIRY_WARNING,
+	TlsSelfSigned:          DEFAULT_TLS_SELF_SIGNED,
+	UnixSocket:             DEFAULT_UNIX_SOCKET,
+	UnixSocketMode:         DEFAULT_UNIX_SOCKET_MODE,
+	UnixSocketGroup:        DEFAULT_UNIX_SOCKET_GROUP,
+	AdminSocket:            DEFAULT_ADMIN_SOCKET,
+	MaxConnections:         DEFAULT_MAX_CONNECTIONS,
+	MaxIpConnections:       DEFAULT_MAX_IP_CONNECTIONS,
+	IpMessageRate:          DEFAULT_IP_MESSAGE_RATE,
+	KeyMessageRate:         DEFAULT_KEY_MESSAGE_RATE,
+	MessageBurst:           DEFAULT_MESSAGE_BURST,
+	AuthFailureLimit:       DEFAULT_AUTH_FAILURE_LIMIT,
+	AuthLockout:            DEFAULT_AUTH_LOCKOUT,
+	AuthLockoutMax:         DEFAULT_AUTH_LOCKOUT_MAX,
+	MaxMessageSize:         DEFAULT_MAX_MESSAGE_SIZE,
+	Cors:                   DEFAULT_CORS,
+	GrpcHost:               DEFAULT_GRPC_HOST,
+	GrpcPort:               DEFAULT_GRPC_PORT,
+	AllowUnboundSignatures: DEFAULT_ALLOW_UNBOUND_SIGNATURES,
 }
 
 func GetConfig() *Config {
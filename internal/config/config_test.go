@@ -14,6 +14,48 @@ func TestGetConfig(t *testing.T) {
 		LogLevel:    DEFAULT_LOG_LEVEL,
 		TlsKeyFile:  DEFAULT_TLS_KEY_FILE,
 		TlsCertFile: DEFAULT_TLS_CERT_FILE,
+		FactsDir:    DEFAULT_FACTS_DIR,
+		Version:     DEFAULT_VERSION,
+		HealthPath:  DEFAULT_HEALTH_PATH,
+		ReadyPath:   DEFAULT_READY_PATH,
+		HealthHost:  DEFAULT_HEALTH_HOST,
+		HealthPort:  DEFAULT_HEALTH_PORT,
+		MetricsPath: DEFAULT_METRICS_PATH,
+		MetricsHost: DEFAULT_METRICS_HOST,
+		MetricsPort: DEFAULT_METRICS_PORT,
+		EngineOptions: EngineOptions{
+			PingTimeout:  DEFAULT_ENGINE_OPTIONS_PING_TIMEOUT,
+			PingInterval: DEFAULT_ENGINE_OPTIONS_PING_INTERVAL,
+		},
+		IdleTimeout:            DEFAULT_IDLE_TIMEOUT,
+		AuthMaxClockSkew:       DEFAULT_AUTH_MAX_CLOCK_SKEW,
+		MessageSigning:         DEFAULT_MESSAGE_SIGNING,
+		AuthorizedKeysFile:     DEFAULT_AUTHORIZED_KEYS_FILE,
+		RevokedKeysFile:        DEFAULT_REVOKED_KEYS_FILE,
+		KeyValidityFile:        DEFAULT_KEY_VALIDITY_FILE,
+		SshCaFile:              DEFAULT_SSH_CA_FILE,
+		X509CaFile:             DEFAULT_X509_CA_FILE,
+		AuthMode:               DEFAULT_AUTH_MODE,
+		TlsClientCaFile:        DEFAULT_TLS_CLIENT_CA_FILE,
+		TlsExpiryWarning:       DEFAULT_TLS_EXPIRY_WARNING,
+		TlsSelfSigned:          DEFAULT_TLS_SELF_SIGNED,
+		UnixSocket:             DEFAULT_UNIX_SOCKET,
+		UnixSocketMode:         DEFAULT_UNIX_SOCKET_MODE,
+		UnixSocketGroup:        DEFAULT_UNIX_SOCKET_GROUP,
+		AdminSocket:            DEFAULT_ADMIN_SOCKET,
+		MaxConnections:         DEFAULT_MAX_CONNECTIONS,
+		MaxIpConnections:       DEFAULT_MAX_IP_CONNECTIONS,
+		IpMessageRate:          DEFAULT_IP_MESSAGE_RATE,
+		KeyMessageRate:         DEFAULT_KEY_MESSAGE_RATE,
+		MessageBurst:           DEFAULT_MESSAGE_BURST,
+		AuthFailureLimit:       DEFAULT_AUTH_FAILURE_LIMIT,
+		AuthLockout:            DEFAULT_AUTH_LOCKOUT,
+		AuthLockoutMax:         DEFAULT_AUTH_LOCKOUT_MAX,
+		MaxMessageSize:         DEFAULT_MAX_MESSAGE_SIZE,
+		Cors:                   DEFAULT_CORS,
+		GrpcHost:               DEFAULT_GRPC_HOST,
+		GrpcPort:               DEFAULT_GRPC_PORT,
+		AllowUnboundSignatures: DEFAULT_ALLOW_UNBOUND_SIGNATURES,
 	}
 
 	if config := GetConfig(); !reflect.DeepEqual(*config, want) {
@@ -0,0 +1,175 @@
+// Package handover passes the listening sockets of the server to a new process (ex: an upgraded binary) so that it can
+// be restarted without refusing connections
+//
+// The new process gets the sockets as extra files, starting at file descriptor 3, along with the addresses that they
+// listen on (RC_HANDOVER_FDS) and the write end of a pipe (RC_HANDOVER_READY_FD) that it writes to once it is ready.
+package handover
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FDS_ENV      = "RC_HANDOVER_FDS"
+	READY_FD_ENV = "RC_HANDOVER_READY_FD"
+
+	// the first file descriptor of the sockets (after stdin, stdout and stderr)
+	FDS_START = 3
+
+	READY_MESSAGE = "1"
+)
+
+var (
+	errNotReady     = errors.New("new process exited before it was ready")
+	errReadyTimeout = errors.New("timed out waiting for the new process to be ready")
+
+	filesOnce sync.Once
+	files     map[string][]*os.File
+)
+
+// Start runs a new process (path with args) that takes over the listening sockets in files, which listen on
+// addresses, and waits until it is ready.  A new process that isn't ready within timeout is killed.
+func Start(path string, args []string, files []*os.File, addresses []string, timeout time.Duration) (*os.Process, error) {
+	encoded, err := json.Marshal(addresses)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(append([]*os.File{}, files...), w)
+	cmd.Env = append(os.Environ(),
+		FDS_ENV+"="+string(encoded),
+		READY_FD_ENV+"="+strconv.Itoa(FDS_START+len(files)),
+	)
+
+	err = cmd.Start()
+
+	// the new process has its own copy of the write end, so reading fails once it exits
+	_ = w.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// reap the new process if it exits while this one is still running
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	ready := make(chan error, 1)
+
+	go func() {
+		buf := make([]byte, len(READY_MESSAGE))
+
+		if n, _ := r.Read(buf); n == len(buf) && string(buf) == READY_MESSAGE {
+			ready <- nil
+			return
+		}
+
+		ready <- errNotReady
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = errReadyTimeout
+	}
+
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
+
+// Files returns the sockets passed by the process that started this one, by the address that they listen on.  The
+// sockets are only taken once: the environment variable is unset (and the file descriptors are closed on exec) so
+// that the commands run by the server don't inherit them, and later calls return the same files.
+func Files() map[string][]*os.File {
+	filesOnce.Do(func() {
+		files = map[string][]*os.File{}
+
+		addresses := parseAddresses(os.Getenv(FDS_ENV))
+
+		for i, address := range addresses {
+			fd := FDS_START + i
+
+			closeOnExec(fd)
+			files[address] = append(files[address], os.NewFile(uintptr(fd), address))
+		}
+
+		if fd, err := strconv.Atoi(os.Getenv(READY_FD_ENV)); err == nil {
+			closeOnExec(fd)
+		}
+
+		_ = os.Unsetenv(FDS_ENV)
+	})
+
+	return files
+}
+
+// Inherited is true when this process has taken over the sockets of another one
+func Inherited() bool {
+	return len(Files()) > 0
+}
+
+// Ready tells the process that started this one that it has taken over the sockets (and can stop).  It does nothing
+// when this process wasn't started by a handover.
+func Ready() error {
+	value := os.Getenv(READY_FD_ENV)
+
+	if value == "" {
+		return nil
+	}
+
+	_ = os.Unsetenv(READY_FD_ENV)
+
+	fd, err := strconv.Atoi(value)
+
+	if err != nil {
+		return errors.Wrap(err, "invalid "+READY_FD_ENV)
+	}
+
+	f := os.NewFile(uintptr(fd), "handover-ready")
+
+	if _, err := f.Write([]byte(READY_MESSAGE)); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func parseAddresses(value string) []string {
+	var addresses []string
+
+	if value == "" {
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &addresses); err != nil {
+		return nil
+	}
+
+	return addresses
+}
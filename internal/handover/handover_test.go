@@ -0,0 +1,160 @@
+package handover
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	HELPER_PROCESS_ENV = "RC_HANDOVER_HELPER_PROCESS"
+)
+
+// TestHelperProcess is the new process of TestStart: it answers the connections of the socket that it took over
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(HELPER_PROCESS_ENV) != "1" {
+		return
+	}
+
+	var listener net.Listener
+
+	for _, f := range Files()["tcp"] {
+		listener, _ = net.FileListener(f)
+	}
+
+	if listener == nil {
+		os.Exit(2)
+	}
+
+	if err := Ready(); err != nil {
+		os.Exit(3)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Second)
+		os.Exit(0)
+	}()
+
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			os.Exit(4)
+		}
+
+		_, _ = conn.Write([]byte("new"))
+		_ = conn.Close()
+	}
+}
+
+func TestStart(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	// the current process answers until the new one is ready
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			_, _ = conn.Write([]byte("old"))
+			_ = conn.Close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	answers := map[string]int{}
+	var refused []error
+
+	// connect continuously during the handover
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+
+			if err != nil {
+				refused = append(refused, err)
+				continue
+			}
+
+			answer, _ := ioutil.ReadAll(conn)
+			_ = conn.Close()
+
+			answers[string(answer)]++
+		}
+	}()
+
+	f, err := listener.(*net.TCPListener).File()
+
+	if err != nil {
+		t.Fatalf("Error getting the listener file: %v", err)
+	}
+
+	_ = os.Setenv(HELPER_PROCESS_ENV, "1")
+	defer os.Unsetenv(HELPER_PROCESS_ENV)
+
+	process, err := Start(os.Args[0], []string{"-test.run=TestHelperProcess"}, []*os.File{f}, []string{"tcp"}, 10*time.Second)
+
+	if err != nil {
+		close(stop)
+		wg.Wait()
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer process.Kill()
+
+	// the current process stops accepting once the new one is ready
+	time.Sleep(50 * time.Millisecond)
+	_ = listener.Close()
+	_ = f.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	close(stop)
+	wg.Wait()
+
+	if len(refused) > 0 {
+		t.Errorf("%d connection attempts failed during the handover, first: %v", len(refused), refused[0])
+	}
+
+	if answers["old"] == 0 || answers["new"] == 0 {
+		t.Errorf("answers = %v, wanted connections answered by both processes", answers)
+	}
+}
+
+func TestStart_Not_Ready(t *testing.T) {
+	// a process that exits without taking over the sockets
+	if _, err := Start("/bin/true", nil, nil, nil, 10*time.Second); err != errNotReady {
+		t.Errorf("Start() error = %v, wanted %v", err, errNotReady)
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	want := []string{"0.0.0.0:4515", "unix:///run/rc.sock"}
+
+	if got := parseAddresses(`["0.0.0.0:4515","unix:///run/rc.sock"]`); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAddresses() = %v, wanted %v", got, want)
+	}
+
+	if got := parseAddresses("invalid"); got != nil {
+		t.Errorf("parseAddresses() of an invalid value = %v, wanted nil", got)
+	}
+}
@@ -0,0 +1,11 @@
+//+build !windows
+
+package handover
+
+import (
+	"syscall"
+)
+
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
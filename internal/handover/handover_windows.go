@@ -0,0 +1,6 @@
+//+build windows
+
+package handover
+
+// closeOnExec does nothing since sockets are not handed over on windows
+func closeOnExec(int) {}
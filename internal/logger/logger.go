@@ -7,6 +7,9 @@ import (
 
 var logger *zap.Logger
 
+// level is shared by all of the loggers so that the log level can be changed without replacing them
+var level = zap.NewAtomicLevel()
+
 func InitLogger(logLevel string) (*zap.Logger, error) {
 	rawJSON := []byte(`{
 	  "level": "` + logLevel + `",
@@ -27,6 +30,9 @@ func InitLogger(logLevel string) (*zap.Logger, error) {
 		return nil, err
 	}
 
+	level.SetLevel(cfg.Level.Level())
+	cfg.Level = level
+
 	logger, err = cfg.Build()
 
 	return logger, err
@@ -35,3 +41,13 @@ func InitLogger(logLevel string) (*zap.Logger, error) {
 func GetLogger() *zap.Logger {
 	return logger
 }
+
+// SetLevel changes the level of all of the loggers
+func SetLevel(logLevel string) error {
+	return level.UnmarshalText([]byte(logLevel))
+}
+
+// GetLevel returns the current log level
+func GetLevel() string {
+	return level.String()
+}
@@ -40,3 +40,21 @@ func TestGetLogger(t *testing.T) {
 		t.Errorf("Wanted %v, got %v", logger, l)
 	}
 }
+
+func TestSetLevel(t *testing.T) {
+	log, _ := InitLogger("info")
+
+	defer InitLogger("info")
+
+	if err := SetLevel("debug"); err != nil {
+		t.Errorf("SetLevel() error = %v, wanted %v", err, nil)
+	}
+
+	if ent := log.Check(zap.DebugLevel, "foo bar"); ent == nil || GetLevel() != "debug" {
+		t.Error("SetLevel() should change the level of existing loggers")
+	}
+
+	if err := SetLevel("loud"); err == nil || GetLevel() != "debug" {
+		t.Errorf("SetLevel() of an invalid level error = %v, wanted an error and the level to be kept", err)
+	}
+}
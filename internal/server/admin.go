@@ -0,0 +1,278 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/internal/logger"
+)
+
+const (
+	// ADMIN_SOCKET_MODE only allows the owner of the admin socket (the user running the server) to connect to it
+	ADMIN_SOCKET_MODE = "0600"
+
+	ADMIN_PATH_STATUS     = "/v1/status"
+	ADMIN_PATH_CLIENTS    = "/v1/clients"
+	ADMIN_PATH_COMMANDS   = "/v1/commands"
+	ADMIN_PATH_DRAIN      = "/v1/drain"
+	ADMIN_PATH_LOG_LEVEL  = "/v1/log-level"
+	DISCONNECTED_MESSAGE  = "disconnected by an administrator"
+	ADMIN_FORBIDDEN_ERROR = "the admin API is restricted to root and the user running the server"
+)
+
+var (
+	errClientNotFound = errors.New("client not found")
+)
+
+// connection is a websocket connection of an authenticated client
+type connection struct {
+	id         uint64
+	key        string
+	remoteAddr string
+	connected  time.Time
+	conn       *websocket.Conn
+}
+
+// clientInfo describes a connected client for the admin API
+type clientInfo struct {
+	Id               uint64    `json:"id"`
+	Key              string    `json:"key"`
+	RemoteAddr       string    `json:"remoteAddr"`
+	Connected        time.Time `json:"connected"`
+	ConnectedSeconds float64   `json:"connectedSeconds"`
+}
+
+// adminStatus is the state of the server reported by the admin API
+type adminStatus struct {
+	readyStatus
+	Connections int    `json:"connections"`
+	LogLevel    string `json:"logLevel"`
+}
+
+type adminLogLevel struct {
+	Level string `json:"level"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// startAdminServer starts the admin API on its unix socket (when one is configured)
+func (s *server) startAdminServer() error {
+	if s.conf.AdminSocket == "" {
+		return nil
+	}
+
+	router := mux.NewRouter()
+	s.registerAdminRoutes(router)
+
+	adminSrv := &http.Server{
+		Handler:     s.adminAuth(router),
+		ConnContext: connContext,
+	}
+
+	address := config.LISTEN_ADDRESS_UNIX_PREFIX + s.conf.AdminSocket
+
+	sockets, err := s.openSockets(config.Listener{Address: address, UnixSocketMode: ADMIN_SOCKET_MODE})
+
+	if err != nil {
+		return errors.Wrap(err, "failed to listen on the admin socket")
+	}
+
+	s.auxSrvs = append(s.auxSrvs, adminSrv)
+	s.auxListeners = append(s.auxListeners, &listener{Listener: sockets[0], conf: config.Listener{Address: address}})
+
+	s.logger.Info("Admin server listening", zap.String("listen address", address))
+
+	s.waitGroup.Add(1)
+	go func() {
+		defer s.waitGroup.Done()
+
+		if err := adminSrv.Serve(sockets[0]); err != http.ErrServerClosed {
+			s.logger.Error("Error serving admin requests", zap.Error(err), zap.String("listen address", address))
+		}
+	}()
+
+	return nil
+}
+
+func (s *server) registerAdminRoutes(router *mux.Router) {
+	router.HandleFunc(ADMIN_PATH_STATUS, s.adminStatusHandler).Methods(http.MethodGet)
+	router.HandleFunc(ADMIN_PATH_CLIENTS, s.adminClientsHandler).Methods(http.MethodGet)
+	router.HandleFunc(ADMIN_PATH_CLIENTS+"/{id}", s.adminDisconnectHandler).Methods(http.MethodDelete)
+	router.HandleFunc(ADMIN_PATH_COMMANDS, s.adminCommandsHandler).Methods(http.MethodGet)
+	router.HandleFunc(ADMIN_PATH_COMMANDS+"/{id}", s.adminKillHandler).Methods(http.MethodDelete)
+	router.HandleFunc(ADMIN_PATH_DRAIN, s.adminDrainHandler).Methods(http.MethodPut, http.MethodDelete)
+	router.HandleFunc(ADMIN_PATH_LOG_LEVEL, s.adminLogLevelHandler).Methods(http.MethodGet, http.MethodPut)
+}
+
+// adminAuth only lets root and the user running the server use the admin API (on top of the permissions of the socket)
+func (s *server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn := unixConn(r)
+
+		if conn == nil {
+			s.writeJson(w, http.StatusForbidden, adminError{Error: ADMIN_FORBIDDEN_ERROR})
+			return
+		}
+
+		cred, err := getPeerCred(conn)
+
+		if err != nil {
+			s.logger.Warn("Failed to get the peer credentials of an admin request", zap.Error(err))
+			s.writeJson(w, http.StatusForbidden, adminError{Error: ADMIN_FORBIDDEN_ERROR})
+			return
+		}
+
+		if cred.uid != 0 && int(cred.uid) != os.Geteuid() {
+			s.logger.Warn("Rejected admin request", zap.Uint32("uid", cred.uid), zap.Int32("pid", cred.pid))
+			s.writeJson(w, http.StatusForbidden, adminError{Error: ADMIN_FORBIDDEN_ERROR})
+			return
+		}
+
+		s.logger.Debug("Admin request", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Uint32("uid", cred.uid), zap.Int32("pid", cred.pid))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) adminStatusHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJson(w, http.StatusOK, adminStatus{
+		readyStatus: s.readiness(),
+		Connections: s.connectionCount(),
+		LogLevel:    logger.GetLevel(),
+	})
+}
+
+func (s *server) adminClientsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJson(w, http.StatusOK, s.listClients())
+}
+
+func (s *server) adminDisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		s.writeJson(w, http.StatusBadRequest, adminError{Error: "invalid client id"})
+		return
+	}
+
+	if err := s.disconnectClient(id); err != nil {
+		s.writeJson(w, http.StatusNotFound, adminError{Error: err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) adminCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJson(w, http.StatusOK, s.listJobs())
+}
+
+func (s *server) adminKillHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		s.writeJson(w, http.StatusBadRequest, adminError{Error: "invalid command id"})
+		return
+	}
+
+	switch err := s.killJob(id, ""); err {
+	case nil:
+		s.logger.Info("Command killed by an administrator", zap.Uint64("id", id))
+		w.WriteHeader(http.StatusNoContent)
+	case errJobNotFound:
+		s.writeJson(w, http.StatusNotFound, adminError{Error: err.Error()})
+	case errJobNotStarted:
+		s.writeJson(w, http.StatusConflict, adminError{Error: err.Error()})
+	default:
+		s.writeJson(w, http.StatusInternalServerError, adminError{Error: err.Error()})
+	}
+}
+
+func (s *server) adminDrainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		s.Resume()
+	} else {
+		s.Drain()
+	}
+
+	s.adminStatusHandler(w, r)
+}
+
+func (s *server) adminLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var level adminLogLevel
+
+		if err := json.NewDecoder(r.Body).Decode(&level); err != nil {
+			s.writeJson(w, http.StatusBadRequest, adminError{Error: "invalid request body: " + err.Error()})
+			return
+		}
+
+		if err := logger.SetLevel(level.Level); err != nil {
+			s.writeJson(w, http.StatusBadRequest, adminError{Error: err.Error()})
+			return
+		}
+
+		s.logger.Info("Log level changed by an administrator", zap.String("level", logger.GetLevel()))
+	}
+
+	s.writeJson(w, http.StatusOK, adminLogLevel{Level: logger.GetLevel()})
+}
+
+// listClients returns the connected clients, oldest connection first
+func (s *server) listClients() []clientInfo {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	now := time.Now()
+	clients := make([]clientInfo, 0, len(s.conns))
+
+	for _, c := range s.conns {
+		clients = append(clients, clientInfo{
+			Id:               c.id,
+			Key:              c.key,
+			RemoteAddr:       c.remoteAddr,
+			Connected:        c.connected,
+			ConnectedSeconds: now.Sub(c.connected).Seconds(),
+		})
+	}
+
+	sort.Slice(clients, func(i, k int) bool {
+		return clients[i].Id < clients[k].Id
+	})
+
+	return clients
+}
+
+// disconnectClient closes the connection of a client.  Its running commands are not affected.
+func (s *server) disconnectClient(id uint64) error {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	for _, c := range s.conns {
+		if c.id != id {
+			continue
+		}
+
+		s.logger.Info("Disconnecting client", zap.Uint64("id", id), zap.String("key", c.key), zap.String("remoteAddr", c.remoteAddr))
+
+		closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, DISCONNECTED_MESSAGE)
+
+		_ = c.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(CLOSE_MESSAGE_TIMEOUT))
+		_ = c.conn.Close()
+
+		return nil
+	}
+
+	return errClientNotFound
+}
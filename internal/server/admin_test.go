@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/internal/logger"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestServer_Admin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-admin")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+	conf.AdminSocket = filepath.Join(dir, "admin.sock")
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	if info, err := os.Stat(conf.AdminSocket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("admin socket = %v (%v), wanted mode 0600", info, err)
+	}
+
+	addr := srv.listeners[0].Addr().(*net.TCPAddr)
+
+	clientConf := *client_config.GetConfig()
+	clientConf.Host = addr.IP.String()
+	clientConf.Port = addr.Port
+	clientConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	clientConf.KeyName = "client"
+	clientConf.TlsDisable = true
+
+	c := client.NewClient(clientConf)
+
+	if err := <-c.Start(); err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+
+	defer c.Stop()
+
+	admin := func(method string, path string, body interface{}, resp interface{}) int {
+		t.Helper()
+
+		var reqBody bytes.Buffer
+
+		if body != nil {
+			_ = json.NewEncoder(&reqBody).Encode(body)
+		}
+
+		req, _ := http.NewRequest(method, "http://admin"+path, &reqBody)
+
+		httpClient := http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", conf.AdminSocket)
+			},
+		}}
+
+		res, err := httpClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, path, err)
+		}
+
+		defer res.Body.Close()
+
+		if resp != nil {
+			if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+				t.Errorf("%s %s invalid response: %v", method, path, err)
+			}
+		}
+
+		return res.StatusCode
+	}
+
+	// clients
+	var clients []clientInfo
+
+	if code := admin(http.MethodGet, ADMIN_PATH_CLIENTS, nil, &clients); code != http.StatusOK || len(clients) != 1 || clients[0].Key != "client" {
+		t.Fatalf("GET %s = %d %v, wanted the connected client", ADMIN_PATH_CLIENTS, code, clients)
+	}
+
+	// running commands can be killed
+	respChan := c.Send("sleep 10", rc_protocol.MessageOptions{})
+
+	var jobs []jobInfo
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if admin(http.MethodGet, ADMIN_PATH_COMMANDS, nil, &jobs); len(jobs) == 1 && jobs[0].Pid != 0 {
+			break
+		}
+	}
+
+	if len(jobs) != 1 || jobs[0].State != JOB_STATE_RUNNING || jobs[0].Key != "client" || jobs[0].Command != "sleep 10" {
+		t.Fatalf("GET %s = %v, wanted the running command", ADMIN_PATH_COMMANDS, jobs)
+	}
+
+	if code := admin(http.MethodDelete, ADMIN_PATH_COMMANDS+"/"+strconv.FormatUint(jobs[0].Id, 10), nil, nil); code != http.StatusNoContent {
+		t.Errorf("DELETE %s/%d = %d, wanted %d", ADMIN_PATH_COMMANDS, jobs[0].Id, code, http.StatusNoContent)
+	}
+
+	select {
+	case resp := <-respChan:
+		if resp == nil || resp.ExitCode == 0 {
+			t.Errorf("killed command response = %v, wanted a failure", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("killed command did not finish")
+	}
+
+	if code := admin(http.MethodDelete, ADMIN_PATH_COMMANDS+"/999", nil, nil); code != http.StatusNotFound {
+		t.Errorf("DELETE %s/999 = %d, wanted %d", ADMIN_PATH_COMMANDS, code, http.StatusNotFound)
+	}
+
+	// log level
+	defer logger.SetLevel(logger.GetLevel())
+
+	var level adminLogLevel
+
+	if code := admin(http.MethodPut, ADMIN_PATH_LOG_LEVEL, adminLogLevel{Level: "debug"}, &level); code != http.StatusOK || level.Level != "debug" || logger.GetLevel() != "debug" {
+		t.Errorf("PUT %s = %d %v, wanted debug", ADMIN_PATH_LOG_LEVEL, code, level)
+	}
+
+	if code := admin(http.MethodPut, ADMIN_PATH_LOG_LEVEL, adminLogLevel{Level: "loud"}, nil); code != http.StatusBadRequest {
+		t.Errorf("PUT %s with an invalid level = %d, wanted %d", ADMIN_PATH_LOG_LEVEL, code, http.StatusBadRequest)
+	}
+
+	// drain
+	var status adminStatus
+
+	if admin(http.MethodPut, ADMIN_PATH_DRAIN, nil, &status); !status.Draining || !srv.isDraining() {
+		t.Errorf("PUT %s = %v, wanted draining", ADMIN_PATH_DRAIN, status)
+	}
+
+	if admin(http.MethodDelete, ADMIN_PATH_DRAIN, nil, &status); status.Draining || srv.isDraining() {
+		t.Errorf("DELETE %s = %v, wanted not draining", ADMIN_PATH_DRAIN, status)
+	}
+
+	// status
+	if code := admin(http.MethodGet, ADMIN_PATH_STATUS, nil, &status); code != http.StatusOK || status.Connections != 1 || status.Workers != MAX_CONCURRENT_COMMANDS {
+		t.Errorf("GET %s = %d %v", ADMIN_PATH_STATUS, code, status)
+	}
+
+	// clients can be disconnected
+	if code := admin(http.MethodDelete, ADMIN_PATH_CLIENTS+"/"+strconv.FormatUint(clients[0].Id, 10), nil, nil); code != http.StatusNoContent {
+		t.Errorf("DELETE %s/%d = %d, wanted %d", ADMIN_PATH_CLIENTS, clients[0].Id, code, http.StatusNoContent)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); srv.connectionCount() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if count := srv.connectionCount(); count != 0 {
+		t.Errorf("connectionCount() = %d after disconnecting the client, wanted 0", count)
+	}
+
+	if code := admin(http.MethodDelete, ADMIN_PATH_CLIENTS+"/999", nil, nil); code != http.StatusNotFound {
+		t.Errorf("DELETE %s/999 = %d, wanted %d", ADMIN_PATH_CLIENTS, code, http.StatusNotFound)
+	}
+}
+
+func TestServer_Kill_Queued_Command(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	// keep all of the workers busy and queue one more command
+	var wg sync.WaitGroup
+	responses := make([]*message.Response, MAX_CONCURRENT_COMMANDS+1)
+
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			responses[i], _ = srv.queueCommand(rc_protocol.Message{Id: i, Command: "sleep 0.5; echo done"}, "client")
+		}(i)
+	}
+
+	var queued *jobInfo
+
+	for deadline := time.Now().Add(5 * time.Second); queued == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, j := range srv.listJobs() {
+			if j.State == JOB_STATE_QUEUED {
+				j := j
+				queued = &j
+			}
+		}
+	}
+
+	if queued == nil {
+		t.Fatal("no command was queued")
+	}
+
+	if err := srv.killJob(queued.Id, ""); err != nil {
+		t.Fatalf("killJob() error = %v", err)
+	}
+
+	wg.Wait()
+
+	killed := 0
+
+	for _, resp := range responses {
+		switch {
+		case resp == nil:
+			t.Error("queueCommand() response = nil")
+		case resp.Status == message.STATUS_KILLED:
+			killed++
+
+			if resp.Stderr != KILLED_MESSAGE {
+				t.Errorf("killed command stderr = %q, wanted %q", resp.Stderr, KILLED_MESSAGE)
+			}
+		case resp.Status == message.STATUS_CANCELED:
+			t.Errorf("killed command response = %v, wanted status %s", resp, message.STATUS_KILLED)
+		}
+	}
+
+	if killed != 1 {
+		t.Errorf("%d commands were killed, wanted 1", killed)
+	}
+
+	if got := testutil.ToFloat64(srv.metrics.commandsFailed.WithLabelValues("client", EXIT_CLASS_CANCELED)); got != 0 {
+		t.Errorf("commands_failed_total{class=%q} = %v, wanted 0", EXIT_CLASS_CANCELED, got)
+	}
+
+	if got := testutil.ToFloat64(srv.metrics.commandsFailed.WithLabelValues("client", EXIT_CLASS_KILLED)); got != 1 {
+		t.Errorf("commands_failed_total{class=%q} = %v, wanted 1", EXIT_CLASS_KILLED, got)
+	}
+}
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"bytes"
+	"io"
 	"os"
 
 	rc_protocol "github.com/cthayer/go-rc-protocol"
+
+	"github.com/cthayer/remote_control/pkg/message"
 )
 
 type command struct {
@@ -16,6 +20,34 @@ type command struct {
 	Env      []string
 	Cwd      string
 	Shell    []string
+	// onStart is called with the process of the command once it has started
+	onStart func(*os.Process)
+	// output is called with the output of the command as it is written (stream is message.STREAM_STDOUT or
+	// message.STREAM_STDERR)
+	output func(stream string, data []byte)
+}
+
+// outputWriter passes the output of a stream of a command to its output function
+type outputWriter struct {
+	stream string
+	output func(stream string, data []byte)
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.output(w.stream, p)
+
+	return len(p), nil
+}
+
+// outputWriters returns the writers of the stdout and stderr of the command (they capture the output in stdout and
+// stderr and pass it to the output function, if any)
+func (c *command) outputWriters(stdout *bytes.Buffer, stderr *bytes.Buffer) (io.Writer, io.Writer) {
+	if c.output == nil {
+		return stdout, stderr
+	}
+
+	return io.MultiWriter(stdout, outputWriter{stream: message.STREAM_STDOUT, output: c.output}),
+		io.MultiWriter(stderr, outputWriter{stream: message.STREAM_STDERR, output: c.output})
 }
 
 func newCommand(msg rc_protocol.Message) command {
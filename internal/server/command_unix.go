@@ -5,6 +5,7 @@ package server
 import (
 	"bytes"
 	"context"
+	"os"
 	"os/exec"
 	"syscall"
 	"time"
@@ -39,8 +40,7 @@ func (c *command) exec() {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stdout, cmd.Stderr = c.outputWriters(&stdout, &stderr)
 
 	// run the command in it's own process group (needed for graceful shutdowns)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
@@ -48,9 +48,24 @@ func (c *command) exec() {
 	}
 
 	// run the command
-	err := cmd.Run()
+	err := cmd.Start()
+
+	if err == nil {
+		if c.onStart != nil {
+			c.onStart(cmd.Process)
+		}
+
+		err = cmd.Wait()
+	}
 
 	// gather the results
+	if err != nil && cmd.ProcessState == nil {
+		// the command could not be started
+		log.Debug("Error occurred while starting command", zap.Error(err))
+		c.Stderr = err.Error()
+		return
+	}
+
 	if err != nil {
 		log.Debug("Error occurred while running command", zap.Error(err))
 		c.ExitCode = cmd.ProcessState.ExitCode()
@@ -63,3 +78,8 @@ func (c *command) exec() {
 	c.Stdout = string(stdout.Bytes())
 	c.Stderr = string(stderr.Bytes())
 }
+
+// killProcess kills the process of a command along with the processes that it started (its process group)
+func killProcess(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
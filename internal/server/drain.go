@@ -0,0 +1,197 @@
+package server
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+const (
+	// how often a draining server checks whether its commands have finished
+	DRAIN_POLL_INTERVAL = 100 * time.Millisecond
+	// how often the progress of a drain is logged
+	DRAIN_PROGRESS_INTERVAL = 5 * time.Second
+	// how long to wait for clients to acknowledge the close message when the server stops
+	CLOSE_MESSAGE_TIMEOUT = time.Second
+
+	DRAINING_MESSAGE = "server is draining, not accepting new commands"
+	CANCELED_MESSAGE = "command canceled, server is draining"
+	KILLED_MESSAGE   = "command killed before it ran"
+	SHUTDOWN_MESSAGE = "server is shutting down"
+)
+
+// Drain stops the server from taking new work without stopping it: new messages are answered with a draining
+// response, queued commands are canceled and the running commands are left to finish.  The returned channel is closed
+// once no commands are running.  It is never closed when the drain is canceled by Resume, since commands may still be
+// running.
+func (s *server) Drain() chan struct{} {
+	s.drainLock.Lock()
+	defer s.drainLock.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&s.draining, 0, 1) {
+		return s.drained
+	}
+
+	s.drained = make(chan struct{})
+	s.drainCanceled = make(chan struct{})
+
+	canceled := s.cancelQueuedCommands()
+
+	s.logger.Info("Draining, new commands are rejected",
+		zap.Int("canceledCommands", canceled),
+		zap.Int32("runningCommands", atomic.LoadInt32(&s.runningCommands)),
+		zap.Int("connections", s.connectionCount()),
+	)
+
+	go s.waitForDrain(s.drained, s.drainCanceled)
+
+	return s.drained
+}
+
+// Resume accepts new commands again after a drain.  A server that is stopping keeps draining.
+func (s *server) Resume() {
+	s.drainLock.Lock()
+	defer s.drainLock.Unlock()
+
+	if atomic.LoadInt32(&s.stopping) == 1 {
+		s.logger.Warn("Not resuming, the server is stopping")
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&s.draining, 1, 0) {
+		close(s.drainCanceled)
+		s.logger.Info("Drain canceled, accepting new commands")
+	}
+}
+
+// waitForDrain closes drained once no commands are running (or are waiting to be canceled) and their responses have
+// been sent, and logs the progress of the drain until then.  It gives up without closing drained when canceled is
+// closed.
+func (s *server) waitForDrain(drained chan struct{}, canceled chan struct{}) {
+	started := time.Now()
+	lastProgress := started
+
+	ticker := time.NewTicker(DRAIN_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-canceled:
+			return
+		case <-ticker.C:
+		}
+
+		running := atomic.LoadInt32(&s.runningCommands)
+
+		if running == 0 && len(s.cmdQueue) == 0 && atomic.LoadInt32(&s.inFlightMessages) == 0 {
+			s.logger.Info("Drain complete", zap.Int64("durationMs", time.Since(started).Milliseconds()), zap.Int("connections", s.connectionCount()))
+			close(drained)
+			return
+		}
+
+		if time.Since(lastProgress) >= DRAIN_PROGRESS_INTERVAL {
+			lastProgress = time.Now()
+
+			s.logger.Info("Draining, waiting for commands to finish",
+				zap.Int32("runningCommands", running),
+				zap.Int("connections", s.connectionCount()),
+				zap.Int64("elapsedMs", time.Since(started).Milliseconds()),
+			)
+		}
+	}
+}
+
+// cancelQueuedCommands answers the commands waiting in the queue with a cancellation and returns how many there were
+func (s *server) cancelQueuedCommands() int {
+	canceled := 0
+
+	for {
+		select {
+		case c := <-s.cmdQueue:
+			s.cancelCommand(c, message.STATUS_CANCELED)
+			canceled++
+		default:
+			return canceled
+		}
+	}
+}
+
+// cancelCommand answers a queued command that won't run: with STATUS_CANCELED when the server is draining and with
+// STATUS_KILLED when its job was killed
+func (s *server) cancelCommand(c commandQueue, status string) {
+	stderr, class := CANCELED_MESSAGE, EXIT_CLASS_CANCELED
+
+	if status == message.STATUS_KILLED {
+		stderr, class = KILLED_MESSAGE, EXIT_CLASS_KILLED
+	}
+
+	s.logger.Debug("Canceling queued command", zap.Any("command", c), zap.String("status", status))
+	s.removeJob(c.Job)
+	s.metrics.commandsFailed.WithLabelValues(c.Key, class).Inc()
+
+	c.RespChan <- commandResp{
+		Response: rc_protocol.Response{Id: strconv.Itoa(c.Message.Id), Stderr: stderr, ExitCode: -1},
+		Status:   status,
+	}
+
+	close(c.RespChan)
+}
+
+// drainingResponse answers a message that arrived while the server is draining
+func drainingResponse(m *message.Message) *message.Response {
+	resp := message.Response{
+		Response: rc_protocol.Response{Id: strconv.Itoa(m.Id), Stderr: DRAINING_MESSAGE, ExitCode: -1},
+		Status:   message.STATUS_DRAINING,
+	}
+
+	return &resp
+}
+
+func (s *server) addConnection(conn *websocket.Conn, key string) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	s.lastConnId++
+
+	s.conns[conn] = &connection{
+		id:         s.lastConnId,
+		key:        key,
+		remoteAddr: conn.RemoteAddr().String(),
+		connected:  time.Now(),
+		conn:       conn,
+	}
+}
+
+func (s *server) removeConnection(conn *websocket.Conn) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	delete(s.conns, conn)
+}
+
+func (s *server) connectionCount() int {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	return len(s.conns)
+}
+
+// closeConnections closes the websocket connections, which http.Server.Shutdown doesn't track once they have been
+// upgraded, with a going away close message
+func (s *server) closeConnections() {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, SHUTDOWN_MESSAGE)
+
+	for conn := range s.conns {
+		_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(CLOSE_MESSAGE_TIMEOUT))
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestServer_Drain(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	addr := srv.listeners[0].Addr().(*net.TCPAddr)
+
+	clientConf := *client_config.GetConfig()
+	clientConf.Host = addr.IP.String()
+	clientConf.Port = addr.Port
+	clientConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	clientConf.KeyName = "client"
+	clientConf.TlsDisable = true
+
+	c := client.NewClient(clientConf)
+
+	if err := <-c.Start(); err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+
+	// keep all of the workers busy and queue one more command
+	var wg sync.WaitGroup
+	responses := make([]*message.Response, MAX_CONCURRENT_COMMANDS+1)
+
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			responses[i], _ = srv.queueCommand(rc_protocol.Message{Id: i, Command: "sleep 0.5; echo done"}, "client")
+		}(i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for (atomic.LoadInt32(&srv.runningCommands) < MAX_CONCURRENT_COMMANDS || len(srv.cmdQueue) < 1) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	drained := srv.Drain()
+
+	if !srv.readiness().Draining {
+		t.Error("readiness() should report draining")
+	}
+
+	// new messages are rejected with a typed response
+	resp := <-c.Send("echo hello", rc_protocol.MessageOptions{})
+
+	if resp == nil || resp.Stderr != DRAINING_MESSAGE || resp.ExitCode != -1 {
+		t.Errorf("Send() while draining = %v, wanted a draining response", resp)
+	}
+
+	if resp, _ := srv.handleMessage(`{"id": 9, "command": "echo hello"}`, &session{key: "client"}); resp == nil || resp.Status != message.STATUS_DRAINING {
+		t.Errorf("handleMessage() while draining = %v, wanted status %s", resp, message.STATUS_DRAINING)
+	}
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not complete")
+	}
+
+	wg.Wait()
+
+	done, canceled := 0, 0
+
+	for _, resp := range responses {
+		switch {
+		case resp == nil:
+			t.Error("queueCommand() response = nil")
+		case resp.Status == message.STATUS_CANCELED:
+			canceled++
+		case resp.Stdout == "done\n":
+			done++
+		}
+	}
+
+	if done != MAX_CONCURRENT_COMMANDS || canceled != 1 {
+		t.Errorf("drain finished %d commands and canceled %d, wanted %d and 1", done, canceled, MAX_CONCURRENT_COMMANDS)
+	}
+
+	// draining doesn't stop the server
+	srv.Resume()
+
+	validateResponse(t, <-c.Send("echo resumed", rc_protocol.MessageOptions{}), "resumed\n", "", 0)
+
+	// stopping closes the connections that are still open
+	select {
+	case err := <-srv.Stop():
+		if err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Stop() did not close the open websocket connection")
+	}
+
+	<-c.Stop()
+}
+
+func TestServer_Drain_Resume(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	responses := make(chan *message.Response, 2)
+
+	queue := func(id int) {
+		go func() {
+			resp, _ := srv.queueCommand(rc_protocol.Message{Id: id, Command: "sleep 0.5; echo done"}, "client")
+			responses <- resp
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+
+		for atomic.LoadInt32(&srv.runningCommands) < 1 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// a canceled drain isn't reported as a completed one
+	queue(1)
+	drained := srv.Drain()
+	srv.Resume()
+
+	select {
+	case <-drained:
+		t.Error("Drain() channel closed by Resume() while a command is running")
+	case <-time.After(3 * DRAIN_POLL_INTERVAL):
+	}
+
+	<-responses
+
+	// a stopping server can't be resumed, and only stops once the running command has finished
+	queue(2)
+	stopped := srv.Stop()
+	srv.Resume()
+
+	if !srv.isDraining() {
+		t.Error("Resume() should not resume a stopping server")
+	}
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() did not return")
+	}
+
+	if resp := <-responses; resp == nil || resp.Stdout != "done\n" {
+		t.Errorf("response of the command running during Stop() = %v, wanted done", resp)
+	}
+
+	// a server that is started again after stopping can be resumed
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() after Stop() error = %v", err)
+	}
+
+	srv.Drain()
+	srv.Resume()
+
+	if srv.isDraining() {
+		t.Error("Resume() should resume a server that was started again after stopping")
+	}
+
+	if err := <-srv.Stop(); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+const (
+	EXEC_PATH = "/v1/exec"
+	// EXEC_STREAM_PARAM selects the streaming of the output of the command (ex: ?stream=ndjson)
+	EXEC_STREAM_PARAM   = "stream"
+	EXEC_STREAM_NDJSON  = "ndjson"
+	CONTENT_TYPE_NDJSON = "application/x-ndjson"
+	// EXEC_MAX_BODY_SIZE is the largest body of an exec request when maxMessageSize isn't set
+	EXEC_MAX_BODY_SIZE = 1 << 20
+
+	REJECTION_INVALID_REQUEST = "invalid_request"
+	REJECTION_QUEUE_FULL      = "queue_full"
+)
+
+// registerExecRoutes registers the REST endpoint that runs a command without a websocket connection
+func (s *server) registerExecRoutes(router *mux.Router) {
+	s.handleCors(router, EXEC_PATH, http.HandlerFunc(s.execHandler), http.MethodPost)
+}
+
+// execHandler runs the command of a message (the same JSON as a websocket message) and answers with its response.  The
+// request is authenticated like a websocket upgrade and the message goes through the same checks and command queue as
+// the messages of websocket connections.
+func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
+	sess := s.authenticateRequest(w, r)
+
+	if sess == nil {
+		return
+	}
+
+	// an exec request holds a connection for as long as its command runs
+	if !s.acquireConnection(w, r, sess.remoteIp) {
+		return
+	}
+
+	defer s.connLimiter.release(sess.remoteIp)
+
+	// requests that are being answered are waited for by a drain
+	atomic.AddInt32(&s.inFlightMessages, 1)
+	defer atomic.AddInt32(&s.inFlightMessages, -1)
+
+	maxSize := int64(EXEC_MAX_BODY_SIZE)
+
+	if s.conf.MaxMessageSize > 0 {
+		maxSize = int64(s.conf.MaxMessageSize)
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+
+	if err != nil {
+		s.writeJson(w, http.StatusRequestEntityTooLarge, message.Rejection{Reason: REJECTION_INVALID_REQUEST, Error: err.Error()})
+		return
+	}
+
+	m := message.Message{}
+
+	if err := json.Unmarshal(body, &m); err != nil {
+		s.writeJson(w, http.StatusBadRequest, message.Rejection{Reason: REJECTION_INVALID_REQUEST, Error: "invalid message: " + err.Error()})
+		return
+	}
+
+	if !m.IsCommand() {
+		s.writeJson(w, http.StatusBadRequest, message.Rejection{Reason: REJECTION_INVALID_REQUEST, Error: "only commands can be run on " + EXEC_PATH})
+		return
+	}
+
+	var stream *execStream
+
+	if wantsStream(r) {
+		stream = newExecStream(w)
+		sess.output = stream.output
+	}
+
+	s.logger.Debug("received exec request from client", zap.String("key", sess.key), zap.ByteString("message", body))
+
+	resp, err := s.handleMessage(string(body), sess)
+
+	if err != nil {
+		s.logger.Error("Error answering exec request", zap.Error(err), zap.String("key", sess.key), zap.String("remoteAddr", r.RemoteAddr))
+		s.rejectExec(w, err)
+		return
+	}
+
+	if stream != nil {
+		stream.finish(execStatus(resp), resp)
+		return
+	}
+
+	s.writeJson(w, execStatus(resp), resp)
+}
+
+// rejectExec answers an exec request whose message couldn't be handled
+func (s *server) rejectExec(w http.ResponseWriter, err error) {
+	cause := errors.Cause(err)
+
+	switch {
+	case cause == errQueueFull:
+		w.Header().Set("Retry-After", "1")
+		s.writeJson(w, http.StatusServiceUnavailable, message.Rejection{Reason: REJECTION_QUEUE_FULL, Error: err.Error()})
+	case authFailureReason(cause) != AUTH_FAILURE_ERROR:
+		// the message signature was missing or invalid
+		s.rejectAuthentication(w, cause)
+	default:
+		s.writeJson(w, http.StatusInternalServerError, message.Rejection{Reason: AUTH_FAILURE_ERROR, Error: http.StatusText(http.StatusInternalServerError)})
+	}
+}
+
+// execStatus is the HTTP status of the response to an exec request (the messages that didn't run tell why in their
+// status)
+func execStatus(resp *message.Response) int {
+	switch resp.Status {
+	case message.STATUS_DRAINING, message.STATUS_CANCELED:
+		return http.StatusServiceUnavailable
+	case message.STATUS_RATE_LIMITED:
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusOK
+}
+
+// wantsStream tells whether the client of an exec request wants the output of the command as an NDJSON stream
+func wantsStream(r *http.Request) bool {
+	if r.URL.Query().Get(EXEC_STREAM_PARAM) == EXEC_STREAM_NDJSON {
+		return true
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), CONTENT_TYPE_NDJSON)
+}
+
+// execStream writes the output of a command as it is written, one message.ExecEvent per line.  The response starts
+// with the first line so that errors that happen before the command runs are still answered with their own status.
+type execStream struct {
+	w       http.ResponseWriter
+	started bool
+	lock    sync.Mutex
+}
+
+func newExecStream(w http.ResponseWriter) *execStream {
+	return &execStream{w: w}
+}
+
+// output writes a chunk of the output of the command
+func (st *execStream) output(stream string, data []byte) {
+	st.write(http.StatusOK, message.ExecEvent{Stream: stream, Data: string(data)})
+}
+
+// finish writes the response of the command, which ends the stream
+func (st *execStream) finish(code int, resp *message.Response) {
+	st.write(code, message.ExecEvent{Response: resp})
+}
+
+func (st *execStream) write(code int, event message.ExecEvent) {
+	line, err := json.Marshal(event)
+
+	if err != nil {
+		return
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if !st.started {
+		st.started = true
+		st.w.Header().Set("Content-Type", CONTENT_TYPE_NDJSON)
+		st.w.WriteHeader(code)
+	}
+
+	// a client that went away doesn't stop the command
+	_, _ = st.w.Write(append(line, '\n'))
+
+	if f, ok := st.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestServer_Exec(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	url := "http://" + srv.listeners[0].Addr().String() + EXEC_PATH
+
+	exec := func(body string, signed bool, accept string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+
+		if signed {
+			sig, err := auth.CreateSig("client", filepath.Join("..", "..", "test", "client", "keys"), "")
+
+			if err != nil {
+				t.Fatalf("CreateSig() error = %v", err)
+			}
+
+			req.Header.Set(auth.HEADER_NAME, sig)
+		}
+
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("POST %s error = %v", EXEC_PATH, err)
+		}
+
+		return resp
+	}
+
+	t.Run("runs the command", func(t *testing.T) {
+		resp := exec(`{"id": 1, "command": "echo hello"}`, true, "")
+		defer resp.Body.Close()
+
+		var got message.Response
+
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s = %d %v, wanted 200 with a response", EXEC_PATH, resp.StatusCode, err)
+		}
+
+		if got.Id != "1" || got.Stdout != "hello\n" || got.ExitCode != 0 {
+			t.Errorf("response = %+v, wanted id 1 with hello", got)
+		}
+	})
+
+	t.Run("streams the output", func(t *testing.T) {
+		resp := exec(`{"id": 2, "command": "echo out; echo err >&2"}`, true, CONTENT_TYPE_NDJSON)
+		defer resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != CONTENT_TYPE_NDJSON {
+			t.Errorf("Content-Type = %q, wanted %q", ct, CONTENT_TYPE_NDJSON)
+		}
+
+		output := map[string]string{}
+		var last message.ExecEvent
+
+		scanner := bufio.NewScanner(resp.Body)
+
+		for scanner.Scan() {
+			last = message.ExecEvent{}
+
+			if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+				t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+			}
+
+			output[last.Stream] += last.Data
+		}
+
+		if output[message.STREAM_STDOUT] != "out\n" || output[message.STREAM_STDERR] != "err\n" {
+			t.Errorf("streamed output = %v, wanted out and err", output)
+		}
+
+		if last.Response == nil || last.Response.Stdout != "out\n" || last.Response.ExitCode != 0 {
+			t.Errorf("last line = %+v, wanted the response of the command", last)
+		}
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		resp := exec(`{"id": 3, "command": "echo hello"}`, false, "")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("POST %s without a signature = %d, wanted %d", EXEC_PATH, resp.StatusCode, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("only runs commands", func(t *testing.T) {
+		resp := exec(`{"id": 4, "type": "facts"}`, true, "")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %s of a facts message = %d, wanted %d", EXEC_PATH, resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("refuses commands while draining", func(t *testing.T) {
+		atomic.StoreInt32(&srv.draining, 1)
+		defer atomic.StoreInt32(&srv.draining, 0)
+
+		resp := exec(`{"id": 5, "command": "echo hello"}`, true, "")
+		defer resp.Body.Close()
+
+		var got message.Response
+
+		_ = json.NewDecoder(resp.Body).Decode(&got)
+
+		if resp.StatusCode != http.StatusServiceUnavailable || got.Status != message.STATUS_DRAINING {
+			t.Errorf("POST %s while draining = %d %q, wanted %d %q", EXEC_PATH, resp.StatusCode, got.Status, http.StatusServiceUnavailable, message.STATUS_DRAINING)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"strconv"
+
+	"go.uber.org/zap"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/pkg/facts"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+// handleFacts answers a facts message directly (facts are gathered without using the command queue or a shell)
+func (s *server) handleFacts(msg rc_protocol.Message) *message.Response {
+	f, err := facts.Gather(s.conf.Version, s.conf.FactsDir)
+
+	resp := message.Response{
+		Response: rc_protocol.Response{
+			Id:       strconv.Itoa(msg.Id),
+			ExitCode: 0,
+		},
+		Facts: f,
+	}
+
+	if err != nil {
+		// partial facts are still returned, the errors are reported to the client on stderr
+		s.logger.Warn("Error gathering facts", zap.Error(err))
+		resp.Stderr = err.Error()
+	}
+
+	return &resp
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/message"
+	"github.com/cthayer/remote_control/pkg/rpc"
+)
+
+// rpcService is the gRPC API (see pkg/rpc).  Its RPCs go through the same authentication, limits and command queue as
+// the messages of websocket connections.
+type rpcService struct {
+	rpc.UnimplementedRemoteControlServer
+	srv *server
+}
+
+// startGrpcServer serves the gRPC API on grpcHost:grpcPort (when grpcPort is set).  The listener uses the TLS key pair
+// and client CA of the main listener, if any.
+func (s *server) startGrpcServer() error {
+	s.grpcSrv = nil
+
+	if s.conf.GrpcPort == 0 {
+		return nil
+	}
+
+	address := s.conf.GrpcHost + ":" + strconv.Itoa(s.conf.GrpcPort)
+
+	var opts []grpc.ServerOption
+
+	useTls := s.conf.TlsCertFile != "" && s.conf.TlsKeyFile != ""
+
+	if useTls {
+		lc := config.Listener{Address: address, TlsCertFile: s.conf.TlsCertFile, TlsKeyFile: s.conf.TlsKeyFile, TlsClientCaFile: s.conf.TlsClientCaFile}
+
+		tlsConfig, err := s.tlsConfig(lc, s.cipherSuites())
+
+		if err != nil {
+			return err
+		}
+
+		// gRPC negotiates HTTP/2
+		tlsConfig.NextProtos = nil
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	if s.conf.MaxMessageSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(s.conf.MaxMessageSize))
+	}
+
+	socket, err := s.listenTcp(address)
+
+	if err != nil {
+		return errors.Wrap(err, "failed to listen on "+address)
+	}
+
+	grpcSrv := grpc.NewServer(opts...)
+	rpc.RegisterRemoteControlServer(grpcSrv, &rpcService{srv: s})
+
+	s.grpcSrv = grpcSrv
+	s.auxListeners = append(s.auxListeners, &listener{Listener: socket, conf: config.Listener{Address: address}})
+
+	s.logger.Info("gRPC server listening", zap.String("listen address", address), zap.Bool("tls", useTls))
+
+	s.waitGroup.Add(1)
+	go func() {
+		defer s.waitGroup.Done()
+
+		if err := grpcSrv.Serve(socket); err != nil && err != grpc.ErrServerStopped {
+			s.logger.Error("Error serving gRPC requests", zap.Error(err), zap.String("listen address", address))
+		}
+	}()
+
+	return nil
+}
+
+// stopGrpcServer stops accepting RPCs and waits for the running ones to finish (until ctx is done)
+func (s *server) stopGrpcServer(ctx context.Context) {
+	if s.grpcSrv == nil {
+		return
+	}
+
+	stopped := make(chan struct{})
+
+	go func() {
+		s.grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcSrv.Stop()
+	}
+}
+
+// grpcRequest describes the connection and metadata of an RPC as an HTTP request so that the client is authenticated
+// the same way as a websocket upgrade
+func grpcRequest(ctx context.Context) *http.Request {
+	r := (&http.Request{Header: http.Header{}}).WithContext(ctx)
+
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := info.State
+			r.TLS = &state
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for _, name := range []string{auth.HEADER_NAME, auth.CERTIFICATE_HEADER_NAME} {
+		if values := md.Get(name); len(values) > 0 {
+			r.Header.Set(name, values[0])
+		}
+	}
+
+	return r
+}
+
+// session authenticates the client of an RPC
+func (svc *rpcService) session(ctx context.Context) (*session, error) {
+	s := svc.srv
+	r := grpcRequest(ctx)
+	ip := remoteIp(r)
+
+	if reason, retryAfter := s.requestLimit(ip); reason != "" {
+		return nil, svc.reject(r, reason, retryAfter)
+	}
+
+	identity, err := s.authenticate(r)
+
+	if err != nil {
+		s.authenticationFailed(r, identity, err, ip)
+		return nil, authStatus(err)
+	}
+
+	return s.newSession(r, identity, ip), nil
+}
+
+// reject refuses an RPC because of the limits
+func (svc *rpcService) reject(r *http.Request, reason string, retryAfter time.Duration) error {
+	s := svc.srv
+
+	s.logger.Debug("Rejecting RPC", zap.String("reason", reason), zap.String("remoteAddr", r.RemoteAddr), zap.Int64("retryAfterMs", retryAfter.Milliseconds()))
+	s.metrics.limitRejections.WithLabelValues(reason).Inc()
+
+	return status.Errorf(codes.ResourceExhausted, "%s, retry after %d seconds", reason, int(math.Ceil(retryAfter.Seconds())))
+}
+
+// authStatus is the gRPC status of an authentication failure: UNAUTHENTICATED when the client didn't prove who it is
+// and PERMISSION_DENIED when its key (or certificate) isn't allowed to connect
+func authStatus(err error) error {
+	reason := authFailureReason(err)
+	msg := AUTH_FAILURE_MESSAGE
+
+	if reason != AUTH_FAILURE_ERROR {
+		msg = err.Error()
+	}
+
+	if authFailureStatus(reason) == http.StatusForbidden {
+		return status.Error(codes.PermissionDenied, msg)
+	}
+
+	return status.Error(codes.Unauthenticated, msg)
+}
+
+// messageStatus is the gRPC status of a message that couldn't be handled
+func messageStatus(err error) error {
+	cause := errors.Cause(err)
+
+	switch {
+	case cause == errQueueFull:
+		return status.Error(codes.Unavailable, err.Error())
+	case authFailureReason(cause) != AUTH_FAILURE_ERROR:
+		// the message signature was missing or invalid
+		return authStatus(cause)
+	}
+
+	return status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError))
+}
+
+// responseStatus is the gRPC status of a message that the server didn't handle (nil for the others)
+func responseStatus(resp *message.Response) error {
+	switch resp.Status {
+	case message.STATUS_DRAINING:
+		return status.Error(codes.Unavailable, resp.Stderr)
+	case message.STATUS_CANCELED, message.STATUS_KILLED:
+		return status.Error(codes.Canceled, resp.Stderr)
+	case message.STATUS_RATE_LIMITED:
+		return status.Error(codes.ResourceExhausted, resp.Stderr)
+	}
+
+	return nil
+}
+
+// handleMessage handles the message of a request like a message from a websocket connection
+func (svc *rpcService) handleMessage(req rpc.SignedRequest, sess *session) (*message.Response, error) {
+	jsonStr, err := json.Marshal(req.Message())
+
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp, err := svc.srv.handleMessage(string(jsonStr), sess)
+
+	if err != nil {
+		svc.srv.logger.Error("Error answering RPC", zap.Error(err), zap.String("key", sess.key))
+		return nil, messageStatus(err)
+	}
+
+	return resp, responseStatus(resp)
+}
+
+func (svc *rpcService) Exec(req *rpc.ExecRequest, stream rpc.RemoteControl_ExecServer) error {
+	s := svc.srv
+	ctx := stream.Context()
+
+	sess, err := svc.session(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// an Exec RPC holds a connection for as long as its command runs
+	if reason := s.connLimiter.acquire(sess.remoteIp); reason != "" {
+		return svc.reject(grpcRequest(ctx), reason, CONNECTION_RETRY_AFTER)
+	}
+
+	defer s.connLimiter.release(sess.remoteIp)
+
+	// RPCs that are being answered are waited for by a drain
+	atomic.AddInt32(&s.inFlightMessages, 1)
+	defer atomic.AddInt32(&s.inFlightMessages, -1)
+
+	var lock sync.Mutex
+	var sendErr error
+
+	send := func(event *rpc.ExecEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		// a client that went away doesn't stop the command (unless it canceled the RPC)
+		if sendErr == nil {
+			sendErr = stream.Send(event)
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	sess.queued = func(jobId uint64) {
+		send(&rpc.ExecEvent{Event: &rpc.ExecEvent_JobId{JobId: jobId}})
+
+		// the command is killed when the client gives up on it (ex: the deadline of the RPC is exceeded)
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = s.killJob(jobId, "")
+			case <-done:
+			}
+		}()
+	}
+
+	sess.output = func(name string, data []byte) {
+		send(&rpc.ExecEvent{Event: &rpc.ExecEvent_Output{Output: &rpc.Output{Stream: name, Data: data}}})
+	}
+
+	resp, err := svc.handleMessage(req, sess)
+
+	if err != nil {
+		return err
+	}
+
+	send(&rpc.ExecEvent{Event: &rpc.ExecEvent_Result{Result: &rpc.Result{
+		Id:       resp.Id,
+		Stdout:   resp.Stdout,
+		Stderr:   resp.Stderr,
+		ExitCode: int32(resp.ExitCode),
+		Signal:   resp.Signal,
+	}}})
+
+	return sendErr
+}
+
+func (svc *rpcService) Cancel(ctx context.Context, req *rpc.CancelRequest) (*rpc.CancelResponse, error) {
+	sess, err := svc.session(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	svc.srv.logger.Info("Canceling command", zap.Uint64("id", req.GetJobId()), zap.String("key", sess.key))
+
+	switch err := svc.srv.killJob(req.GetJobId(), sess.key); err {
+	case nil:
+		return &rpc.CancelResponse{}, nil
+	case errJobNotFound:
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errJobNotStarted:
+		return nil, status.Error(codes.Unavailable, err.Error())
+	default:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (svc *rpcService) Facts(ctx context.Context, req *rpc.FactsRequest) (*rpc.FactsResponse, error) {
+	sess, err := svc.session(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := svc.handleMessage(req, sess)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := rpc.NewFacts(resp.Facts)
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &rpc.FactsResponse{Facts: f, Errors: resp.Stderr}, nil
+}
+
+func (svc *rpcService) JobStatus(ctx context.Context, req *rpc.JobStatusRequest) (*rpc.JobStatusResponse, error) {
+	sess, err := svc.session(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := svc.srv.getJob(req.GetJobId(), sess.key)
+
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	resp := rpc.JobStatusResponse{
+		JobId:   info.Id,
+		Command: info.Command,
+		State:   info.State,
+		Pid:     int32(info.Pid),
+	}
+
+	resp.Queued, _ = ptypes.TimestampProto(info.Queued)
+
+	if info.Started != nil {
+		resp.Started, _ = ptypes.TimestampProto(*info.Started)
+	}
+
+	return &resp, nil
+}
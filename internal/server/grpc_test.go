@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/rpc"
+)
+
+func TestServer_Grpc(t *testing.T) {
+	// find a free port for the gRPC listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+	conf.GrpcHost = "127.0.0.1"
+	conf.GrpcPort = port
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	signer, err := auth.NewSigner("client", filepath.Join("..", "..", "test", "client", "keys"))
+
+	if err != nil {
+		t.Fatalf("Error loading client key: %v", err)
+	}
+
+	address := "127.0.0.1:" + strconv.Itoa(port)
+
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithPerRPCCredentials(rpc.NewCredentials(signer, nil, "127.0.0.1").AllowInsecure()))
+
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	defer conn.Close()
+
+	c := rpc.NewRemoteControlClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("Exec streams the output", func(t *testing.T) {
+		stream, err := c.Exec(ctx, &rpc.ExecRequest{Id: 1, Command: "echo out; echo err >&2"})
+
+		if err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+
+		var jobId uint64
+		var result *rpc.Result
+		output := map[string]string{}
+
+		for {
+			event, err := stream.Recv()
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatalf("Recv() error = %v", err)
+			}
+
+			switch e := event.Event.(type) {
+			case *rpc.ExecEvent_JobId:
+				jobId = e.JobId
+			case *rpc.ExecEvent_Output:
+				output[e.Output.Stream] += string(e.Output.Data)
+			case *rpc.ExecEvent_Result:
+				result = e.Result
+			}
+		}
+
+		if jobId == 0 {
+			t.Error("Exec() didn't send the id of the job")
+		}
+
+		if output["stdout"] != "out\n" || output["stderr"] != "err\n" {
+			t.Errorf("streamed output = %v, wanted out and err", output)
+		}
+
+		if result == nil || result.Id != "1" || result.Stdout != "out\n" || result.ExitCode != 0 {
+			t.Errorf("result = %v, wanted id 1 with out", result)
+		}
+	})
+
+	t.Run("Cancel kills the command", func(t *testing.T) {
+		stream, err := c.Exec(ctx, &rpc.ExecRequest{Id: 2, Command: "sleep 10"})
+
+		if err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+
+		event, err := stream.Recv()
+
+		if err != nil || event.GetJobId() == 0 {
+			t.Fatalf("Recv() = %v, %v, wanted the id of the job", event, err)
+		}
+
+		jobId := event.GetJobId()
+
+		// the process of the command is known once it has started
+		for i := 0; i < 100; i++ {
+			if status, err := c.JobStatus(ctx, &rpc.JobStatusRequest{JobId: jobId}); err == nil && status.Pid != 0 {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if _, err := c.Cancel(ctx, &rpc.CancelRequest{JobId: jobId}); err != nil {
+			t.Fatalf("Cancel() error = %v", err)
+		}
+
+		event, err = stream.Recv()
+
+		if err != nil || event.GetResult() == nil || event.GetResult().ExitCode == 0 {
+			t.Errorf("Recv() after Cancel() = %v, %v, wanted the result of a killed command", event, err)
+		}
+
+		if _, err := c.JobStatus(ctx, &rpc.JobStatusRequest{JobId: jobId}); status.Code(err) != codes.NotFound {
+			t.Errorf("JobStatus() of a finished command error = %v, wanted %v", err, codes.NotFound)
+		}
+	})
+
+	t.Run("Facts", func(t *testing.T) {
+		resp, err := c.Facts(ctx, &rpc.FactsRequest{Id: 3})
+
+		if err != nil || resp.GetFacts().GetHostname() == "" {
+			t.Errorf("Facts() = %v, %v, wanted the facts of the server", resp, err)
+		}
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		unauthenticated, err := grpc.Dial(address, grpc.WithInsecure())
+
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+
+		defer unauthenticated.Close()
+
+		if _, err := rpc.NewRemoteControlClient(unauthenticated).Facts(ctx, &rpc.FactsRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Facts() without a signature error = %v, wanted %v", err, codes.Unauthenticated)
+		}
+	})
+
+	t.Run("signed messages", func(t *testing.T) {
+		srv.conf.MessageSigning = config.MESSAGE_SIGNING_REQUIRED
+		defer func() { srv.conf.MessageSigning = conf.MessageSigning }()
+
+		if _, err := c.Facts(ctx, &rpc.FactsRequest{Id: 4}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Facts() of an unsigned message error = %v, wanted %v", err, codes.Unauthenticated)
+		}
+
+		req := &rpc.FactsRequest{Id: 5}
+		signedCtx, err := rpc.NewCredentials(signer, nil, "127.0.0.1").Sign(ctx, req)
+
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+
+		if _, err := c.Facts(signedCtx, req); err != nil {
+			t.Errorf("Facts() of a signed message error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+)
+
+func TestServer_Handover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-handover")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{
+		{Address: "127.0.0.1:0"},
+		{Address: config.LISTEN_ADDRESS_UNIX_PREFIX + filepath.Join(dir, "rc.sock")},
+	}
+	conf.UnixSocketAllow = []string{strconv.Itoa(os.Getuid())}
+
+	oldSrv := NewServer(&conf).(*server)
+
+	if err := <-oldSrv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	addr := oldSrv.listeners[0].Addr().(*net.TCPAddr)
+
+	// connect continuously during the handover
+	var wg sync.WaitGroup
+	var refused []error
+	stop := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			conn, err := net.Dial("tcp", addr.String())
+
+			if err != nil {
+				refused = append(refused, err)
+				continue
+			}
+
+			_ = conn.Close()
+		}
+	}()
+
+	files, addresses, err := oldSrv.ListenerFiles()
+
+	if err != nil {
+		t.Fatalf("ListenerFiles() error = %v", err)
+	}
+
+	newSrv := NewServer(&conf).(*server)
+	newSrv.inherited = map[string][]*os.File{}
+
+	for i, address := range addresses {
+		newSrv.inherited[address] = append(newSrv.inherited[address], files[i])
+	}
+
+	if err := <-newSrv.Start(); err != nil {
+		t.Fatalf("Start() of the new server error = %v", err)
+	}
+
+	oldSrv.KeepSocketFiles()
+
+	defer func() {
+		if err := <-newSrv.Stop(); err != nil {
+			t.Errorf("Stop() of the new server error = %v", err)
+		}
+	}()
+
+	if err := <-oldSrv.Stop(); err != nil {
+		t.Errorf("Stop() of the old server error = %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if len(refused) > 0 {
+		t.Errorf("%d connection attempts failed during the handover, first: %v", len(refused), refused[0])
+	}
+
+	// the new server answers on the sockets of the old one
+	clientConf := *client_config.GetConfig()
+	clientConf.Host = addr.IP.String()
+	clientConf.Port = addr.Port
+	clientConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	clientConf.KeyName = "client"
+	clientConf.TlsDisable = true
+
+	unixConf := *client_config.GetConfig()
+	unixConf.Host = client.UNIX_SOCKET_PREFIX + filepath.Join(dir, "rc.sock")
+	unixConf.KeyName = ""
+
+	for _, cc := range []client_config.Config{clientConf, unixConf} {
+		c := client.NewClient(cc)
+
+		if err := <-c.Start(); err != nil {
+			t.Errorf("Error connecting to %s after the handover: %v", cc.Host, err)
+			continue
+		}
+
+		validateResponse(t, <-c.Send("echo new", rc_protocol.MessageOptions{}), "new\n", "", 0)
+		<-c.Stop()
+	}
+}
+
+func TestServer_ListenerFiles_Failed_Handover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-handover")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rc.sock")
+
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: config.LISTEN_ADDRESS_UNIX_PREFIX + path}}
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	files, _, err := srv.ListenerFiles()
+
+	if err != nil {
+		t.Fatalf("ListenerFiles() error = %v", err)
+	}
+
+	// no new process took the sockets over
+	for _, f := range files {
+		_ = f.Close()
+	}
+
+	if err := <-srv.Stop(); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("unix socket file after a failed handover: %v, wanted it to be removed", err)
+	}
+}
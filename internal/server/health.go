@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	HEALTH_STATUS_OK          = "ok"
+	HEALTH_STATUS_UNAVAILABLE = "unavailable"
+)
+
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+type readyStatus struct {
+	Status           string     `json:"status"`
+	Reasons          []string   `json:"reasons,omitempty"`
+	QueueDepth       int        `json:"queueDepth"`
+	QueueCapacity    int        `json:"queueCapacity"`
+	RunningCommands  int        `json:"runningCommands"`
+	Workers          int        `json:"workers"`
+	WorkerSaturation float64    `json:"workerSaturation"`
+	TlsCertExpiry    *time.Time `json:"tlsCertExpiry,omitempty"`
+	Draining         bool       `json:"draining"`
+}
+
+// registerHealthRoutes adds the (unauthenticated) health and readiness endpoints to router
+func (s *server) registerHealthRoutes(router *mux.Router) {
+	s.handleCors(router, s.conf.HealthPath, http.HandlerFunc(s.healthHandler), http.MethodGet, http.MethodHead)
+	s.handleCors(router, s.conf.ReadyPath, http.HandlerFunc(s.readyHandler), http.MethodGet, http.MethodHead)
+}
+
+func (s *server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJson(w, http.StatusOK, healthStatus{Status: HEALTH_STATUS_OK})
+}
+
+func (s *server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	status := s.readiness()
+	code := http.StatusOK
+
+	if status.Status != HEALTH_STATUS_OK {
+		code = http.StatusServiceUnavailable
+	}
+
+	s.writeJson(w, code, status)
+}
+
+func (s *server) readiness() readyStatus {
+	status := readyStatus{
+		Status:          HEALTH_STATUS_OK,
+		QueueDepth:      len(s.cmdQueue),
+		QueueCapacity:   cap(s.cmdQueue),
+		RunningCommands: int(atomic.LoadInt32(&s.runningCommands)),
+		Workers:         MAX_CONCURRENT_COMMANDS,
+		Draining:        s.isDraining(),
+	}
+
+	status.WorkerSaturation = float64(status.RunningCommands) / float64(status.Workers)
+
+	if expiry := s.getTlsCertExpiry(); !expiry.IsZero() {
+		status.TlsCertExpiry = &expiry
+
+		if time.Now().After(expiry) {
+			status.Reasons = append(status.Reasons, "tls certificate expired")
+		}
+	}
+
+	if status.Draining {
+		status.Reasons = append(status.Reasons, "draining")
+	}
+
+	if status.QueueDepth >= status.QueueCapacity && status.RunningCommands >= status.Workers {
+		status.Reasons = append(status.Reasons, "command queue full")
+	}
+
+	if len(status.Reasons) > 0 {
+		status.Status = HEALTH_STATUS_UNAVAILABLE
+	}
+
+	return status
+}
+
+func (s *server) writeJson(w http.ResponseWriter, code int, body interface{}) {
+	jsonResp, err := json.Marshal(body)
+
+	if err != nil {
+		s.logger.Error("Error marshalling json response", zap.Error(err), zap.Any("body", body))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_, _ = w.Write(jsonResp)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cthayer/remote_control/internal/config"
+)
+
+func TestServer_Ready(t *testing.T) {
+	conf := *config.GetConfig()
+
+	srv := NewServer(&conf).(*server)
+
+	status := getReadyStatus(t, srv, http.StatusOK)
+
+	if status.Status != HEALTH_STATUS_OK || status.Workers != MAX_CONCURRENT_COMMANDS || status.QueueCapacity != COMMAND_QUEUE_MAX_BACKLOG {
+		t.Errorf("Invalid readiness status: %v", status)
+	}
+
+	// a draining server is not ready
+	srv.draining = 1
+
+	status = getReadyStatus(t, srv, http.StatusServiceUnavailable)
+
+	if status.Status != HEALTH_STATUS_UNAVAILABLE || !status.Draining {
+		t.Errorf("Draining server should not be ready: %v", status)
+	}
+}
+
+func TestServer_Health_Separate_Listener(t *testing.T) {
+	conf := *config.GetConfig()
+
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.HealthHost = "localhost"
+	conf.HealthPort = 4516
+
+	srv := NewServer(&conf)
+
+	if err := <-srv.Start(); err != nil {
+		t.Errorf("Error starting server: %v", err)
+		return
+	}
+
+	defer stopServer(t, &srv)
+
+	for _, path := range []string{conf.HealthPath, conf.ReadyPath} {
+		resp, err := http.Get("http://localhost:4516" + path)
+
+		if err != nil {
+			t.Errorf("Error requesting %s: %v", path, err)
+			continue
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s status = %d, wanted %d", path, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
+
+func getReadyStatus(t *testing.T, srv *server, expectedCode int) readyStatus {
+	var status readyStatus
+
+	w := httptest.NewRecorder()
+
+	srv.readyHandler(w, httptest.NewRequest(http.MethodGet, srv.conf.ReadyPath, nil))
+
+	if w.Code != expectedCode {
+		t.Errorf("readyHandler() status = %d, wanted %d", w.Code, expectedCode)
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Errorf("Invalid readiness response: %v", err)
+	}
+
+	return status
+}
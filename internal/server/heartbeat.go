@@ -0,0 +1,120 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	CLOSE_REASON_IDLE_TIMEOUT = "idle timeout"
+)
+
+// heartbeat pings the client of a websocket connection and closes the connection when the client stops answering or
+// when the connection has been idle for too long
+type heartbeat struct {
+	conn         *websocket.Conn
+	interval     time.Duration
+	timeout      time.Duration
+	idleTimeout  time.Duration
+	lastActivity int64
+	busy         int32
+	done         chan struct{}
+}
+
+func (s *server) startHeartbeat(conn *websocket.Conn) *heartbeat {
+	hb := heartbeat{
+		conn:         conn,
+		interval:     time.Duration(s.conf.EngineOptions.PingInterval) * time.Millisecond,
+		timeout:      time.Duration(s.conf.EngineOptions.PingTimeout) * time.Millisecond,
+		idleTimeout:  time.Duration(s.conf.IdleTimeout) * time.Millisecond,
+		lastActivity: time.Now().UnixNano(),
+		done:         make(chan struct{}),
+	}
+
+	// any pong from the client proves that the connection is still alive
+	conn.SetPongHandler(func(string) error {
+		return hb.extendReadDeadline()
+	})
+
+	period := hb.interval
+
+	if period <= 0 {
+		period = hb.idleTimeout
+	}
+
+	if period > 0 {
+		go hb.run(s, period)
+	}
+
+	return &hb
+}
+
+func (hb *heartbeat) run(s *server, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hb.done:
+			return
+		case <-ticker.C:
+		}
+
+		if hb.isIdle() {
+			s.logger.Info("Closing idle websocket connection", zap.Int64("idleTimeoutMs", hb.idleTimeout.Milliseconds()), zap.Any("conn", hb.conn))
+
+			_ = hb.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, CLOSE_REASON_IDLE_TIMEOUT), time.Now().Add(hb.timeout))
+			_ = hb.conn.Close()
+
+			return
+		}
+
+		if hb.interval <= 0 {
+			continue
+		}
+
+		if err := hb.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(hb.timeout)); err != nil {
+			s.logger.Debug("Error sending ping", zap.Error(err), zap.Any("conn", hb.conn))
+			return
+		}
+	}
+}
+
+// beforeRead must be called before each read so that a read only fails when the client stops answering pings
+func (hb *heartbeat) beforeRead() error {
+	return hb.extendReadDeadline()
+}
+
+func (hb *heartbeat) extendReadDeadline() error {
+	if hb.interval <= 0 {
+		return nil
+	}
+
+	return hb.conn.SetReadDeadline(time.Now().Add(hb.interval + hb.timeout))
+}
+
+// setBusy marks the connection as (not) handling a message.  Connections are never idle while handling a message.
+func (hb *heartbeat) setBusy(busy bool) {
+	if busy {
+		atomic.StoreInt32(&hb.busy, 1)
+	} else {
+		atomic.StoreInt32(&hb.busy, 0)
+	}
+
+	atomic.StoreInt64(&hb.lastActivity, time.Now().UnixNano())
+}
+
+func (hb *heartbeat) isIdle() bool {
+	if hb.idleTimeout <= 0 || atomic.LoadInt32(&hb.busy) == 1 {
+		return false
+	}
+
+	return time.Since(time.Unix(0, atomic.LoadInt64(&hb.lastActivity))) > hb.idleTimeout
+}
+
+func (hb *heartbeat) stop() {
+	close(hb.done)
+}
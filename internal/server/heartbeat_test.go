@@ -0,0 +1,62 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+)
+
+func TestServer_Idle_Timeout(t *testing.T) {
+	conf := *config.GetConfig()
+
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.IdleTimeout = 100
+	conf.EngineOptions.PingInterval = 50
+
+	srv := NewServer(&conf)
+
+	if err := <-srv.Start(); err != nil {
+		t.Errorf("Error starting server: %v", err)
+		return
+	}
+
+	defer stopServer(t, &srv)
+
+	clientConf := *client_config.GetConfig()
+	clientConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	clientConf.KeyName = "client"
+	clientConf.TlsDisable = true
+	clientConf.PingInterval = 0
+
+	c := client.NewClient(clientConf)
+
+	if err := <-c.Start(); err != nil {
+		t.Errorf("Error connecting to server: %v", err)
+		return
+	}
+
+	defer c.Stop()
+
+	// the server answers while the connection is active
+	validateResponse(t, <-c.Send("echo hello", rc_protocol.MessageOptions{}), "hello\n", "", 0)
+
+	// and closes the connection once it has been idle for too long
+	<-time.After(300 * time.Millisecond)
+
+	select {
+	case resp := <-c.Send("echo hello", rc_protocol.MessageOptions{}):
+		if resp != nil {
+			t.Errorf("Wanted the idle connection to be closed, got: %v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Error("Idle connection was not closed")
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errJobNotFound   = errors.New("command not found")
+	errJobNotStarted = errors.New("command has not started its process yet")
+)
+
+// job is a command that is queued or running
+type job struct {
+	id       uint64
+	key      string
+	command  string
+	queued   time.Time
+	started  time.Time
+	process  *os.Process
+	canceled bool
+}
+
+// jobInfo describes a job for the admin API
+type jobInfo struct {
+	Id         uint64     `json:"id"`
+	Key        string     `json:"key"`
+	Command    string     `json:"command"`
+	State      string     `json:"state"`
+	Pid        int        `json:"pid,omitempty"`
+	Queued     time.Time  `json:"queued"`
+	Started    *time.Time `json:"started,omitempty"`
+	AgeSeconds float64    `json:"ageSeconds"`
+}
+
+const (
+	JOB_STATE_QUEUED  = "queued"
+	JOB_STATE_RUNNING = "running"
+)
+
+func (s *server) addJob(key string, cmd string) *job {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+
+	s.lastJobId++
+
+	j := job{
+		id:      s.lastJobId,
+		key:     key,
+		command: cmd,
+		queued:  time.Now(),
+	}
+
+	s.jobs[j.id] = &j
+
+	return &j
+}
+
+func (s *server) removeJob(j *job) {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+
+	delete(s.jobs, j.id)
+}
+
+// startJob marks a job as running.  It returns false for a job that has been canceled while it was queued.
+func (s *server) startJob(j *job) bool {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+
+	if j.canceled {
+		return false
+	}
+
+	j.started = time.Now()
+
+	return true
+}
+
+func (s *server) setJobProcess(j *job, p *os.Process) {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+
+	j.process = p
+}
+
+// findJob returns the job with the given id.  The jobs of other keys aren't found unless key is "" (ex: for the admin
+// API).  The jobLock must be held.
+func (s *server) findJob(id uint64, key string) (*job, error) {
+	j, ok := s.jobs[id]
+
+	if !ok || (key != "" && j.key != key) {
+		return nil, errJobNotFound
+	}
+
+	return j, nil
+}
+
+// killJob kills the process of a running job or cancels a queued one (which is answered when a worker takes it)
+func (s *server) killJob(id uint64, key string) error {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+
+	j, err := s.findJob(id, key)
+
+	if err != nil {
+		return err
+	}
+
+	if j.started.IsZero() {
+		j.canceled = true
+		return nil
+	}
+
+	if j.process == nil {
+		return errJobNotStarted
+	}
+
+	return killProcess(j.process)
+}
+
+// listJobs returns the queued and running jobs, oldest first
+func (s *server) listJobs() []jobInfo {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+
+	now := time.Now()
+	jobs := make([]jobInfo, 0, len(s.jobs))
+
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.info(now))
+	}
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Id < jobs[k].Id
+	})
+
+	return jobs
+}
+
+// getJob describes the job with the given id (see findJob)
+func (s *server) getJob(id uint64, key string) (jobInfo, error) {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+
+	j, err := s.findJob(id, key)
+
+	if err != nil {
+		return jobInfo{}, err
+	}
+
+	return j.info(time.Now()), nil
+}
+
+// info describes the job.  The jobLock must be held.
+func (j *job) info(now time.Time) jobInfo {
+	info := jobInfo{
+		Id:         j.id,
+		Key:        j.key,
+		Command:    j.command,
+		State:      JOB_STATE_QUEUED,
+		Queued:     j.queued,
+		AgeSeconds: now.Sub(j.queued).Seconds(),
+	}
+
+	if !j.started.IsZero() {
+		started := j.started
+
+		info.State = JOB_STATE_RUNNING
+		info.Started = &started
+		info.AgeSeconds = now.Sub(started).Seconds()
+	}
+
+	if j.process != nil {
+		info.Pid = j.process.Pid
+	}
+
+	return info
+}
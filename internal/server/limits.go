@@ -0,0 +1,391 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+const (
+	LIMIT_REASON_CONNECTIONS    = "too_many_connections"
+	LIMIT_REASON_IP_CONNECTIONS = "too_many_ip_connections"
+	LIMIT_REASON_IP_RATE        = "ip_rate_limited"
+	LIMIT_REASON_KEY_RATE       = "key_rate_limited"
+	LIMIT_REASON_LOCKED_OUT     = "locked_out"
+
+	// LIMITER_SWEEP_INTERVAL is how often the state of idle IP addresses and keys is dropped
+	LIMITER_SWEEP_INTERVAL = time.Minute
+	// CONNECTION_RETRY_AFTER is the Retry-After of a connection that was refused because of the connection limits
+	CONNECTION_RETRY_AFTER = 5 * time.Second
+	RATE_LIMITED_MESSAGE   = "rate limit exceeded, try again later"
+)
+
+// tokenBucket holds the tokens left for an IP address or key and when they were counted
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter is a token bucket per IP address or key.  A nil rateLimiter allows everything.
+type rateLimiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// newRateLimiter allows perMinute tokens per minute (and up to burst at once) for each IP address or key.  It returns
+// nil when perMinute is 0 (no limit).
+func newRateLimiter(perMinute int, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:      float64(perMinute) / time.Minute.Seconds(),
+		burst:     float64(burst),
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of name.  When there is none left, it returns false along with how long until
+// the next token.
+func (l *rateLimiter) allow(name string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[name]
+
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[name] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// sweep drops the buckets that have filled up again (they are the same as new ones)
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < LIMITER_SWEEP_INTERVAL {
+		return
+	}
+
+	l.lastSweep = now
+
+	for name, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, name)
+		}
+	}
+}
+
+// authFailures are the consecutive authentication failures of an IP address
+type authFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// authLockout locks out the IP addresses with too many consecutive authentication failures.  The lockout doubles
+// with each failure past the limit, up to max.  A nil authLockout never locks out.
+type authLockout struct {
+	limit     int
+	base      time.Duration
+	max       time.Duration
+	failures  map[string]*authFailures
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// newAuthLockout returns nil when limit is 0 (no lockout)
+func newAuthLockout(limit int, base time.Duration, max time.Duration) *authLockout {
+	if limit <= 0 {
+		return nil
+	}
+
+	if max < base {
+		max = base
+	}
+
+	return &authLockout{
+		limit:     limit,
+		base:      base,
+		max:       max,
+		failures:  map[string]*authFailures{},
+		lastSweep: time.Now(),
+	}
+}
+
+// lockedOut returns how long ip remains locked out for (0 when it isn't)
+func (l *authLockout) lockedOut(ip string) time.Duration {
+	if l == nil || ip == "" {
+		return 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if f, ok := l.failures[ip]; ok {
+		if remaining := time.Until(f.lockedUntil); remaining > 0 {
+			return remaining
+		}
+	}
+
+	return 0
+}
+
+// fail counts an authentication failure of ip.  It returns the lockout that the failure started (0 for none).
+func (l *authLockout) fail(ip string) time.Duration {
+	if l == nil || ip == "" {
+		return 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+
+	l.sweep(now)
+
+	f, ok := l.failures[ip]
+
+	if !ok {
+		f = &authFailures{}
+		l.failures[ip] = f
+	}
+
+	f.count++
+	f.last = now
+
+	if f.count < l.limit {
+		return 0
+	}
+
+	lockout := l.base
+
+	for i := l.limit; i < f.count && lockout < l.max; i++ {
+		lockout *= 2
+	}
+
+	if lockout > l.max {
+		lockout = l.max
+	}
+
+	f.lockedUntil = now.Add(lockout)
+
+	return lockout
+}
+
+// succeed resets the failures of ip
+func (l *authLockout) succeed(ip string) {
+	if l == nil || ip == "" {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.failures, ip)
+}
+
+// sweep drops the failures that are older than the longest lockout
+func (l *authLockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < LIMITER_SWEEP_INTERVAL {
+		return
+	}
+
+	l.lastSweep = now
+
+	for ip, f := range l.failures {
+		if now.Sub(f.last) > l.max && now.After(f.lockedUntil) {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// connectionLimiter counts the websocket connections, in total and by IP address
+type connectionLimiter struct {
+	max   int
+	maxIp int
+	total int
+	perIp map[string]int
+	lock  sync.Mutex
+}
+
+func newConnectionLimiter(max int, maxIp int) *connectionLimiter {
+	return &connectionLimiter{max: max, maxIp: maxIp, perIp: map[string]int{}}
+}
+
+// acquire counts a new connection from ip.  It returns the reason that the connection is refused ("" when it isn't).
+func (l *connectionLimiter) acquire(ip string) string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.max > 0 && l.total >= l.max {
+		return LIMIT_REASON_CONNECTIONS
+	}
+
+	if l.maxIp > 0 && ip != "" && l.perIp[ip] >= l.maxIp {
+		return LIMIT_REASON_IP_CONNECTIONS
+	}
+
+	l.total++
+
+	if ip != "" {
+		l.perIp[ip]++
+	}
+
+	return ""
+}
+
+func (l *connectionLimiter) release(ip string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.total--
+
+	if ip == "" {
+		return
+	}
+
+	if l.perIp[ip]--; l.perIp[ip] <= 0 {
+		delete(l.perIp, ip)
+	}
+}
+
+// setupLimits creates the connection and rate limits from the configuration
+func (s *server) setupLimits(conf *config.Config) {
+	s.connLimiter = newConnectionLimiter(conf.MaxConnections, conf.MaxIpConnections)
+	s.ipLimiter = newRateLimiter(conf.IpMessageRate, conf.MessageBurst)
+	s.keyLimiter = newRateLimiter(conf.KeyMessageRate, conf.MessageBurst)
+	s.authLockout = newAuthLockout(conf.AuthFailureLimit, time.Duration(conf.AuthLockout)*time.Millisecond, time.Duration(conf.AuthLockoutMax)*time.Millisecond)
+}
+
+// remoteIp returns the IP address of the client of r ("" for unix socket connections, which aren't limited by IP
+// address)
+func remoteIp(r *http.Request) string {
+	if unixConn(r) != nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// checkRequestLimits refuses the requests from IP addresses that are locked out or over their rate limit.  It
+// returns false when the request has been answered.
+func (s *server) checkRequestLimits(w http.ResponseWriter, r *http.Request, ip string) bool {
+	reason, retryAfter := s.requestLimit(ip)
+
+	if reason == "" {
+		return true
+	}
+
+	s.rejectRequest(w, r, http.StatusTooManyRequests, reason, retryAfter)
+
+	return false
+}
+
+// requestLimit returns the reason that the requests from ip are refused ("" when they aren't) along with how long
+// until they are allowed again
+func (s *server) requestLimit(ip string) (string, time.Duration) {
+	if retryAfter := s.authLockout.lockedOut(ip); retryAfter > 0 {
+		return LIMIT_REASON_LOCKED_OUT, retryAfter
+	}
+
+	if ip == "" {
+		return "", 0
+	}
+
+	if ok, retryAfter := s.ipLimiter.allow(ip); !ok {
+		return LIMIT_REASON_IP_RATE, retryAfter
+	}
+
+	return "", 0
+}
+
+// acquireConnection counts a new websocket connection from ip.  It returns false when the connection has been refused
+// (and the request answered).
+func (s *server) acquireConnection(w http.ResponseWriter, r *http.Request, ip string) bool {
+	switch reason := s.connLimiter.acquire(ip); reason {
+	case "":
+		return true
+	case LIMIT_REASON_CONNECTIONS:
+		s.rejectRequest(w, r, http.StatusServiceUnavailable, reason, CONNECTION_RETRY_AFTER)
+	default:
+		s.rejectRequest(w, r, http.StatusTooManyRequests, reason, CONNECTION_RETRY_AFTER)
+	}
+
+	return false
+}
+
+// authFailed counts an authentication failure for the lockout of ip
+func (s *server) authFailed(ip string) {
+	if lockout := s.authLockout.fail(ip); lockout > 0 {
+		s.logger.Warn("Locking out IP address after repeated authentication failures", zap.String("ip", ip), zap.Int64("lockoutMs", lockout.Milliseconds()))
+	}
+}
+
+// checkMessageLimits answers the messages of clients that are over their rate limit (nil for the messages within it)
+func (s *server) checkMessageLimits(m *message.Message, sess *session) *message.Response {
+	reason := ""
+
+	if ok, _ := s.keyLimiter.allow(sess.keyId); !ok {
+		reason = LIMIT_REASON_KEY_RATE
+	} else if sess.remoteIp != "" {
+		if ok, _ := s.ipLimiter.allow(sess.remoteIp); !ok {
+			reason = LIMIT_REASON_IP_RATE
+		}
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	s.logger.Debug("Rejecting message over the rate limit", zap.String("reason", reason), zap.String("key", sess.key), zap.String("ip", sess.remoteIp), zap.Int("id", m.Id))
+	s.metrics.limitRejections.WithLabelValues(reason).Inc()
+
+	resp := message.Response{
+		Response: rc_protocol.Response{Id: strconv.Itoa(m.Id), Stderr: RATE_LIMITED_MESSAGE, ExitCode: -1},
+		Status:   message.STATUS_RATE_LIMITED,
+	}
+
+	return &resp
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if ok, _ := (*rateLimiter)(nil).allow("anyone"); !ok {
+		t.Error("a nil rateLimiter should allow everything")
+	}
+
+	l := newRateLimiter(60, 2)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Errorf("allow() #%d = false, wanted the burst to be allowed", i)
+		}
+	}
+
+	ok, retryAfter := l.allow("a")
+
+	if ok || retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("allow() past the burst = %v, %v, wanted false and a retry within a second", ok, retryAfter)
+	}
+
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("allow() for another name = false, wanted its own bucket")
+	}
+
+	// a token is added every second
+	l.buckets["a"].updated = l.buckets["a"].updated.Add(-time.Second)
+
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("allow() after a second = false, wanted a new token")
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	l := newAuthLockout(2, time.Minute, 3*time.Minute)
+
+	if lockout := l.fail("10.0.0.1"); lockout != 0 {
+		t.Errorf("fail() below the limit = %v, wanted no lockout", lockout)
+	}
+
+	if l.lockedOut("10.0.0.1") != 0 {
+		t.Error("lockedOut() below the limit should be 0")
+	}
+
+	// the lockout doubles with each further failure, up to the max
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		if lockout := l.fail("10.0.0.1"); lockout != want {
+			t.Errorf("fail() = %v, wanted %v", lockout, want)
+		}
+	}
+
+	if remaining := l.lockedOut("10.0.0.1"); remaining <= 2*time.Minute || remaining > 3*time.Minute {
+		t.Errorf("lockedOut() = %v, wanted about 3m", remaining)
+	}
+
+	if l.lockedOut("10.0.0.2") != 0 {
+		t.Error("lockedOut() of another IP address should be 0")
+	}
+
+	l.succeed("10.0.0.1")
+
+	if l.lockedOut("10.0.0.1") != 0 {
+		t.Error("lockedOut() after a success should be 0")
+	}
+
+	if newAuthLockout(0, time.Minute, time.Minute).fail("10.0.0.1") != 0 {
+		t.Error("a disabled lockout should never lock out")
+	}
+}
+
+func TestConnectionLimiter(t *testing.T) {
+	l := newConnectionLimiter(3, 2)
+
+	for _, tt := range []struct {
+		ip   string
+		want string
+	}{
+		{"10.0.0.1", ""},
+		{"10.0.0.1", ""},
+		{"10.0.0.1", LIMIT_REASON_IP_CONNECTIONS},
+		{"10.0.0.2", ""},
+		{"10.0.0.3", LIMIT_REASON_CONNECTIONS},
+	} {
+		if got := l.acquire(tt.ip); got != tt.want {
+			t.Errorf("acquire(%s) = %q, wanted %q", tt.ip, got, tt.want)
+		}
+	}
+
+	l.release("10.0.0.1")
+
+	if got := l.acquire("10.0.0.3"); got != "" {
+		t.Errorf("acquire() after a release = %q, wanted the connection to be allowed", got)
+	}
+}
+
+func TestServer_Limits(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+	conf.MaxIpConnections = 1
+	conf.KeyMessageRate = 1
+	conf.MessageBurst = 1
+	conf.AuthFailureLimit = 1
+	conf.MaxMessageSize = 1024
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	addr := srv.listeners[0].Addr().(*net.TCPAddr)
+
+	clientConf := *client_config.GetConfig()
+	clientConf.Host = addr.IP.String()
+	clientConf.Port = addr.Port
+	clientConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	clientConf.KeyName = "client"
+	clientConf.TlsDisable = true
+
+	c := client.NewClient(clientConf)
+
+	if err := <-c.Start(); err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+
+	defer c.Stop()
+
+	// the second connection from the same IP address is refused
+	if err := <-client.NewClient(clientConf).Start(); err == nil {
+		t.Error("Start() of a second client succeeded, wanted it to be refused")
+	}
+
+	if got := testutil.ToFloat64(srv.metrics.limitRejections.WithLabelValues(LIMIT_REASON_IP_CONNECTIONS)); got != 1 {
+		t.Errorf("limit_rejections_total{reason=%q} = %v, wanted 1", LIMIT_REASON_IP_CONNECTIONS, got)
+	}
+
+	// the first message uses the burst and the next one is over the rate
+	validateResponse(t, <-c.Send("echo hello", rc_protocol.MessageOptions{}), "hello\n", "", 0)
+
+	header, err := auth.CreateSig("client", clientConf.KeyDir, "")
+
+	if err != nil {
+		t.Fatalf("CreateSig() error = %v", err)
+	}
+
+	identity, err := srv.verifier.Verify(header, "", "127.0.0.1:1")
+
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if resp, _ := srv.handleMessage(`{"id": 2, "command": "echo hello"}`, &session{key: "client", keyId: identity.KeyId()}); resp == nil || resp.Status != message.STATUS_RATE_LIMITED {
+		t.Errorf("handleMessage() over the rate = %v, wanted status %s", resp, message.STATUS_RATE_LIMITED)
+	}
+
+	// an authentication failure locks out the IP address before the upgrade
+	url := "ws://" + addr.String() + "/"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": []string{"RC client;bogus"}}); err == nil || resp == nil {
+		t.Fatalf("Dial() with an invalid signature error = %v, wanted a failed handshake", err)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Dial() while locked out = %v, wanted %d with Retry-After", resp, http.StatusTooManyRequests)
+	}
+
+	// messages over maxMessageSize close the connection
+	resp2 := <-c.Send("echo "+strings.Repeat("x", 2048), rc_protocol.MessageOptions{})
+
+	if resp2 != nil && resp2.ExitCode == 0 {
+		t.Errorf("Send() of a message over maxMessageSize = %v, wanted it to fail", resp2)
+	}
+}
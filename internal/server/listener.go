@@ -0,0 +1,360 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/internal/systemd"
+	"github.com/cthayer/remote_control/pkg/auth"
+)
+
+var (
+	errNoActivatedSockets = errors.New("no sockets were passed by systemd socket activation")
+)
+
+// listener is a socket that the server accepts connections on, with the TLS settings of its address
+type listener struct {
+	net.Listener
+	conf      config.Listener
+	tlsConfig *tls.Config
+}
+
+// listenerConfigs returns the configured listeners.  Without any, the server listens on host:port (or on the sockets
+// passed by systemd socket activation, which a new process takes over along with the others) and on unixSocket.
+func (s *server) listenerConfigs() []config.Listener {
+	if len(s.conf.Listeners) > 0 {
+		return s.conf.Listeners
+	}
+
+	address := s.conf.Host + ":" + strconv.Itoa(s.conf.Port)
+
+	if len(systemd.Files()) > 0 || len(s.inherited[config.LISTEN_ADDRESS_SYSTEMD]) > 0 {
+		address = config.LISTEN_ADDRESS_SYSTEMD
+	}
+
+	listeners := []config.Listener{{Address: address}}
+
+	if s.conf.UnixSocket != "" {
+		listeners = append(listeners, config.Listener{Address: config.LISTEN_ADDRESS_UNIX_PREFIX + s.conf.UnixSocket})
+	}
+
+	return listeners
+}
+
+// tlsKeyPairs returns the TLS key pairs (certificate file => key file) that the listeners can use
+func (s *server) tlsKeyPairs() map[string]string {
+	keyPairs := map[string]string{}
+
+	if s.conf.TlsCertFile != "" && s.conf.TlsKeyFile != "" {
+		keyPairs[s.conf.TlsCertFile] = s.conf.TlsKeyFile
+	}
+
+	for _, lc := range s.conf.Listeners {
+		if lc.TlsCertFile != "" && lc.TlsKeyFile != "" {
+			keyPairs[lc.TlsCertFile] = lc.TlsKeyFile
+		}
+	}
+
+	return keyPairs
+}
+
+// verifiesTlsClients is true when a listener can verify TLS client certificates
+func (s *server) verifiesTlsClients() bool {
+	if s.conf.TlsCertFile != "" && s.conf.TlsKeyFile != "" && s.conf.TlsClientCaFile != "" {
+		return true
+	}
+
+	for _, lc := range s.conf.Listeners {
+		if lc.TlsCertFile != "" && lc.TlsKeyFile != "" && lc.TlsClientCaFile != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listen opens the sockets of all of the listeners.  Nothing is left open when one of them fails.
+func (s *server) listen() ([]*listener, error) {
+	var listeners []*listener
+
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+
+	ciphers := s.cipherSuites()
+
+	for _, lc := range s.listenerConfigs() {
+		sockets, err := s.openSockets(lc)
+
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrap(err, "failed to listen on "+lc.Address)
+		}
+
+		for _, socket := range sockets {
+			l := listener{Listener: socket, conf: s.resolveListener(lc, socket)}
+
+			listeners = append(listeners, &l)
+
+			if l.conf.TlsCertFile == "" || l.conf.TlsKeyFile == "" {
+				continue
+			}
+
+			if l.tlsConfig, err = s.tlsConfig(l.conf, ciphers); err != nil {
+				closeAll()
+				return nil, err
+			}
+		}
+	}
+
+	return listeners, nil
+}
+
+func (s *server) openSockets(lc config.Listener) ([]net.Listener, error) {
+	// the sockets taken over from the previous process are already listening
+	if files := s.inherited[lc.Address]; len(files) > 0 {
+		return inheritedSockets(files)
+	}
+
+	switch {
+	case strings.HasPrefix(lc.Address, config.LISTEN_ADDRESS_UNIX_PREFIX):
+		socket, err := s.listenUnix(strings.TrimPrefix(lc.Address, config.LISTEN_ADDRESS_UNIX_PREFIX), s.unixSocketMode(lc), s.unixSocketGroup(lc))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []net.Listener{socket}, nil
+	case lc.Address == config.LISTEN_ADDRESS_SYSTEMD || strings.HasPrefix(lc.Address, config.LISTEN_ADDRESS_SYSTEMD_PREFIX):
+		return activatedSockets(strings.TrimPrefix(strings.TrimPrefix(lc.Address, config.LISTEN_ADDRESS_SYSTEMD), ":"))
+	}
+
+	socket, err := s.listenTcp(lc.Address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []net.Listener{socket}, nil
+}
+
+// inheritedSockets listens on the sockets taken over from another process
+func inheritedSockets(files []*os.File) ([]net.Listener, error) {
+	var sockets []net.Listener
+
+	for _, f := range files {
+		socket, err := net.FileListener(f)
+
+		if err != nil {
+			for _, s := range sockets {
+				_ = s.Close()
+			}
+
+			return nil, err
+		}
+
+		sockets = append(sockets, socket)
+	}
+
+	return sockets, nil
+}
+
+// listenTcp listens on a TCP address (or on the socket of the address that was taken over from another process)
+func (s *server) listenTcp(address string) (net.Listener, error) {
+	if files := s.inherited[address]; len(files) > 0 {
+		sockets, err := inheritedSockets(files[:1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return sockets[0], nil
+	}
+
+	return net.Listen("tcp", address)
+}
+
+// ListenerFiles returns copies of the listening sockets (including those of the auxiliary servers) and the
+// addresses that they listen on, for a new process to take them over.  The unix socket files are still removed when
+// the sockets are closed until KeepSocketFiles is called.
+func (s *server) ListenerFiles() ([]*os.File, []string, error) {
+	var files []*os.File
+	var addresses []string
+
+	for _, l := range append(append([]*listener{}, s.listeners...), s.auxListeners...) {
+		var f *os.File
+		var err error
+
+		switch socket := l.Listener.(type) {
+		case *net.TCPListener:
+			f, err = socket.File()
+		case *net.UnixListener:
+			f, err = socket.File()
+		default:
+			err = errors.New("can't hand over the socket of " + l.conf.Address)
+		}
+
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+
+			return nil, nil, err
+		}
+
+		files = append(files, f)
+		addresses = append(addresses, l.conf.Address)
+	}
+
+	return files, addresses, nil
+}
+
+// KeepSocketFiles leaves the unix socket files in place when the sockets are closed, once a new process has taken
+// them over
+func (s *server) KeepSocketFiles() {
+	for _, l := range append(append([]*listener{}, s.listeners...), s.auxListeners...) {
+		if socket, ok := l.Listener.(*net.UnixListener); ok {
+			socket.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+// activatedSockets returns the sockets passed by systemd socket activation with the FileDescriptorName name (or all of
+// them when name is empty)
+func activatedSockets(name string) ([]net.Listener, error) {
+	var sockets []net.Listener
+
+	for _, f := range systemd.Files() {
+		if name != "" && f.Name() != name {
+			continue
+		}
+
+		// the socket is duplicated so that it can be listened on again after the server has been stopped
+		socket, err := net.FileListener(f)
+
+		if err != nil {
+			for _, s := range sockets {
+				_ = s.Close()
+			}
+
+			return nil, err
+		}
+
+		sockets = append(sockets, socket)
+	}
+
+	if len(sockets) == 0 {
+		return nil, errNoActivatedSockets
+	}
+
+	return sockets, nil
+}
+
+// resolveListener fills in the settings that a listener takes from the main configuration: the unix socket
+// permissions, and for TCP sockets without their own key pair, the TLS settings
+func (s *server) resolveListener(lc config.Listener, socket net.Listener) config.Listener {
+	if _, ok := socket.(*net.UnixListener); ok {
+		lc.UnixSocketMode = s.unixSocketMode(lc)
+		lc.UnixSocketGroup = s.unixSocketGroup(lc)
+
+		return lc
+	}
+
+	if lc.TlsCertFile == "" && lc.TlsKeyFile == "" {
+		lc.TlsCertFile = s.conf.TlsCertFile
+		lc.TlsKeyFile = s.conf.TlsKeyFile
+
+		if lc.TlsClientCaFile == "" {
+			lc.TlsClientCaFile = s.conf.TlsClientCaFile
+		}
+	}
+
+	return lc
+}
+
+func (s *server) unixSocketMode(lc config.Listener) string {
+	if lc.UnixSocketMode != "" {
+		return lc.UnixSocketMode
+	}
+
+	return s.conf.UnixSocketMode
+}
+
+func (s *server) unixSocketGroup(lc config.Listener) string {
+	if lc.UnixSocketGroup != "" {
+		return lc.UnixSocketGroup
+	}
+
+	return s.conf.UnixSocketGroup
+}
+
+// tlsConfig returns the TLS configuration of a listener.  The key pair is looked up for every handshake so that it can
+// be replaced without restarting the server.
+func (s *server) tlsConfig(lc config.Listener, ciphers []uint16) (*tls.Config, error) {
+	certFile := lc.TlsCertFile
+
+	tlsConfig := tls.Config{
+		PreferServerCipherSuites: true,
+		MinVersion:               TLS_MIN_VERSION,
+		CipherSuites:             ciphers,
+		NextProtos:               []string{"http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert := s.keyPair(certFile); cert != nil {
+				return cert, nil
+			}
+
+			return nil, errors.New("no TLS key pair loaded for " + certFile)
+		},
+	}
+
+	if lc.TlsClientCaFile != "" {
+		clientCAs, err := auth.LoadCertPool(lc.TlsClientCaFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// client certificates are only required by the websocket handler so that the health and metrics endpoints
+		// keep working without one
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return &tlsConfig, nil
+}
+
+// serve accepts the connections of a listener until the server is stopped
+func (s *server) serve(l *listener) {
+	defer s.waitGroup.Done()
+
+	var socket net.Listener = l.Listener
+
+	if l.tlsConfig != nil {
+		socket = tls.NewListener(socket, l.tlsConfig)
+	}
+
+	if err := s.httpSrv.Serve(socket); err != http.ErrServerClosed {
+		s.logger.Error("Error serving requests", zap.Error(err), zap.String("listen address", l.conf.Address))
+	}
+}
+
+// logListening logs the address of a listener (and the socket it is listening on)
+func (s *server) logListening(l *listener) {
+	fields := []zap.Field{
+		zap.String("listen address", l.conf.Address),
+		zap.String("socket", l.Addr().Network()+":"+l.Addr().String()),
+		zap.Bool("tls", l.tlsConfig != nil),
+	}
+
+	s.logger.Info("Server listening", fields...)
+}
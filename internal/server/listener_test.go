@@ -0,0 +1,121 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+)
+
+func TestServer_Listeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-listeners")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tlsListener := config.Listener{
+		Address:     "127.0.0.1:0",
+		TlsCertFile: filepath.Join(dir, "server.pem"),
+		TlsKeyFile:  filepath.Join(dir, "server-key.pem"),
+	}
+
+	writeTestCert(t, tlsListener.TlsCertFile, tlsListener.TlsKeyFile, "listener", time.Now().Add(24*time.Hour))
+
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.UnixSocketMode = "0600"
+	conf.UnixSocketAllow = []string{strconv.Itoa(os.Getuid())}
+	conf.Listeners = []config.Listener{
+		{Address: "127.0.0.1:0"},
+		tlsListener,
+		{Address: config.LISTEN_ADDRESS_UNIX_PREFIX + filepath.Join(dir, "rc.sock")},
+	}
+
+	srv := NewServer(&conf).(*server)
+
+	if !srv.useTls {
+		t.Error("useTls = false, wanted true for a listener with its own key pair")
+	}
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	if len(srv.listeners) != 3 {
+		t.Fatalf("listeners = %d, wanted 3", len(srv.listeners))
+	}
+
+	send := func(clientConf client_config.Config) {
+		c := client.NewClient(clientConf)
+
+		if err := <-c.Start(); err != nil {
+			t.Errorf("Error connecting to %s: %v", clientConf.Host, err)
+			return
+		}
+
+		validateResponse(t, <-c.Send("echo listener", rc_protocol.MessageOptions{}), "listener\n", "", 0)
+		<-c.Stop()
+	}
+
+	clientConf := *client_config.GetConfig()
+	clientConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	clientConf.KeyName = "client"
+
+	for _, l := range srv.listeners[:2] {
+		addr := l.Addr().(*net.TCPAddr)
+
+		tcpConf := clientConf
+		tcpConf.Host = addr.IP.String()
+		tcpConf.Port = addr.Port
+		tcpConf.TlsDisable = l.tlsConfig == nil
+
+		if l.tlsConfig != nil {
+			tcpConf.TlsPin = auth.SpkiFingerprint(srv.keyPair(tlsListener.TlsCertFile).Leaf)
+		}
+
+		send(tcpConf)
+	}
+
+	unixConf := *client_config.GetConfig()
+	unixConf.Host = client.UNIX_SOCKET_PREFIX + filepath.Join(dir, "rc.sock")
+	unixConf.KeyName = ""
+
+	send(unixConf)
+
+	if info, err := os.Stat(filepath.Join(dir, "rc.sock")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("unix socket = %v, %v, wanted the unixSocketMode of the main configuration", info, err)
+	}
+}
+
+func TestServer_Listeners_Systemd(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: config.LISTEN_ADDRESS_SYSTEMD_PREFIX + "rc"}}
+
+	srv := NewServer(&conf).(*server)
+
+	if _, err := srv.listen(); err == nil {
+		t.Error("listen() should fail without sockets from systemd socket activation")
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+const (
+	METRICS_NAMESPACE = "remote_control"
+
+	EXIT_CLASS_SUCCESS    = "success"
+	EXIT_CLASS_ERROR      = "error"
+	EXIT_CLASS_KILLED     = "killed"
+	EXIT_CLASS_QUEUE_FULL = "queue_full"
+	EXIT_CLASS_CANCELED   = "canceled"
+
+	AUTH_FAILURE_ERROR               = "error"
+	AUTH_FAILURE_INVALID_HEADER      = "invalid_header"
+	AUTH_FAILURE_INVALID_SIGNATURE   = "invalid_signature"
+	AUTH_FAILURE_UNKNOWN_KEY         = "unknown_key"
+	AUTH_FAILURE_STALE_TIMESTAMP     = "stale_timestamp"
+	AUTH_FAILURE_REPLAYED_NONCE      = "replayed_nonce"
+	AUTH_FAILURE_WRONG_SERVER        = "wrong_server"
+	AUTH_FAILURE_ADDRESS_NOT_ALLOWED = "address_not_allowed"
+	AUTH_FAILURE_REVOKED             = message.REJECTION_KEY_REVOKED
+	AUTH_FAILURE_EXPIRED             = message.REJECTION_KEY_EXPIRED
+	AUTH_FAILURE_NOT_YET_VALID       = message.REJECTION_KEY_NOT_YET_VALID
+	AUTH_FAILURE_INVALID_CERTIFICATE = "invalid_certificate"
+	AUTH_FAILURE_UNTRUSTED_CERT      = "untrusted_certificate"
+	AUTH_FAILURE_PRINCIPAL           = "principal_not_allowed"
+	AUTH_FAILURE_MISSING_EXTENSION   = "missing_extension"
+	AUTH_FAILURE_CLIENT_CERT         = "client_certificate_required"
+	AUTH_FAILURE_UNIX_PEER           = "unix_peer_not_allowed"
+	AUTH_FAILURE_UNSIGNED_MESSAGE    = "unsigned_message"
+	AUTH_FAILURE_REPLAYED_MESSAGE    = "replayed_message"
+)
+
+type metrics struct {
+	registry          *prometheus.Registry
+	commandsStarted   *prometheus.CounterVec
+	commandsFinished  *prometheus.CounterVec
+	commandsFailed    *prometheus.CounterVec
+	commandDuration   *prometheus.HistogramVec
+	queueWait         prometheus.Histogram
+	activeConnections prometheus.Gauge
+	authFailures      *prometheus.CounterVec
+	outputBytes       *prometheus.CounterVec
+	limitRejections   *prometheus.CounterVec
+}
+
+// newMetrics creates the metrics of a server in their own registry (so that multiple servers can exist in a process)
+func newMetrics(s *server) *metrics {
+	m := metrics{
+		registry: prometheus.NewRegistry(),
+		commandsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "commands_started_total",
+			Help:      "Number of commands started.",
+		}, []string{"key"}),
+		commandsFinished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "commands_finished_total",
+			Help:      "Number of commands that finished running.",
+		}, []string{"key", "exit_class"}),
+		commandsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "commands_failed_total",
+			Help:      "Number of commands that failed or could not be run.",
+		}, []string{"key", "exit_class"}),
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "command_duration_seconds",
+			Help:      "Time spent running commands.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+		}, []string{"exit_class"}),
+		queueWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "command_queue_wait_seconds",
+			Help:      "Time commands spent waiting in the queue before running.",
+			Buckets:   []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60},
+		}),
+		activeConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "websocket_connections",
+			Help:      "Number of active websocket connections.",
+		}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "auth_failures_total",
+			Help:      "Number of failed authentication attempts.",
+		}, []string{"reason"}),
+		outputBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "command_output_bytes_total",
+			Help:      "Bytes of output produced by commands.",
+		}, []string{"stream"}),
+		limitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "limit_rejections_total",
+			Help:      "Number of connections and messages refused by the connection and rate limits.",
+		}, []string{"reason"}),
+	}
+
+	queueDepth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "command_queue_depth",
+		Help:      "Number of commands waiting in the queue.",
+	}, func() float64 {
+		return float64(len(s.cmdQueue))
+	})
+
+	if s.useTls {
+		m.registry.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: METRICS_NAMESPACE,
+				Name:      "tls_certificate_expiry_seconds",
+				Help:      "Seconds until the TLS certificate expires (negative once it has expired).",
+			}, func() float64 {
+				if expiry := s.getTlsCertExpiry(); !expiry.IsZero() {
+					return time.Until(expiry).Seconds()
+				}
+
+				return 0
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: METRICS_NAMESPACE,
+				Name:      "tls_certificate_expiring",
+				Help:      "1 when the TLS certificate expires within tlsExpiryWarning days, 0 otherwise.",
+			}, func() float64 {
+				if s.tlsCertExpiring() {
+					return 1
+				}
+
+				return 0
+			}),
+		)
+	}
+
+	m.registry.MustRegister(
+		m.commandsStarted,
+		m.commandsFinished,
+		m.commandsFailed,
+		m.commandDuration,
+		m.queueWait,
+		queueDepth,
+		m.activeConnections,
+		m.authFailures,
+		m.outputBytes,
+		m.limitRejections,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return &m
+}
+
+// registerMetricsRoutes adds the (unauthenticated) metrics endpoint to router.  The metrics name the client keys, so
+// they are only served on their own listener (metricsPort), never on the main one.
+func (s *server) registerMetricsRoutes(router *mux.Router) {
+	s.handleCors(router, s.conf.MetricsPath, promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}), http.MethodGet)
+}
+
+func (m *metrics) commandFinished(key string, cmd *command, seconds float64) {
+	class := exitClass(cmd)
+
+	m.commandsFinished.WithLabelValues(key, class).Inc()
+	m.commandDuration.WithLabelValues(class).Observe(seconds)
+	m.outputBytes.WithLabelValues("stdout").Add(float64(len(cmd.Stdout)))
+	m.outputBytes.WithLabelValues("stderr").Add(float64(len(cmd.Stderr)))
+
+	if class != EXIT_CLASS_SUCCESS {
+		m.commandsFailed.WithLabelValues(key, class).Inc()
+	}
+}
+
+func authFailureReason(err error) string {
+	switch err {
+	case auth.ErrInvalidHeader:
+		return AUTH_FAILURE_INVALID_HEADER
+	case auth.ErrInvalidSignature:
+		return AUTH_FAILURE_INVALID_SIGNATURE
+	case auth.ErrUnknownKey:
+		return AUTH_FAILURE_UNKNOWN_KEY
+	case auth.ErrStaleTimestamp:
+		return AUTH_FAILURE_STALE_TIMESTAMP
+	case auth.ErrReplayedNonce:
+		return AUTH_FAILURE_REPLAYED_NONCE
+	case auth.ErrWrongServer:
+		return AUTH_FAILURE_WRONG_SERVER
+	case auth.ErrKeyRevoked:
+		return AUTH_FAILURE_REVOKED
+	case auth.ErrKeyExpired:
+		return AUTH_FAILURE_EXPIRED
+	case auth.ErrKeyNotYetValid:
+		return AUTH_FAILURE_NOT_YET_VALID
+	case auth.ErrAddressNotAllowed:
+		return AUTH_FAILURE_ADDRESS_NOT_ALLOWED
+	case auth.ErrInvalidCertificate:
+		return AUTH_FAILURE_INVALID_CERTIFICATE
+	case auth.ErrUntrustedCertificate:
+		return AUTH_FAILURE_UNTRUSTED_CERT
+	case auth.ErrPrincipalNotAllowed:
+		return AUTH_FAILURE_PRINCIPAL
+	case auth.ErrMissingExtension:
+		return AUTH_FAILURE_MISSING_EXTENSION
+	case errClientCertRequired:
+		return AUTH_FAILURE_CLIENT_CERT
+	case errUnixPeerNotAllowed:
+		return AUTH_FAILURE_UNIX_PEER
+	case errUnsignedMessage:
+		return AUTH_FAILURE_UNSIGNED_MESSAGE
+	case errReplayedMessage:
+		return AUTH_FAILURE_REPLAYED_MESSAGE
+	}
+
+	return AUTH_FAILURE_ERROR
+}
+
+func exitClass(cmd *command) string {
+	switch {
+	case cmd.ExitCode == 0:
+		return EXIT_CLASS_SUCCESS
+	case cmd.ExitCode < 0:
+		// killed by a signal (or timeout)
+		return EXIT_CLASS_KILLED
+	}
+
+	return EXIT_CLASS_ERROR
+}
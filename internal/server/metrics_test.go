@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/cthayer/remote_control/internal/config"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	conf := *config.GetConfig()
+
+	srv := NewServer(&conf).(*server)
+
+	// run a successful and a failing command through the worker
+	srv.shutdown = make(chan struct{})
+	srv.cmdWorkerWaitGroup.Add(1)
+	go srv.commandWorker(0)
+
+	for _, cmd := range []string{"echo hello", "exit 3"} {
+		if _, err := srv.handleMessage("{\"command\": \""+cmd+"\"}", &session{key: "client"}); err != nil {
+			t.Errorf("Error handling message: %v", err)
+		}
+	}
+
+	close(srv.shutdown)
+	srv.cmdWorkerWaitGroup.Wait()
+
+	if got := testutil.ToFloat64(srv.metrics.commandsStarted.WithLabelValues("client")); got != 2 {
+		t.Errorf("commands started = %v, wanted 2", got)
+	}
+
+	if got := testutil.ToFloat64(srv.metrics.commandsFinished.WithLabelValues("client", EXIT_CLASS_SUCCESS)); got != 1 {
+		t.Errorf("commands finished successfully = %v, wanted 1", got)
+	}
+
+	if got := testutil.ToFloat64(srv.metrics.commandsFailed.WithLabelValues("client", EXIT_CLASS_ERROR)); got != 1 {
+		t.Errorf("commands failed = %v, wanted 1", got)
+	}
+
+	if got := testutil.ToFloat64(srv.metrics.outputBytes.WithLabelValues("stdout")); got != float64(len("hello\n")) {
+		t.Errorf("stdout bytes = %v, wanted %v", got, len("hello\n"))
+	}
+
+	// the metrics are exposed in the prometheus text format
+	router := mux.NewRouter()
+	srv.registerMetricsRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, conf.MetricsPath, nil))
+
+	body, _ := ioutil.ReadAll(w.Body)
+
+	if w.Code != http.StatusOK || !strings.Contains(string(body), "remote_control_command_duration_seconds_count") {
+		t.Errorf("Invalid metrics response (%d): %s", w.Code, body)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+const (
+	// ORIGIN_ANY in allowedOrigins allows every origin
+	ORIGIN_ANY = "*"
+	// ORIGIN_WILDCARD_PREFIX starts the host of an allowed origin that matches all of the subdomains of a domain (ex:
+	// https://*.example.com)
+	ORIGIN_WILDCARD_PREFIX = "*."
+
+	REJECTION_ORIGIN_NOT_ALLOWED = "origin_not_allowed"
+
+	CORS_MAX_AGE       = 600
+	CORS_ALLOW_HEADERS = "Authorization, Content-Type, X-RC-Certificate"
+)
+
+// checkOrigin allows the requests without an Origin header (clients other than browsers), the requests from the
+// server's own origin and the requests from an origin in allowedOrigins.  It keeps web pages on other origins from
+// connecting with the credentials of the browser (ex: a TLS client certificate).
+func (s *server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return s.originAllowed(origin)
+}
+
+// originAllowed tells whether origin is in allowedOrigins
+func (s *server) originAllowed(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	for _, allowed := range s.conf.AllowedOrigins {
+		if allowed == ORIGIN_ANY {
+			return true
+		}
+
+		a, err := url.Parse(strings.ToLower(strings.TrimSuffix(allowed, "/")))
+
+		if err != nil || a.Scheme != u.Scheme {
+			continue
+		}
+
+		if a.Host == u.Host {
+			return true
+		}
+
+		if strings.HasPrefix(a.Host, ORIGIN_WILDCARD_PREFIX) && strings.HasSuffix(u.Host, a.Host[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rejectOrigin answers a request from an origin that isn't allowed
+func (s *server) rejectOrigin(w http.ResponseWriter, r *http.Request) {
+	s.logger.Warn("Rejecting request from an origin that is not allowed", zap.String("origin", r.Header.Get("Origin")), zap.String("remoteAddr", r.RemoteAddr))
+
+	s.writeJson(w, http.StatusForbidden, message.Rejection{Reason: REJECTION_ORIGIN_NOT_ALLOWED, Error: "origin not allowed"})
+}
+
+// cors answers the CORS requests (including the preflight requests) of the allowed origins for an auxiliary endpoint
+// when the cors option is on
+func (s *server) cors(methods []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if !s.conf.Cors || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		if !s.originAllowed(origin) {
+			if r.Method == http.MethodOptions {
+				s.rejectOrigin(w, r)
+				return
+			}
+
+			// the browser doesn't let the page read the response without the CORS headers
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// preflight request
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", CORS_ALLOW_HEADERS)
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(CORS_MAX_AGE))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleCors registers an auxiliary endpoint that answers the CORS requests of the allowed origins (along with their
+// preflight OPTIONS requests when the cors option is on)
+func (s *server) handleCors(router *mux.Router, path string, handler http.Handler, methods ...string) {
+	routeMethods := methods
+
+	if s.conf.Cors {
+		routeMethods = append(append([]string{}, methods...), http.MethodOptions)
+	}
+
+	router.Handle(path, s.cors(methods, handler)).Methods(routeMethods...)
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestServer_Check_Origin(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.AllowedOrigins = []string{"https://console.example.com", "https://*.internal.example.com:8443", "http://localhost:3000/"}
+
+	srv := NewServer(&conf).(*server)
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://agent.example.com:4515", true},
+		{"https://console.example.com", true},
+		{"HTTPS://Console.Example.com", true},
+		{"http://console.example.com", false},
+		{"https://console.example.com.evil.com", false},
+		{"https://a.internal.example.com:8443", true},
+		{"https://a.b.internal.example.com:8443", true},
+		{"https://internal.example.com:8443", false},
+		{"https://evilinternal.example.com:8443", false},
+		{"https://a.internal.example.com", false},
+		{"http://localhost:3000", true},
+		{"null", false},
+		{"https://evil.com", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://agent.example.com:4515/", nil)
+
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+
+		if got := srv.checkOrigin(req); got != tt.want {
+			t.Errorf("checkOrigin(%q) = %v, wanted %v", tt.origin, got, tt.want)
+		}
+	}
+
+	srv.conf.AllowedOrigins = []string{ORIGIN_ANY}
+
+	if !srv.originAllowed("https://evil.com") {
+		t.Errorf("originAllowed() = false with %q, wanted every origin to be allowed", ORIGIN_ANY)
+	}
+}
+
+func TestServer_Cross_Origin(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.Listeners = []config.Listener{{Address: "127.0.0.1:0"}}
+	conf.AllowedOrigins = []string{"https://console.example.com"}
+	conf.Cors = true
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	addr := srv.listeners[0].Addr().(*net.TCPAddr)
+
+	// cross-origin websocket connections are rejected before authentication
+	_, resp, err := websocket.DefaultDialer.Dial("ws://"+addr.String()+"/", http.Header{"Origin": []string{"https://evil.com"}})
+
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Dial() from another origin = %v, %v, wanted %d", resp, err, http.StatusForbidden)
+	}
+
+	var rejection message.Rejection
+
+	if err := json.NewDecoder(resp.Body).Decode(&rejection); err != nil || rejection.Reason != REJECTION_ORIGIN_NOT_ALLOWED {
+		t.Errorf("rejection = %v (%v), wanted reason %s", rejection, err, REJECTION_ORIGIN_NOT_ALLOWED)
+	}
+
+	// clients without an Origin header are unaffected
+	clientConf := *client_config.GetConfig()
+	clientConf.Host = addr.IP.String()
+	clientConf.Port = addr.Port
+	clientConf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+	clientConf.KeyName = "client"
+	clientConf.TlsDisable = true
+
+	c := client.NewClient(clientConf)
+
+	if err := <-c.Start(); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+
+	<-c.Stop()
+
+	// CORS on the auxiliary endpoints
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		wantCode   int
+		wantOrigin string
+	}{
+		{"allowed", http.MethodGet, "https://console.example.com", http.StatusOK, "https://console.example.com"},
+		{"preflight", http.MethodOptions, "https://console.example.com", http.StatusNoContent, "https://console.example.com"},
+		{"not allowed", http.MethodGet, "https://evil.com", http.StatusOK, ""},
+		{"preflight not allowed", http.MethodOptions, "https://evil.com", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "http://"+addr.String()+conf.HealthPath, nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+			resp, err := http.DefaultClient.Do(req)
+
+			if err != nil {
+				t.Fatalf("%s %s error = %v", tt.method, conf.HealthPath, err)
+			}
+
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode || resp.Header.Get("Access-Control-Allow-Origin") != tt.wantOrigin {
+				t.Errorf("%s %s = %d %v, wanted %d with Access-Control-Allow-Origin %q", tt.method, conf.HealthPath, resp.StatusCode, resp.Header, tt.wantCode, tt.wantOrigin)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+//+build !linux
+
+package server
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// SO_PEERCRED is linux specific
+func getPeerCred(conn *net.UnixConn) (*peerCred, error) {
+	return nil, errors.New("peer credentials of unix sockets are not supported on this platform")
+}
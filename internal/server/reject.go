@@ -0,0 +1,60 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+const (
+	// AUTHENTICATE_SCHEME is the scheme of the WWW-Authenticate header of 401 responses
+	AUTHENTICATE_SCHEME = "RC"
+	// AUTH_FAILURE_MESSAGE is the error of the authentication failures that aren't explained to the client
+	AUTH_FAILURE_MESSAGE = "authentication failed"
+)
+
+// rejectRequest answers a request that is refused by the limits before the websocket upgrade
+func (s *server) rejectRequest(w http.ResponseWriter, r *http.Request, code int, reason string, retryAfter time.Duration) {
+	s.logger.Debug("Rejecting request", zap.String("reason", reason), zap.String("remoteAddr", r.RemoteAddr), zap.Int64("retryAfterMs", retryAfter.Milliseconds()))
+	s.metrics.limitRejections.WithLabelValues(reason).Inc()
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	s.writeJson(w, code, message.Rejection{Reason: reason, Error: http.StatusText(code)})
+}
+
+// rejectAuthentication answers a request whose client failed to authenticate: 401 when the client didn't prove who it
+// is and 403 when its key (or certificate) isn't allowed to connect
+func (s *server) rejectAuthentication(w http.ResponseWriter, err error) {
+	reason := authFailureReason(err)
+	rejection := message.Rejection{Reason: reason, Error: AUTH_FAILURE_MESSAGE}
+
+	if reason != AUTH_FAILURE_ERROR {
+		rejection.Error = err.Error()
+	}
+
+	code := authFailureStatus(reason)
+
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", AUTHENTICATE_SCHEME)
+	}
+
+	s.writeJson(w, code, rejection)
+}
+
+// authFailureStatus is the HTTP status of the response to an authentication failure
+func authFailureStatus(reason string) int {
+	switch reason {
+	case AUTH_FAILURE_REVOKED, AUTH_FAILURE_EXPIRED, AUTH_FAILURE_NOT_YET_VALID, AUTH_FAILURE_ADDRESS_NOT_ALLOWED, AUTH_FAILURE_PRINCIPAL, AUTH_FAILURE_MISSING_EXTENSION, AUTH_FAILURE_UNIX_PEER:
+		return http.StatusForbidden
+	}
+
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestServer_Reject_Authentication(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+
+	srv := NewServer(&conf).(*server)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+		wantReason    string
+	}{
+		{"no header", "", http.StatusUnauthorized, AUTH_FAILURE_INVALID_HEADER},
+		{"invalid header", "RC client", http.StatusUnauthorized, AUTH_FAILURE_INVALID_HEADER},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", tt.authorization)
+
+			w := httptest.NewRecorder()
+
+			srv.handler(w, req)
+
+			var rejection message.Rejection
+
+			if err := json.Unmarshal(w.Body.Bytes(), &rejection); err != nil {
+				t.Fatalf("invalid response body %q: %v", w.Body.String(), err)
+			}
+
+			if w.Code != tt.wantCode || rejection.Reason != tt.wantReason || rejection.Error == "" {
+				t.Errorf("handler() = %d %v, wanted %d with reason %s", w.Code, rejection, tt.wantCode, tt.wantReason)
+			}
+
+			if got := w.Header().Get("WWW-Authenticate"); got != AUTHENTICATE_SCHEME {
+				t.Errorf("WWW-Authenticate = %q, wanted %q", got, AUTHENTICATE_SCHEME)
+			}
+		})
+	}
+}
+
+func TestAuthFailureStatus(t *testing.T) {
+	tests := map[error]int{
+		auth.ErrInvalidSignature:  http.StatusUnauthorized,
+		auth.ErrUnknownKey:        http.StatusUnauthorized,
+		errClientCertRequired:     http.StatusUnauthorized,
+		auth.ErrKeyRevoked:        http.StatusForbidden,
+		auth.ErrKeyExpired:        http.StatusForbidden,
+		auth.ErrAddressNotAllowed: http.StatusForbidden,
+	}
+
+	for err, want := range tests {
+		if got := authFailureStatus(authFailureReason(err)); got != want {
+			t.Errorf("authFailureStatus(%v) = %d, wanted %d", err, got, want)
+		}
+	}
+}
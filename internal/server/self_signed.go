@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+)
+
+const (
+	SELF_SIGNED_CERT_VALIDITY = 10 * 365 * 24 * time.Hour
+)
+
+var (
+	errSelfSignedConfig   = errors.New("tlsSelfSigned requires tlsCertFile and tlsKeyFile")
+	errSelfSignedPartial  = errors.New("only one of tlsCertFile and tlsKeyFile exists, refusing to replace it with a self-signed key pair")
+	selfSignedHosts       = []string{"localhost"}
+	selfSignedIpAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+)
+
+// bootstrapTls generates a self-signed key pair in tlsCertFile and tlsKeyFile on the first start, so that a new host
+// can use TLS without provisioning a certificate.  Clients can trust it by pinning its fingerprint (which is logged) or
+// on first use.
+func (s *server) bootstrapTls() error {
+	if s.conf.TlsCertFile == "" || s.conf.TlsKeyFile == "" {
+		return errSelfSignedConfig
+	}
+
+	_, certErr := os.Stat(s.conf.TlsCertFile)
+	_, keyErr := os.Stat(s.conf.TlsKeyFile)
+
+	if certErr == nil && keyErr == nil {
+		return nil
+	}
+
+	if !os.IsNotExist(certErr) || !os.IsNotExist(keyErr) {
+		if certErr == nil || keyErr == nil {
+			return errSelfSignedPartial
+		}
+
+		return errors.Wrap(certErr, "failed to check for the TLS key pair")
+	}
+
+	cert, err := generateSelfSigned(s.conf.TlsCertFile, s.conf.TlsKeyFile)
+
+	if err != nil {
+		return errors.Wrap(err, "failed to generate a self-signed TLS key pair")
+	}
+
+	s.logger.Info("Generated self-signed TLS certificate",
+		zap.String("tlsCertFile", s.conf.TlsCertFile),
+		zap.String("fingerprint", auth.SpkiFingerprint(cert)),
+		zap.Strings("hosts", cert.DNSNames),
+	)
+
+	return nil
+}
+
+// generateSelfSigned writes a new ECDSA P-256 key to keyFile and a self-signed certificate for it, valid for the host
+// name of the machine and localhost, to certFile
+func generateSelfSigned(certFile string, keyFile string) (*x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := selfSignedHosts
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		hosts = append([]string{hostname}, hosts...)
+	}
+
+	now := time.Now()
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"remote-control self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(SELF_SIGNED_CERT_VALIDITY),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              hosts,
+		IPAddresses:           selfSignedIpAddresses,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
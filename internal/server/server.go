@@ -3,22 +3,30 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	rc_protocol "github.com/cthayer/go-rc-protocol"
 	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/internal/handover"
 	"github.com/cthayer/remote_control/internal/logger"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/message"
 )
 
 const (
@@ -32,6 +40,10 @@ type Server interface {
 	Start() chan error
 	Stop() chan error
 	OnConfigReload() error
+	Drain() chan struct{}
+	Resume()
+	ListenerFiles() ([]*os.File, []string, error)
+	KeepSocketFiles()
 }
 
 type server struct {
@@ -39,24 +51,58 @@ type server struct {
 	upgrader           websocket.Upgrader
 	logger             *zap.Logger
 	rcProto            rc_protocol.RCProtocol
+	verifier           *auth.Verifier
 	cmdQueue           chan commandQueue
 	httpSrv            *http.Server
-	netListener        net.Listener
+	listeners          []*listener
+	auxListeners       []*listener
+	inherited          map[string][]*os.File
 	router             *mux.Router
 	waitGroup          sync.WaitGroup
 	shutdown           chan struct{}
 	cmdWorkerWaitGroup sync.WaitGroup
 	useTls             bool
+	auxSrvs            []*http.Server
+	metrics            *metrics
+	runningCommands    int32
+	inFlightMessages   int32
+	draining           int32
+	drained            chan struct{}
+	drainCanceled      chan struct{}
+	drainLock          sync.Mutex
+	stopping           int32
+	conns              map[*websocket.Conn]*connection
+	lastConnId         uint64
+	jobs               map[uint64]*job
+	lastJobId          uint64
+	jobLock            sync.Mutex
+	connLimiter        *connectionLimiter
+	ipLimiter          *rateLimiter
+	keyLimiter         *rateLimiter
+	authLockout        *authLockout
+	tlsCerts           map[string]*tls.Certificate
+	stateLock          sync.RWMutex
+	grpcSrv            *grpc.Server
+	policyWatcher      *fileWatcher
+	tlsWatcher         *fileWatcher
 }
 
+// errQueueFull is returned when a command can't be queued because COMMAND_QUEUE_MAX_BACKLOG commands are waiting to
+// run
+var errQueueFull = errors.New("command queue is full")
+
 type commandQueue struct {
 	Command  command             `json:"command"`
 	Message  rc_protocol.Message `json:"message"`
+	Key      string              `json:"key"`
+	Queued   time.Time           `json:"queued"`
 	RespChan chan commandResp    `json:"-"`
+	Job      *job                `json:"-"`
 }
 
 type commandResp struct {
 	Response rc_protocol.Response
+	Status   string
 	Error    error
 }
 
@@ -69,16 +115,29 @@ func NewServer(conf *config.Config) Server {
 		},
 		logger:             logger.GetLogger(),
 		rcProto:            rc_protocol.NewRCProtocol(),
+		verifier:           auth.NewVerifier(conf.CertDir, conf.AuthorizedKeysFile, time.Duration(conf.AuthMaxClockSkew)*time.Millisecond),
 		cmdQueue:           make(chan commandQueue, COMMAND_QUEUE_MAX_BACKLOG),
 		httpSrv:            &http.Server{Addr: conf.Host + ":" + strconv.Itoa(conf.Port)},
-		netListener:        nil,
 		router:             mux.NewRouter(),
 		waitGroup:          sync.WaitGroup{},
 		shutdown:           make(chan struct{}),
 		cmdWorkerWaitGroup: sync.WaitGroup{},
-		useTls:             conf.TlsCertFile != "" && conf.TlsKeyFile != "",
+		tlsCerts:           map[string]*tls.Certificate{},
+		conns:              map[*websocket.Conn]*connection{},
+		jobs:               map[uint64]*job{},
+		inherited:          handover.Files(),
 	}
 
+	srv.useTls = len(srv.tlsKeyPairs()) > 0
+
+	srv.httpSrv.ConnContext = connContext
+	srv.upgrader.CheckOrigin = srv.checkOrigin
+	srv.metrics = newMetrics(&srv)
+	srv.verifier.TrustCertificates(conf.SshCaFile, conf.X509CaFile)
+	srv.verifier.RestrictSshCertificates(conf.SshCertPrincipals, conf.SshCertExtensions)
+	srv.verifier.BindServerNames(conf.ServerNames, conf.AllowUnboundSignatures)
+	srv.setupLimits(conf)
+
 	return &srv
 }
 
@@ -87,6 +146,34 @@ func (s *server) Start() chan error {
 
 	errChan := make(chan error, 1)
 	s.shutdown = make(chan struct{})
+	atomic.StoreInt32(&s.draining, 0)
+	atomic.StoreInt32(&s.stopping, 0)
+
+	if err = s.checkMessageSigning(); err != nil {
+		errChan <- err
+		close(errChan)
+		return errChan
+	}
+
+	if err = s.checkAuthMode(); err != nil {
+		errChan <- err
+		close(errChan)
+		return errChan
+	}
+
+	if err = s.startKeyPolicy(); err != nil {
+		errChan <- err
+		close(errChan)
+		return errChan
+	}
+
+	if s.conf.TlsSelfSigned {
+		if err = s.bootstrapTls(); err != nil {
+			errChan <- err
+			close(errChan)
+			return errChan
+		}
+	}
 
 	if s.useTls {
 		err = s.setupTls()
@@ -96,6 +183,18 @@ func (s *server) Start() chan error {
 			close(errChan)
 			return errChan
 		}
+
+		if err = s.startTlsWatch(); err != nil {
+			errChan <- err
+			close(errChan)
+			return errChan
+		}
+	}
+
+	if err = s.startAuxServers(); err != nil {
+		errChan <- err
+		close(errChan)
+		return errChan
 	}
 
 	// start the server async
@@ -103,10 +202,16 @@ func (s *server) Start() chan error {
 	go func() {
 		defer s.waitGroup.Done()
 
+		if s.conf.HealthPort == 0 {
+			// serve the health endpoints on the main listener
+			s.registerHealthRoutes(s.router)
+		}
+
+		s.registerExecRoutes(s.router)
 		s.router.HandleFunc("/", s.handler)
 		s.httpSrv.Handler = s.router
 
-		s.netListener, err = net.Listen("tcp", s.httpSrv.Addr)
+		s.listeners, err = s.listen()
 
 		errChan <- err
 		close(errChan)
@@ -115,24 +220,18 @@ func (s *server) Start() chan error {
 			return
 		}
 
-		s.logger.Info("Server listening", zap.String("listen address", s.httpSrv.Addr))
-
 		// start the command processing loop
 		s.waitGroup.Add(1)
 		go s.runCommands()
 
 		s.logger.Debug("Command processing go routine started")
 
-		// this will block until the server is stopped or an error occurs
-		if s.useTls {
-			err = s.httpSrv.ServeTLS(s.netListener, "", "")
-		} else {
-			err = s.httpSrv.Serve(s.netListener)
-		}
+		// all of the listeners are served by the same http server until it is stopped
+		for _, l := range s.listeners {
+			s.logListening(l)
 
-		// if the server exits for any reason other than being stopped, log the error
-		if err != http.ErrServerClosed {
-			s.logger.Error("Error serving requests", zap.Error(err))
+			s.waitGroup.Add(1)
+			go s.serve(l)
 		}
 	}()
 
@@ -140,24 +239,53 @@ func (s *server) Start() chan error {
 }
 
 func (s *server) Stop() chan error {
-	defer close(s.shutdown)
-
 	errChan := make(chan error, 1)
 
+	// report not ready, reject new commands and cancel the queued ones while stopping (for good: the drain can't be
+	// canceled by Resume anymore)
+	atomic.StoreInt32(&s.stopping, 1)
+	drained := s.Drain()
+
+	s.policyWatcher.stop()
+	s.tlsWatcher.stop()
+
 	// stop the server async
 	go func() {
 		defer close(errChan)
 
-		// stop server
+		// stop accepting connections
 		ctx, cancel := context.WithTimeout(context.TODO(), time.Second*HTTP_SERVER_STOP_TIMEOUT)
+		defer cancel()
+
 		err := s.httpSrv.Shutdown(ctx)
 
-		cancel()
+		s.stopGrpcServer(ctx)
+
+		for _, auxSrv := range s.auxSrvs {
+			if auxErr := auxSrv.Shutdown(ctx); err == nil {
+				err = auxErr
+			}
+		}
 
 		s.logger.Debug("HTTP server shutdown")
 
 		s.logger.Debug("Waiting for commands to finish running")
 
+		// let the running commands finish and answer their clients
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			s.logger.Error("Giving up on waiting for commands to finish", zap.Int32("runningCommands", atomic.LoadInt32(&s.runningCommands)))
+
+			if err == nil {
+				err = ctx.Err()
+			}
+		}
+
+		// the websocket connections are not closed by the http server once they have been upgraded
+		s.closeConnections()
+		close(s.shutdown)
+
 		// wait for shutdown to finish
 		s.waitGroup.Wait()
 
@@ -167,36 +295,136 @@ func (s *server) Stop() chan error {
 	return errChan
 }
 
+// startAuxServers starts the plaintext listeners for the auxiliary endpoints that are configured to use their own port,
+// the admin API and the gRPC API
+func (s *server) startAuxServers() error {
+	s.auxSrvs = nil
+	s.auxListeners = nil
+
+	if s.conf.HealthPort != 0 {
+		if err := s.startAuxServer(s.conf.HealthHost, s.conf.HealthPort, s.registerHealthRoutes); err != nil {
+			return err
+		}
+	}
+
+	if s.conf.MetricsPort != 0 {
+		if err := s.startAuxServer(s.conf.MetricsHost, s.conf.MetricsPort, s.registerMetricsRoutes); err != nil {
+			return err
+		}
+	}
+
+	if err := s.startAdminServer(); err != nil {
+		return err
+	}
+
+	return s.startGrpcServer()
+}
+
+func (s *server) startAuxServer(host string, port int, registerRoutes func(*mux.Router)) error {
+	router := mux.NewRouter()
+	registerRoutes(router)
+
+	auxSrv := &http.Server{
+		Addr:    host + ":" + strconv.Itoa(port),
+		Handler: router,
+	}
+
+	socket, err := s.listenTcp(auxSrv.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	s.auxSrvs = append(s.auxSrvs, auxSrv)
+	s.auxListeners = append(s.auxListeners, &listener{Listener: socket, conf: config.Listener{Address: auxSrv.Addr}})
+
+	s.logger.Info("Auxiliary server listening", zap.String("listen address", auxSrv.Addr))
+
+	s.waitGroup.Add(1)
+	go func() {
+		defer s.waitGroup.Done()
+
+		if err := auxSrv.Serve(socket); err != http.ErrServerClosed {
+			s.logger.Error("Error serving auxiliary requests", zap.Error(err), zap.String("listen address", auxSrv.Addr))
+		}
+	}()
+
+	return nil
+}
+
 func (s *server) OnConfigReload() error {
-	return s.setupTls()
+	var err *multierror.Error
+
+	if s.useTls {
+		err = multierror.Append(err, s.setupTls())
+	}
+
+	err = multierror.Append(err, s.reloadKeyPolicy())
+
+	return err.ErrorOrNil()
 }
 
-func (s *server) handler(w http.ResponseWriter, r *http.Request) {
-	// check authorization header
-	authHeader := r.Header.Get(s.rcProto.GetHeaderName())
+// startKeyPolicy loads the revocation list and key validity periods and reloads them (and the authorized_keys file)
+// when their files change
+func (s *server) startKeyPolicy() error {
+	if err := s.verifier.LoadKeyPolicy(s.conf.RevokedKeysFile, s.conf.KeyValidityFile); err != nil {
+		return err
+	}
 
-	validSig, err := s.rcProto.CheckSig(authHeader, s.conf.CertDir)
+	if s.conf.RevokedKeysFile == "" && s.conf.KeyValidityFile == "" && s.conf.AuthorizedKeysFile == "" {
+		return nil
+	}
+
+	watcher, err := s.watchFiles([]string{s.conf.RevokedKeysFile, s.conf.KeyValidityFile, s.conf.AuthorizedKeysFile}, func() {
+		_ = s.reloadKeyPolicy()
+	})
 
 	if err != nil {
-		s.logger.Error("Error occurred while checking signature", zap.Error(err))
-		return
+		return err
+	}
+
+	s.policyWatcher = watcher
+
+	return nil
+}
+
+func (s *server) reloadKeyPolicy() error {
+	if err := s.verifier.ReloadKeyPolicy(); err != nil {
+		s.logger.Error("Failed to reload key policy, keeping the current one", zap.Error(err))
+		return err
 	}
 
-	if !validSig {
-		s.logger.Error("Invalid signature", zap.Bool("validSig", validSig))
+	s.logger.Info("Key policy reloaded", zap.String("revokedKeysFile", s.conf.RevokedKeysFile), zap.String("keyValidityFile", s.conf.KeyValidityFile), zap.String("authorizedKeysFile", s.conf.AuthorizedKeysFile))
+
+	return nil
+}
+
+func (s *server) handler(w http.ResponseWriter, r *http.Request) {
+	sess := s.authenticateRequest(w, r)
+
+	if sess == nil {
 		return
 	}
 
-	s.logger.Debug("Client authenticated successfully")
+	ip := sess.remoteIp
+
+	if !s.acquireConnection(w, r, ip) {
+		return
+	}
 
 	// upgrade request to websocket
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 
 	if err != nil {
 		s.logger.Error("Failed to upgrade to websocket", zap.Error(err))
+		s.connLimiter.release(ip)
 		return
 	}
 
+	if s.conf.MaxMessageSize > 0 {
+		conn.SetReadLimit(int64(s.conf.MaxMessageSize))
+	}
+
 	s.logger.Debug("Succeeded in upgrading to websocket")
 
 	//conn.SetCloseHandler(func(code int, text string) error {
@@ -208,20 +436,99 @@ func (s *server) handler(w http.ResponseWriter, r *http.Request) {
 
 	// handle websocket messages
 	s.waitGroup.Add(1)
-	go s.websocketHandler(conn)
+	go s.websocketHandler(conn, sess)
+}
+
+// authenticateRequest checks the origin, the limits and the authentication of a request and returns the session of
+// its client.  It returns nil when the request has been answered.
+func (s *server) authenticateRequest(w http.ResponseWriter, r *http.Request) *session {
+	// browsers connect with the credentials of the user (ex: a TLS client certificate) from any page
+	if !s.checkOrigin(r) {
+		s.rejectOrigin(w, r)
+		return nil
+	}
+
+	ip := remoteIp(r)
+
+	if !s.checkRequestLimits(w, r, ip) {
+		return nil
+	}
+
+	// check authorization header (and/or TLS client certificate)
+	identity, err := s.authenticate(r)
+
+	if err != nil {
+		s.authenticationFailed(r, identity, err, ip)
+		s.rejectAuthentication(w, err)
+		return nil
+	}
+
+	return s.newSession(r, identity, ip)
+}
+
+// authenticationFailed logs and counts an authentication failure of the client of r
+func (s *server) authenticationFailed(r *http.Request, identity *auth.Identity, err error, ip string) {
+	reason := authFailureReason(err)
+	name := ""
+
+	if identity != nil {
+		name = identity.Name
+	}
+
+	s.logger.Error("Error occurred while checking signature", zap.Error(err), zap.String("reason", reason), zap.String("key", name), zap.String("remoteAddr", r.RemoteAddr))
+	s.metrics.authFailures.WithLabelValues(reason).Inc()
+	s.authFailed(ip)
 }
 
-func (s *server) websocketHandler(conn *websocket.Conn) {
+// newSession returns the session of a client that has been authenticated
+func (s *server) newSession(r *http.Request, identity *auth.Identity, ip string) *session {
+	s.authLockout.succeed(ip)
+
+	sess := session{
+		key:           identity.Name,
+		keyId:         identity.KeyId(),
+		nonce:         identity.Nonce,
+		command:       identity.Command,
+		identity:      identity,
+		transportAuth: s.isTransportAuth(r),
+		remoteIp:      ip,
+	}
+
+	s.logger.Debug("Client authenticated successfully", zap.String("key", sess.key))
+
+	return &sess
+}
+
+func (s *server) websocketHandler(conn *websocket.Conn, sess *session) {
 	defer s.closeConn(conn)
 	defer s.waitGroup.Done()
 
+	s.addConnection(conn, sess.key)
+	defer s.removeConnection(conn)
+	defer s.connLimiter.release(sess.remoteIp)
+
+	s.metrics.activeConnections.Inc()
+	defer s.metrics.activeConnections.Dec()
+
+	hb := s.startHeartbeat(conn)
+	defer hb.stop()
+
 commLoop:
 	for {
+		if err := hb.beforeRead(); err != nil {
+			s.logger.Error("Error setting read deadline", zap.Error(err), zap.Any("conn", conn))
+			break commLoop
+		}
+
 		messageType, p, err := conn.ReadMessage()
 
 		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
 				s.logger.Debug("Normal websocket close", zap.Error(err), zap.Any("conn", conn))
+			} else if s.isDraining() {
+				s.logger.Debug("Websocket closed while draining", zap.Error(err), zap.Any("conn", conn))
+			} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				s.logger.Info("Client stopped answering pings, closing websocket", zap.Error(err), zap.Any("conn", conn))
 			} else {
 				s.logger.Error("Error reading message from websocket", zap.Error(err), zap.Any("conn", conn))
 			}
@@ -237,32 +544,46 @@ commLoop:
 			s.logger.Error("Binary Messages are not accepted")
 			break commLoop
 		case websocket.TextMessage:
-			resp, err := s.handleMessage(string(p))
+			// messages that are being answered are waited for by a drain
+			atomic.AddInt32(&s.inFlightMessages, 1)
+			hb.setBusy(true)
+			err := s.answerMessage(conn, string(p), sess)
+			hb.setBusy(false)
+			atomic.AddInt32(&s.inFlightMessages, -1)
 
 			if err != nil {
-				s.logger.Error("Error handling message", zap.Error(err), zap.Any("conn", conn))
+				s.logger.Error("Error answering message", zap.Error(err), zap.Any("conn", conn))
 				break commLoop
 			}
 
-			s.logger.Debug("succeeded in handling message", zap.Any("response", *resp))
+			s.logger.Debug("Sent message to client")
+		}
+	}
+}
 
-			jsonResp, err := json.Marshal(resp)
+// answerMessage handles a message and writes the response to the client
+func (s *server) answerMessage(conn *websocket.Conn, msg string, sess *session) error {
+	resp, err := s.handleMessage(msg, sess)
 
-			if err != nil {
-				s.logger.Error("Error marshalling json response", zap.Error(err), zap.Any("resp", resp), zap.Any("conn", conn))
-				break commLoop
-			}
+	if err != nil {
+		return errors.Wrap(err, "error handling message")
+	}
 
-			s.logger.Debug("converted message to json", zap.ByteString("json", jsonResp))
+	s.logger.Debug("succeeded in handling message", zap.Any("response", *resp))
 
-			if err := conn.WriteMessage(websocket.TextMessage, jsonResp); err != nil {
-				s.logger.Error("Error writing message to socket", zap.Error(err), zap.Any("conn", conn))
-				break commLoop
-			}
+	jsonResp, err := json.Marshal(resp)
 
-			s.logger.Debug("Sent message to client")
-		}
+	if err != nil {
+		return errors.Wrap(err, "error marshalling json response")
+	}
+
+	s.logger.Debug("converted message to json", zap.ByteString("json", jsonResp))
+
+	if err := conn.WriteMessage(websocket.TextMessage, jsonResp); err != nil {
+		return errors.Wrap(err, "error writing message to socket")
 	}
+
+	return nil
 }
 
 func (s *server) closeConn(conn *websocket.Conn) {
@@ -275,26 +596,71 @@ func (s *server) closeConn(conn *websocket.Conn) {
 	}
 }
 
-func (s *server) handleMessage(msg string) (*rc_protocol.Response, error) {
-	message := s.rcProto.Message(msg)
+func (s *server) handleMessage(msg string, sess *session) (*message.Response, error) {
+	m := message.NewMessage(msg)
+
+	if err := s.verifyMessage(&m, sess); err != nil {
+		s.metrics.authFailures.WithLabelValues(authFailureReason(err)).Inc()
+		return nil, errors.Wrap(err, "rejected message from "+sess.key)
+	}
+
+	if resp := s.checkMessageLimits(&m, sess); resp != nil {
+		return resp, nil
+	}
+
+	if s.isDraining() {
+		s.logger.Debug("Rejecting message while draining", zap.String("key", sess.key), zap.Int("id", m.Id))
+		return drainingResponse(&m), nil
+	}
+
+	switch {
+	case m.IsCommand():
+		return s.queueSessionCommand(sess.restrictCommand(m.Message), sess)
+	case m.Type == message.TYPE_FACTS:
+		return s.handleFacts(m.Message), nil
+	}
+
+	return nil, errors.New("unknown message type: " + m.Type)
+}
+
+func (s *server) queueCommand(msg rc_protocol.Message, key string) (*message.Response, error) {
+	return s.queueSessionCommand(msg, &session{key: key})
+}
+
+// queueSessionCommand queues a command of a session.  The output of the command is passed to the session's output
+// function as it is written and its job to the queued function (when they aren't nil).
+func (s *server) queueSessionCommand(msg rc_protocol.Message, sess *session) (*message.Response, error) {
+	key := sess.key
 	respChan := make(chan commandResp, 1)
 
+	c := newCommand(msg)
+	c.output = sess.output
+
 	cmd := commandQueue{
-		Command:  newCommand(message),
-		Message:  message,
+		Command:  c,
+		Message:  msg,
+		Key:      key,
+		Queued:   time.Now(),
 		RespChan: respChan,
+		Job:      s.addJob(key, msg.Command),
+	}
+
+	if sess.queued != nil {
+		sess.queued(cmd.Job.id)
 	}
 
 	select {
 	case s.cmdQueue <- cmd:
 		s.logger.Debug("command added to queue", zap.Any("command", cmd))
 	case <-time.After(time.Millisecond):
-		return nil, errors.New("command queue is full.  " + string(COMMAND_QUEUE_MAX_BACKLOG) + " commands waiting to run")
+		s.removeJob(cmd.Job)
+		s.metrics.commandsFailed.WithLabelValues(key, EXIT_CLASS_QUEUE_FULL).Inc()
+		return nil, errors.Wrap(errQueueFull, strconv.Itoa(COMMAND_QUEUE_MAX_BACKLOG)+" commands waiting to run")
 	}
 
 	resp := <-respChan
 
-	return &resp.Response, resp.Error
+	return &message.Response{Response: resp.Response, Status: resp.Status}, resp.Error
 }
 
 func (s *server) runCommands() {
@@ -323,7 +689,33 @@ func (s *server) commandWorker(workerId int) {
 			return
 		}
 
+		// commands that were queued before the server started draining are canceled
+		if s.isDraining() {
+			s.cancelCommand(c, message.STATUS_CANCELED)
+			continue
+		}
+
+		// and so are the ones that were killed while queued (through the admin API or by their client)
+		if !s.startJob(c.Job) {
+			s.cancelCommand(c, message.STATUS_KILLED)
+			continue
+		}
+
+		c.Command.onStart = func(p *os.Process) {
+			s.setJobProcess(c.Job, p)
+		}
+
+		started := time.Now()
+
+		s.metrics.queueWait.Observe(started.Sub(c.Queued).Seconds())
+		s.metrics.commandsStarted.WithLabelValues(c.Key).Inc()
+
+		atomic.AddInt32(&s.runningCommands, 1)
 		c.Command.Run()
+		atomic.AddInt32(&s.runningCommands, -1)
+		s.removeJob(c.Job)
+
+		s.metrics.commandFinished(c.Key, &c.Command, time.Since(started).Seconds())
 
 		jsonResp, err := json.Marshal(c.Command)
 
@@ -341,26 +733,35 @@ func (s *server) commandWorker(workerId int) {
 	}
 }
 
+// setupTls loads the TLS key pairs of the listeners.  A key pair that can't be loaded is kept as it is (ex: when only
+// the certificate has been written so far and it doesn't match the key yet).
 func (s *server) setupTls() error {
-	keyPair, err := tls.LoadX509KeyPair(s.conf.TlsCertFile, s.conf.TlsKeyFile)
+	var err *multierror.Error
 
-	if err != nil {
-		return err
-	}
+	for certFile, keyFile := range s.tlsKeyPairs() {
+		keyPair, loadErr := tls.LoadX509KeyPair(certFile, keyFile)
 
-	if s.httpSrv.TLSConfig == nil {
-		s.httpSrv.TLSConfig = &tls.Config{}
-		s.httpSrv.TLSConfig.PreferServerCipherSuites = true
-		s.httpSrv.TLSConfig.MinVersion = TLS_MIN_VERSION
-	}
+		if loadErr == nil {
+			keyPair.Leaf, loadErr = x509.ParseCertificate(keyPair.Certificate[0])
+		}
+
+		if loadErr != nil {
+			err = multierror.Append(err, errors.Wrap(loadErr, "failed to load TLS key pair "+certFile))
+			continue
+		}
+
+		s.stateLock.Lock()
+		s.tlsCerts[certFile] = &keyPair
+		s.stateLock.Unlock()
 
-	if s.httpSrv.TLSConfig.Certificates == nil {
-		s.httpSrv.TLSConfig.Certificates = make([]tls.Certificate, 1)
+		s.logCertExpiry(certFile, &keyPair)
 	}
 
-	s.httpSrv.TLSConfig.Certificates[0] = keyPair
+	return err.ErrorOrNil()
+}
 
-	// load ciphers
+// cipherSuites returns the ids of the configured TLS ciphers
+func (s *server) cipherSuites() []uint16 {
 	var cipherIds []uint16
 	cipherNames := strings.Split(s.conf.Ciphers, ":")
 
@@ -382,7 +783,25 @@ func (s *server) setupTls() error {
 		}
 	}
 
-	s.httpSrv.TLSConfig.CipherSuites = cipherIds
+	return cipherIds
+}
 
-	return nil
+func (s *server) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// getTlsCertExpiry returns the expiry of the TLS certificate that expires first
+func (s *server) getTlsCertExpiry() time.Time {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	var expiry time.Time
+
+	for _, cert := range s.tlsCerts {
+		if expiry.IsZero() || cert.Leaf.NotAfter.Before(expiry) {
+			expiry = cert.Leaf.NotAfter
+		}
+	}
+
+	return expiry
 }
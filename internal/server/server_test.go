@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/message"
 
 	rc_protocol "github.com/cthayer/go-rc-protocol"
 )
@@ -64,6 +65,35 @@ func TestServer_Send_Command(t *testing.T) {
 	validateResponse(t, resp, "hello\nworld\n", "", 0)
 }
 
+func TestServer_Facts(t *testing.T) {
+	server, err := startServer(t)
+
+	if err != nil {
+		return
+	}
+
+	defer stopServer(t, server)
+
+	resp, err := handleMessage(server, "{\"id\": 7, \"type\": \"facts\"}")
+
+	if err != nil {
+		t.Errorf("Error handling facts message: %v", err)
+		return
+	}
+
+	if resp.Id != "7" || resp.ExitCode != 0 {
+		t.Errorf("Invalid facts response, wanted id 7 and exitCode 0, got: %v", resp)
+	}
+
+	if resp.Facts == nil || resp.Facts.Version != config.GetConfig().Version {
+		t.Errorf("Invalid facts, wanted version %s, got: %v", config.GetConfig().Version, resp.Facts)
+	}
+}
+
+func handleMessage(srv *Server, msg string) (*message.Response, error) {
+	return (*srv).(*server).handleMessage(msg, &session{key: "client"})
+}
+
 func startServer(t *testing.T) (*Server, error) {
 	conf := config.GetConfig()
 
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+const (
+	ORIGINAL_COMMAND_ENV = "SSH_ORIGINAL_COMMAND"
+)
+
+var (
+	errUnsignedMessage  = errors.New("message is not signed")
+	errReplayedMessage  = errors.New("message id has already been used")
+	errUnknownSignMode  = errors.New("unknown message signing mode")
+	validMessageSigning = map[string]bool{config.MESSAGE_SIGNING_REQUIRED: true, config.MESSAGE_SIGNING_OPTIONAL: true, config.MESSAGE_SIGNING_OFF: true}
+
+	errClientCertRequired = errors.New("a verified TLS client certificate is required")
+	errUnknownAuthMode    = errors.New("unknown auth mode")
+	errMtlsConfig         = errors.New("the mtls and both auth modes require tlsCertFile, tlsKeyFile and tlsClientCaFile")
+	validAuthModes        = map[string]bool{config.AUTH_MODE_SIGNATURE: true, config.AUTH_MODE_MTLS: true, config.AUTH_MODE_BOTH: true}
+)
+
+// session is the authenticated state of a websocket connection
+type session struct {
+	// key is the name of the client key that authenticated the connection
+	key string
+	// keyId identifies the client key whatever name it was found by (see auth.Identity.KeyId)
+	keyId string
+	// nonce is the nonce of the connection's Authorization header.  Signed messages include it so that they can't be
+	// replayed on another connection
+	nonce string
+	// signedIds are the ids of the signed messages received on the connection.  An id can only be used once so that
+	// signed messages can't be replayed on the same connection
+	signedIds map[int]bool
+	// command is the command forced by the key's authorized_keys options or certificate ("" when the client may run
+	// any command)
+	command string
+	// identity is the authenticated client (its key may come from a certificate that isn't known by name)
+	identity *auth.Identity
+	// transportAuth is set when the connection was authenticated by the connection itself (its TLS client certificate
+	// or the peer credentials of a unix socket) instead of the Authorization header.  Its messages are protected by the
+	// connection, which ends at the server, instead of message signatures.
+	transportAuth bool
+	// remoteIp is the IP address of the client ("" for unix socket connections)
+	remoteIp string
+	// output is called with the output of the session's commands as it is written (nil when the client only wants
+	// the responses)
+	output func(stream string, data []byte)
+	// queued is called with the id of the job of each of the session's commands once it has been created (nil when the
+	// client doesn't need it)
+	queued func(jobId uint64)
+}
+
+// restrictCommand replaces the command of msg with the forced command of the session (if any).  Like OpenSSH, the
+// command sent by the client is available to the forced command in SSH_ORIGINAL_COMMAND.  The client's environment
+// and working directory are dropped so that they can't change what the forced command does (ex: with PATH or LD_PRELOAD).
+func (sess *session) restrictCommand(msg rc_protocol.Message) rc_protocol.Message {
+	if sess.command == "" {
+		return msg
+	}
+
+	msg.Options.Env = map[string]string{ORIGINAL_COMMAND_ENV: msg.Command}
+	msg.Options.Cwd = ""
+	msg.Command = sess.command
+
+	return msg
+}
+
+// verifyMessage checks the signature of a message according to the message signing mode
+func (s *server) verifyMessage(m *message.Message, sess *session) error {
+	if s.conf.MessageSigning == config.MESSAGE_SIGNING_OFF || sess.transportAuth {
+		return nil
+	}
+
+	if len(m.Signature) == 0 {
+		if s.conf.MessageSigning == config.MESSAGE_SIGNING_REQUIRED {
+			return errUnsignedMessage
+		}
+
+		return nil
+	}
+
+	data, err := m.SignedData(sess.nonce)
+
+	if err != nil {
+		return err
+	}
+
+	if sess.identity != nil {
+		err = s.verifier.VerifyIdentitySignature(sess.identity, data, m.Signature)
+	} else {
+		err = s.verifier.VerifySignature(sess.key, data, m.Signature)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if sess.signedIds[m.Id] {
+		return errReplayedMessage
+	}
+
+	if sess.signedIds == nil {
+		sess.signedIds = map[int]bool{}
+	}
+
+	sess.signedIds[m.Id] = true
+
+	return nil
+}
+
+func (s *server) checkMessageSigning() error {
+	if !validMessageSigning[s.conf.MessageSigning] {
+		s.logger.Error("Invalid message signing mode", zap.String("messageSigning", s.conf.MessageSigning))
+		return errors.Wrap(errUnknownSignMode, s.conf.MessageSigning)
+	}
+
+	return nil
+}
+
+// authenticate returns the identity of the client that sent r according to the auth mode.  With both, the name of the
+// key in the Authorization header must also be a name of the TLS client certificate.  Clients connected to the unix
+// socket are identified by their peer credentials.
+func (s *server) authenticate(r *http.Request) (*auth.Identity, error) {
+	if conn := unixConn(r); conn != nil {
+		return s.authenticateUnixPeer(conn)
+	}
+
+	if s.conf.AuthMode == config.AUTH_MODE_SIGNATURE {
+		return s.verifier.Verify(r.Header.Get(auth.HEADER_NAME), r.Header.Get(auth.CERTIFICATE_HEADER_NAME), r.RemoteAddr)
+	}
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, errClientCertRequired
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+
+	tlsIdentity, err := s.verifier.VerifyTlsClient(leaf)
+
+	if err != nil || s.conf.AuthMode == config.AUTH_MODE_MTLS {
+		return tlsIdentity, err
+	}
+
+	identity, err := s.verifier.Verify(r.Header.Get(auth.HEADER_NAME), r.Header.Get(auth.CERTIFICATE_HEADER_NAME), r.RemoteAddr)
+
+	if err != nil {
+		return identity, err
+	}
+
+	if !auth.CertificateAllows(leaf, identity.Name) {
+		return identity, auth.ErrPrincipalNotAllowed
+	}
+
+	return identity, nil
+}
+
+// isTransportAuth is true when the connection of r authenticated the client (instead of the Authorization header)
+func (s *server) isTransportAuth(r *http.Request) bool {
+	return unixConn(r) != nil || s.conf.AuthMode == config.AUTH_MODE_MTLS
+}
+
+func (s *server) checkAuthMode() error {
+	if !validAuthModes[s.conf.AuthMode] {
+		s.logger.Error("Invalid auth mode", zap.String("authMode", s.conf.AuthMode))
+		return errors.Wrap(errUnknownAuthMode, s.conf.AuthMode)
+	}
+
+	if s.conf.AuthMode != config.AUTH_MODE_SIGNATURE && !s.verifiesTlsClients() {
+		s.logger.Error("Invalid TLS configuration for auth mode", zap.String("authMode", s.conf.AuthMode))
+		return errMtlsConfig
+	}
+
+	return nil
+}
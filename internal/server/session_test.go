@@ -0,0 +1,230 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/auth"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestServer_Message_Signing(t *testing.T) {
+	conf := *config.GetConfig()
+	conf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+
+	signer, err := auth.NewSigner("client", filepath.Join("..", "..", "test", "client", "keys"))
+
+	if err != nil {
+		t.Errorf("Error loading client key: %v", err)
+		return
+	}
+
+	sign := func(id int, nonce string) string {
+		m := message.Message{Type: message.TYPE_FACTS}
+		m.Id = id
+
+		data, _ := m.SignedData(nonce)
+		m.Signature, _ = signer.Sign(data)
+
+		jsonStr, _ := json.Marshal(m)
+
+		return string(jsonStr)
+	}
+
+	unsigned := "{\"id\": 1, \"type\": \"facts\"}"
+
+	tests := []struct {
+		name    string
+		mode    string
+		msgs    []string
+		wantErr []bool
+	}{
+		{"off accepts unsigned messages", config.MESSAGE_SIGNING_OFF, []string{unsigned}, []bool{false}},
+		{"off ignores signatures", config.MESSAGE_SIGNING_OFF, []string{sign(1, "other")}, []bool{false}},
+		{"optional accepts unsigned messages", config.MESSAGE_SIGNING_OPTIONAL, []string{unsigned}, []bool{false}},
+		{"optional rejects invalid signatures", config.MESSAGE_SIGNING_OPTIONAL, []string{sign(1, "other")}, []bool{true}},
+		{"required rejects unsigned messages", config.MESSAGE_SIGNING_REQUIRED, []string{unsigned}, []bool{true}},
+		{"required accepts signed messages", config.MESSAGE_SIGNING_REQUIRED, []string{sign(1, "nonce"), sign(2, "nonce")}, []bool{false, false}},
+		{"required rejects replayed messages", config.MESSAGE_SIGNING_REQUIRED, []string{sign(1, "nonce"), sign(1, "nonce")}, []bool{false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.MessageSigning = tt.mode
+			srv := NewServer(&conf).(*server)
+			sess := session{key: "client", nonce: "nonce"}
+
+			for i, msg := range tt.msgs {
+				if _, err := srv.handleMessage(msg, &sess); (err != nil) != tt.wantErr[i] {
+					t.Errorf("handleMessage() message %d error = %v, wantErr %v", i, err, tt.wantErr[i])
+				}
+			}
+		})
+	}
+
+	conf.MessageSigning = config.MESSAGE_SIGNING_REQUIRED
+	srv := NewServer(&conf).(*server)
+
+	_, _ = srv.handleMessage(unsigned, &session{key: "client"})
+
+	if got := testutil.ToFloat64(srv.metrics.authFailures.WithLabelValues(AUTH_FAILURE_UNSIGNED_MESSAGE)); got != 1 {
+		t.Errorf("unsigned message auth failures = %v, wanted 1", got)
+	}
+
+	conf.MessageSigning = "sometimes"
+
+	if err := <-NewServer(&conf).Start(); err == nil {
+		t.Error("Start() should fail for an unknown message signing mode")
+	}
+}
+
+func TestSession_Restrict_Command(t *testing.T) {
+	msg := rc_protocol.Message{Command: "rm -rf /", Options: rc_protocol.MessageOptions{Cwd: "/tmp", Env: map[string]string{"FOO": "bar", "PATH": "/tmp"}}}
+
+	sess := session{key: "client"}
+
+	if got := sess.restrictCommand(msg); got.Command != msg.Command {
+		t.Errorf("restrictCommand() = %s, wanted %s", got.Command, msg.Command)
+	}
+
+	sess.command = "echo restricted"
+	got := sess.restrictCommand(msg)
+
+	if got.Command != "echo restricted" || got.Options.Env[ORIGINAL_COMMAND_ENV] != "rm -rf /" {
+		t.Errorf("restrictCommand() = %v, wanted the forced command with the original command in the environment", got)
+	}
+
+	// the client can't change the environment or the working directory of the forced command
+	if len(got.Options.Env) != 1 || got.Options.Cwd != "" {
+		t.Errorf("restrictCommand() = %v, wanted only %s in the environment and no working directory", got, ORIGINAL_COMMAND_ENV)
+	}
+
+	if _, ok := msg.Options.Env[ORIGINAL_COMMAND_ENV]; ok {
+		t.Error("restrictCommand() should not modify the environment of the original message")
+	}
+}
+
+func TestServer_Authenticate_Mtls(t *testing.T) {
+	keyDir := filepath.Join("..", "..", "test", "client", "keys")
+
+	// the certificate of the ecdsa key is issued to ecdsa-client
+	certDir, err := ioutil.TempDir("", "rc-certs")
+
+	if err != nil {
+		t.Fatalf("Error creating cert dir: %v", err)
+	}
+
+	defer os.RemoveAll(certDir)
+
+	for src, dst := range map[string]string{"ecdsa": "ecdsa-client", "client": "client"} {
+		data, _ := ioutil.ReadFile(filepath.Join("..", "..", "test", "server", "certs", src))
+		_ = ioutil.WriteFile(filepath.Join(certDir, dst), data, 0600)
+	}
+
+	certPEM, _ := ioutil.ReadFile(filepath.Join(keyDir, "ecdsa-cert.pem"))
+	block, _ := pem.Decode(certPEM)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+
+	if err != nil {
+		t.Fatalf("Error loading client certificate: %v", err)
+	}
+
+	header := func(keyName string, name string) string {
+		signer, _ := auth.NewSigner(keyName, keyDir)
+		signer.Name = name
+		h, _ := signer.CreateHeader("")
+
+		return h.String()
+	}
+
+	request := func(withCert bool, authorization string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = &tls.ConnectionState{}
+
+		if withCert {
+			r.TLS.VerifiedChains = [][]*x509.Certificate{{leaf}}
+		}
+
+		if authorization != "" {
+			r.Header.Set(auth.HEADER_NAME, authorization)
+		}
+
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		request  *http.Request
+		wantErr  error
+		wantName string
+	}{
+		{"signature ignores certificates", config.AUTH_MODE_SIGNATURE, request(true, header("client", "client")), nil, "client"},
+		{"mtls uses the certificate", config.AUTH_MODE_MTLS, request(true, ""), nil, "ecdsa-client"},
+		{"mtls requires a certificate", config.AUTH_MODE_MTLS, request(false, header("client", "client")), errClientCertRequired, ""},
+		{"both uses the signature", config.AUTH_MODE_BOTH, request(true, header("ecdsa", "ecdsa-client")), nil, "ecdsa-client"},
+		{"both requires a signature", config.AUTH_MODE_BOTH, request(true, ""), auth.ErrInvalidHeader, ""},
+		{"both requires a certificate", config.AUTH_MODE_BOTH, request(false, header("ecdsa", "ecdsa-client")), errClientCertRequired, ""},
+		{"both requires matching names", config.AUTH_MODE_BOTH, request(true, header("client", "client")), auth.ErrPrincipalNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := *config.GetConfig()
+			conf.CertDir = certDir
+			conf.AuthMode = tt.mode
+			srv := NewServer(&conf).(*server)
+
+			identity, err := srv.authenticate(tt.request)
+
+			if err != tt.wantErr {
+				t.Errorf("authenticate() error = %v, wanted %v", err, tt.wantErr)
+				return
+			}
+
+			if err == nil && identity.Name != tt.wantName {
+				t.Errorf("authenticate() = %s, wanted %s", identity.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestServer_Check_Auth_Mode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		clientCa string
+		wantErr  bool
+	}{
+		{"signature", config.AUTH_MODE_SIGNATURE, "", false},
+		{"mtls", config.AUTH_MODE_MTLS, filepath.Join("..", "..", "test", "server", "x509_ca.pem"), false},
+		{"mtls without client ca", config.AUTH_MODE_MTLS, "", true},
+		{"unknown", "password", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := *config.GetConfig()
+			conf.AuthMode = tt.mode
+			conf.TlsCertFile = "server.pem"
+			conf.TlsKeyFile = "server-key.pem"
+			conf.TlsClientCaFile = tt.clientCa
+
+			if err := NewServer(&conf).(*server).checkAuthMode(); (err != nil) != tt.wantErr {
+				t.Errorf("checkAuthMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
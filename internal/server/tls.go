@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/tls"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+)
+
+const (
+	// how often the expiry of the TLS certificate is checked (and a warning logged when it is close)
+	TLS_EXPIRY_CHECK_INTERVAL = time.Hour
+)
+
+// keyPair returns the current TLS key pair of a certificate file (nil when it hasn't been loaded)
+func (s *server) keyPair(certFile string) *tls.Certificate {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	return s.tlsCerts[certFile]
+}
+
+// startTlsWatch reloads the TLS key pairs when their files change (ex: when they are renewed by cert-manager) and
+// periodically checks their expiry
+func (s *server) startTlsWatch() error {
+	var files []string
+
+	for certFile, keyFile := range s.tlsKeyPairs() {
+		files = append(files, certFile, keyFile)
+	}
+
+	watcher, err := s.watchFiles(files, func() {
+		_ = s.reloadTls()
+	})
+
+	if err != nil {
+		return err
+	}
+
+	s.tlsWatcher = watcher
+
+	s.waitGroup.Add(1)
+	go func() {
+		defer s.waitGroup.Done()
+
+		ticker := time.NewTicker(TLS_EXPIRY_CHECK_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.shutdown:
+				return
+			case <-ticker.C:
+				for certFile := range s.tlsKeyPairs() {
+					if cert := s.keyPair(certFile); cert != nil && s.certExpiring(cert) {
+						s.logCertExpiry(certFile, cert)
+					}
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reloadTls loads the TLS key pairs again, keeping the current one of a key pair that can't be loaded
+func (s *server) reloadTls() error {
+	if err := s.setupTls(); err != nil {
+		s.logger.Error("Failed to reload TLS certificate, keeping the current one", zap.Error(err))
+		return err
+	}
+
+	s.logger.Info("TLS certificates reloaded")
+
+	return nil
+}
+
+// logCertExpiry logs the expiry (and fingerprint) of a TLS certificate, as a warning when it expires within
+// tlsExpiryWarning days
+func (s *server) logCertExpiry(certFile string, cert *tls.Certificate) {
+	expiry := cert.Leaf.NotAfter
+	remaining := time.Until(expiry)
+	fields := []zap.Field{
+		zap.String("tlsCertFile", certFile),
+		zap.String("notAfter", expiry.Format(time.RFC3339)),
+		zap.Int64("expiresInHours", int64(remaining/time.Hour)),
+		zap.String("fingerprint", auth.SpkiFingerprint(cert.Leaf)),
+	}
+
+	switch {
+	case remaining <= 0:
+		s.logger.Error("TLS certificate has expired", fields...)
+	case s.certExpiring(cert):
+		s.logger.Warn("TLS certificate expires soon", fields...)
+	default:
+		s.logger.Info("TLS certificate expiry", fields...)
+	}
+}
+
+// tlsCertExpiring is true when a TLS certificate expires (or has expired) within tlsExpiryWarning days
+func (s *server) tlsCertExpiring() bool {
+	expiry := s.getTlsCertExpiry()
+
+	if expiry.IsZero() {
+		return false
+	}
+
+	return s.expiresSoon(expiry)
+}
+
+func (s *server) certExpiring(cert *tls.Certificate) bool {
+	return s.expiresSoon(cert.Leaf.NotAfter)
+}
+
+func (s *server) expiresSoon(expiry time.Time) bool {
+	return time.Until(expiry) <= time.Duration(s.conf.TlsExpiryWarning)*24*time.Hour
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cthayer/remote_control/internal/config"
+)
+
+// writeTestCert writes a self-signed key pair for commonName that expires at notAfter
+func writeTestCert(t *testing.T, certFile string, keyFile string, commonName string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	// the key is written first so that the pair only matches once both files are written
+	_ = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	_ = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+}
+
+func gaugeValue(t *testing.T, srv *server, name string) float64 {
+	families, err := srv.metrics.registry.Gather()
+
+	if err != nil {
+		t.Fatalf("Error gathering metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+
+	t.Fatalf("Metric %s not found", name)
+
+	return 0
+}
+
+func TestServer_Tls_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-tls")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	conf := *config.GetConfig()
+	conf.TlsCertFile = filepath.Join(dir, "server.pem")
+	conf.TlsKeyFile = filepath.Join(dir, "server-key.pem")
+	conf.TlsExpiryWarning = 14
+
+	writeTestCert(t, conf.TlsCertFile, conf.TlsKeyFile, "first", time.Now().Add(90*24*time.Hour))
+
+	srv := NewServer(&conf).(*server)
+
+	if err := srv.setupTls(); err != nil {
+		t.Fatalf("setupTls() error = %v", err)
+	}
+
+	if err := srv.startTlsWatch(); err != nil {
+		t.Fatalf("startTlsWatch() error = %v", err)
+	}
+
+	defer func() {
+		srv.tlsWatcher.stop()
+		close(srv.shutdown)
+		srv.waitGroup.Wait()
+	}()
+
+	commonName := func() string {
+		return srv.keyPair(conf.TlsCertFile).Leaf.Subject.CommonName
+	}
+
+	if got := commonName(); got != "first" {
+		t.Errorf("keyPair() = %s, wanted first", got)
+	}
+
+	if got := gaugeValue(t, srv, METRICS_NAMESPACE+"_tls_certificate_expiring"); got != 0 {
+		t.Errorf("tls_certificate_expiring = %v, wanted 0", got)
+	}
+
+	writeTestCert(t, conf.TlsCertFile, conf.TlsKeyFile, "second", time.Now().Add(7*24*time.Hour))
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for commonName() != "second" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := commonName(); got != "second" {
+		t.Errorf("keyPair() after renewal = %s, wanted second", got)
+	}
+
+	if got := gaugeValue(t, srv, METRICS_NAMESPACE+"_tls_certificate_expiring"); got != 1 {
+		t.Errorf("tls_certificate_expiring = %v, wanted 1 for a certificate that expires within tlsExpiryWarning days", got)
+	}
+
+	// a broken key pair is not loaded
+	_ = ioutil.WriteFile(conf.TlsKeyFile, []byte("invalid"), 0600)
+
+	if err := srv.reloadTls(); err == nil || commonName() != "second" {
+		t.Errorf("reloadTls() error = %v, wanted an error and the current certificate to be kept", err)
+	}
+}
+
+func TestServer_Bootstrap_Tls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-tls")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	conf := *config.GetConfig()
+	conf.TlsSelfSigned = true
+	conf.TlsCertFile = filepath.Join(dir, "tls", "server.pem")
+	conf.TlsKeyFile = filepath.Join(dir, "tls", "server-key.pem")
+
+	srv := NewServer(&conf).(*server)
+
+	if err := srv.bootstrapTls(); err != nil {
+		t.Fatalf("bootstrapTls() error = %v", err)
+	}
+
+	if err := srv.setupTls(); err != nil {
+		t.Fatalf("setupTls() of the self-signed key pair error = %v", err)
+	}
+
+	if err := srv.keyPair(conf.TlsCertFile).Leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("self-signed certificate is not valid for localhost: %v", err)
+	}
+
+	// the key pair is only generated once
+	certPEM, _ := ioutil.ReadFile(conf.TlsCertFile)
+
+	if err := srv.bootstrapTls(); err != nil {
+		t.Errorf("bootstrapTls() with an existing key pair error = %v", err)
+	}
+
+	if again, _ := ioutil.ReadFile(conf.TlsCertFile); string(again) != string(certPEM) {
+		t.Error("bootstrapTls() should not replace an existing key pair")
+	}
+
+	_ = os.Remove(conf.TlsKeyFile)
+
+	if err := srv.bootstrapTls(); err != errSelfSignedPartial {
+		t.Errorf("bootstrapTls() with only a certificate error = %v, wanted %v", err, errSelfSignedPartial)
+	}
+
+	conf.TlsKeyFile = ""
+
+	if err := NewServer(&conf).(*server).bootstrapTls(); err != errSelfSignedConfig {
+		t.Errorf("bootstrapTls() without a key file error = %v, wanted %v", err, errSelfSignedConfig)
+	}
+}
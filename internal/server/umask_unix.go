@@ -0,0 +1,16 @@
+//+build !windows
+
+package server
+
+import (
+	"syscall"
+)
+
+// withUmask runs fn with the given umask.  The umask belongs to the process, so files created by other goroutines in
+// the meantime get it too: only use it around short calls.
+func withUmask(mask int, fn func() error) error {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+
+	return fn()
+}
@@ -0,0 +1,8 @@
+//+build windows
+
+package server
+
+// withUmask runs fn (windows has no umask)
+func withUmask(mask int, fn func() error) error {
+	return fn()
+}
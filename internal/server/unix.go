@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+)
+
+const (
+	UNIX_IDENTITY_PREFIX = "unix:"
+	// UNIX_ALLOW_GROUP_PREFIX marks the groups in unixSocketAllow (the other entries are users)
+	UNIX_ALLOW_GROUP_PREFIX = "@"
+)
+
+var errUnixPeerNotAllowed = errors.New("unix socket peer is not allowed")
+
+type contextKey string
+
+const (
+	// CONN_CONTEXT_KEY holds the net.Conn of a request in its context
+	CONN_CONTEXT_KEY contextKey = "conn"
+)
+
+// peerCred is the process at the other end of a unix socket connection
+type peerCred struct {
+	pid int32
+	uid uint32
+	gid uint32
+}
+
+// connContext makes the connection of a request available to its handler (to read the peer credentials of unix
+// socket connections)
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, CONN_CONTEXT_KEY, c)
+}
+
+// unixConn returns the unix socket connection of r (nil for other connections)
+func unixConn(r *http.Request) *net.UnixConn {
+	conn, _ := r.Context().Value(CONN_CONTEXT_KEY).(*net.UnixConn)
+
+	return conn
+}
+
+// listenUnix listens on a unix socket with the given permissions (octal mode and group).  A socket file left behind by
+// a previous run is replaced.
+func (s *server) listenUnix(path string, socketMode string, group string) (net.Listener, error) {
+	mode, err := strconv.ParseUint(socketMode, 8, 32)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid unixSocketMode "+socketMode)
+	}
+
+	gid := -1
+
+	if group != "" {
+		if gid, err = lookupGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("unix socket path exists and is not a socket: " + path)
+		}
+
+		_ = os.Remove(path)
+	}
+
+	var listener net.Listener
+
+	// only the server can connect until the socket has its group and mode
+	err = withUmask(0077, func() error {
+		listener, err = net.Listen("unix", path)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// authenticateUnixPeer identifies the client of a unix socket connection by the user of its process.  The identity
+// is named `unix:<user name>` and can also be found by `unix:<uid>` in the key policy.  Only the users in
+// unixSocketAllow (or in one of its groups) are accepted.
+func (s *server) authenticateUnixPeer(conn *net.UnixConn) (*auth.Identity, error) {
+	cred, err := getPeerCred(conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	uid := strconv.FormatUint(uint64(cred.uid), 10)
+	name := UNIX_IDENTITY_PREFIX + uid
+
+	u, err := user.LookupId(uid)
+
+	if err == nil {
+		name = UNIX_IDENTITY_PREFIX + u.Username
+	} else {
+		u = nil
+	}
+
+	s.logger.Debug("Unix socket peer", zap.String("key", name), zap.Int32("pid", cred.pid), zap.Uint32("uid", cred.uid), zap.Uint32("gid", cred.gid))
+
+	if !s.unixPeerAllowed(cred, u) {
+		return &auth.Identity{Name: name}, errUnixPeerNotAllowed
+	}
+
+	return s.verifier.VerifyPeer(name, UNIX_IDENTITY_PREFIX+uid)
+}
+
+// unixPeerAllowed tells whether the user of a unix socket peer (nil when it has no account) is in unixSocketAllow:
+// by name, by uid or by one of its groups (`@<group name or gid>`, the primary group of the process or a group of the
+// user)
+func (s *server) unixPeerAllowed(cred *peerCred, u *user.User) bool {
+	uid := strconv.FormatUint(uint64(cred.uid), 10)
+	var gids []string
+
+	for _, entry := range s.conf.UnixSocketAllow {
+		if !strings.HasPrefix(entry, UNIX_ALLOW_GROUP_PREFIX) {
+			if entry == uid || (u != nil && entry == u.Username) {
+				return true
+			}
+
+			continue
+		}
+
+		gid, err := lookupGroup(strings.TrimPrefix(entry, UNIX_ALLOW_GROUP_PREFIX))
+
+		if err != nil {
+			continue
+		}
+
+		if gids == nil {
+			gids = []string{strconv.FormatUint(uint64(cred.gid), 10)}
+
+			if u != nil {
+				if groupIds, err := u.GroupIds(); err == nil {
+					gids = append(gids, groupIds...)
+				}
+			}
+		}
+
+		for _, peerGid := range gids {
+			if peerGid == strconv.Itoa(gid) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+
+	g, err := user.LookupGroup(group)
+
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.Atoi(g.Gid)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/pkg/client"
+	"github.com/cthayer/remote_control/pkg/client_config"
+)
+
+func TestServer_Unix_Socket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-unix")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	conf := *config.GetConfig()
+	conf.TlsCertFile = ""
+	conf.TlsKeyFile = ""
+	conf.UnixSocket = filepath.Join(dir, "rc.sock")
+	conf.UnixSocketMode = "0600"
+	conf.UnixSocketAllow = []string{"nobody-else", "@" + strconv.Itoa(os.Getgid())}
+	conf.RevokedKeysFile = filepath.Join(dir, "revoked")
+
+	_ = ioutil.WriteFile(conf.RevokedKeysFile, []byte("# nobody\n"), 0600)
+
+	srv := NewServer(&conf).(*server)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	defer func() {
+		if err := <-srv.Stop(); err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	}()
+
+	if info, err := os.Stat(conf.UnixSocket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("unix socket = %v, %v, wanted a socket with mode 0600", info, err)
+	}
+
+	clientConf := *client_config.GetConfig()
+	clientConf.Host = client.UNIX_SOCKET_PREFIX + conf.UnixSocket
+	clientConf.KeyName = ""
+
+	c := client.NewClient(clientConf)
+
+	if err := <-c.Start(); err != nil {
+		t.Fatalf("Error connecting to the unix socket: %v", err)
+	}
+
+	resp := <-c.Send("echo unix", rc_protocol.MessageOptions{})
+	<-c.Stop()
+
+	validateResponse(t, resp, "unix\n", "", 0)
+
+	current, _ := user.Current()
+	name := UNIX_IDENTITY_PREFIX + current.Username
+
+	if got := testutil.ToFloat64(srv.metrics.commandsStarted.WithLabelValues(name)); got != 1 {
+		t.Errorf("commands started by %s = %v, wanted 1", name, got)
+	}
+
+	// only the users and groups in unixSocketAllow may connect
+	for _, allow := range [][]string{nil, {"nobody-else", "@nobody-else"}} {
+		srv.conf.UnixSocketAllow = allow
+
+		if err := <-client.NewClient(clientConf).Start(); !errors.Is(err, client.ErrForbidden) {
+			t.Errorf("Start() with unixSocketAllow %v error = %v, wanted %v", allow, err, client.ErrForbidden)
+		}
+	}
+
+	srv.conf.UnixSocketAllow = []string{current.Username}
+
+	// peers are subject to the key policy
+	_ = ioutil.WriteFile(conf.RevokedKeysFile, []byte(UNIX_IDENTITY_PREFIX+current.Uid+"\n"), 0600)
+	_ = srv.reloadKeyPolicy()
+
+	c = client.NewClient(clientConf)
+
+	select {
+	case err := <-c.Start():
+		if err == nil {
+			<-c.Stop()
+			t.Error("Start() should fail for a revoked peer")
+		}
+	case <-time.After(time.Second):
+		t.Error("Timeout exceeded while connecting to server")
+	}
+}
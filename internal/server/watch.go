@@ -0,0 +1,105 @@
+package server
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const (
+	// several events are usually fired for a single change of a file
+	FILE_WATCH_DEBOUNCE = 100 * time.Millisecond
+)
+
+// fileWatcher calls a function when files change
+//
+// The directories of the files are watched (instead of the files themselves) so that files that are replaced by a
+// rename (ex: by editors or configuration management) are still noticed.
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+	stopped sync.Once
+}
+
+// watchFiles calls onChange when one of the (non empty) paths is written, created, renamed or removed
+func (s *server) watchFiles(paths []string, onChange func()) (*fileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]bool{}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		path = filepath.Clean(path)
+		files[path] = true
+
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+	}
+
+	w := fileWatcher{
+		watcher: watcher,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		var timer *time.Timer
+
+		for {
+			select {
+			case <-w.done:
+				if timer != nil {
+					timer.Stop()
+				}
+
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !files[filepath.Clean(event.Name)] || event.Op == fsnotify.Chmod {
+					continue
+				}
+
+				s.logger.Debug("Watched file changed", zap.String("file", event.Name), zap.String("op", event.Op.String()))
+
+				if timer != nil {
+					timer.Stop()
+				}
+
+				timer = time.AfterFunc(FILE_WATCH_DEBOUNCE, onChange)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				s.logger.Error("Error watching files", zap.Error(err))
+			}
+		}
+	}()
+
+	return &w, nil
+}
+
+func (w *fileWatcher) stop() {
+	if w == nil {
+		return
+	}
+
+	w.stopped.Do(func() {
+		close(w.done)
+		_ = w.watcher.Close()
+	})
+}
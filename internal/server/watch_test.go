@@ -0,0 +1,57 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cthayer/remote_control/internal/config"
+)
+
+func TestServer_Watch_Files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-watch")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "revoked")
+	_ = ioutil.WriteFile(path, []byte("client\n"), 0600)
+
+	srv := NewServer(config.GetConfig()).(*server)
+	changed := make(chan struct{}, 10)
+
+	w, err := srv.watchFiles([]string{path, ""}, func() {
+		changed <- struct{}{}
+	})
+
+	if err != nil {
+		t.Errorf("watchFiles() error = %v, wanted %v", err, nil)
+		return
+	}
+
+	defer w.stop()
+
+	// other files in the directory are ignored
+	_ = ioutil.WriteFile(filepath.Join(dir, "other"), []byte("other\n"), 0600)
+
+	select {
+	case <-changed:
+		t.Error("watchFiles() should ignore other files")
+	case <-time.After(3 * FILE_WATCH_DEBOUNCE):
+	}
+
+	// files replaced by a rename are noticed
+	_ = ioutil.WriteFile(path+".tmp", []byte("client\nother\n"), 0600)
+	_ = os.Rename(path+".tmp", path)
+
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Error("watchFiles() didn't notice the change")
+	}
+}
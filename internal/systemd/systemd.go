@@ -0,0 +1,112 @@
+// Package systemd implements the parts of the systemd service protocol that the server uses: status notifications
+// (sd_notify) for `Type=notify` services and socket activation (sd_listen_fds)
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	NOTIFY_SOCKET_ENV  = "NOTIFY_SOCKET"
+	LISTEN_PID_ENV     = "LISTEN_PID"
+	LISTEN_FDS_ENV     = "LISTEN_FDS"
+	LISTEN_FDNAMES_ENV = "LISTEN_FDNAMES"
+
+	// the first file descriptor passed by socket activation (after stdin, stdout and stderr)
+	LISTEN_FDS_START = 3
+
+	// the name of a socket without a FileDescriptorName
+	DEFAULT_FD_NAME = "unknown"
+
+	STATE_READY     = "READY=1"
+	STATE_RELOADING = "RELOADING=1"
+	STATE_STOPPING  = "STOPPING=1"
+	// followed by the pid of the new main process of the service
+	STATE_MAINPID = "MAINPID="
+)
+
+var (
+	filesOnce sync.Once
+	files     []*os.File
+)
+
+// Notify sends a status (ex: STATE_READY) to the service manager.  It does nothing when the process wasn't started by
+// systemd as a `Type=notify` service (NOTIFY_SOCKET isn't set).
+func Notify(state string) error {
+	path := os.Getenv(NOTIFY_SOCKET_ENV)
+
+	if path == "" {
+		return nil
+	}
+
+	// a path that starts with @ is in the abstract namespace, which the net package handles
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+
+	return err
+}
+
+// Files returns the sockets passed by socket activation, named after their FileDescriptorName.  The sockets are only
+// taken once: the environment variables are unset (and the file descriptors are closed on exec) so that the commands
+// run by the server don't inherit them, and later calls return the same files.
+func Files() []*os.File {
+	filesOnce.Do(func() {
+		count, names := listenFds(os.Getpid(), os.Getenv)
+
+		for i := 0; i < count; i++ {
+			fd := LISTEN_FDS_START + i
+
+			closeOnExec(fd)
+			files = append(files, os.NewFile(uintptr(fd), names[i]))
+		}
+
+		_ = os.Unsetenv(LISTEN_PID_ENV)
+		_ = os.Unsetenv(LISTEN_FDS_ENV)
+		_ = os.Unsetenv(LISTEN_FDNAMES_ENV)
+	})
+
+	return files
+}
+
+// listenFds reads the number of sockets passed to the process pid by socket activation and their names from the
+// environment.  The sockets are meant for another process when LISTEN_PID is not pid.
+func listenFds(pid int, getenv func(string) string) (int, []string) {
+	if listenPid, err := strconv.Atoi(getenv(LISTEN_PID_ENV)); err != nil || listenPid != pid {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(getenv(LISTEN_FDS_ENV))
+
+	if err != nil || count <= 0 {
+		return 0, nil
+	}
+
+	names := make([]string, count)
+
+	var fdNames []string
+
+	if value := getenv(LISTEN_FDNAMES_ENV); value != "" {
+		fdNames = strings.Split(value, ":")
+	}
+
+	for i := range names {
+		names[i] = DEFAULT_FD_NAME
+
+		if i < len(fdNames) && fdNames[i] != "" {
+			names[i] = fdNames[i]
+		}
+	}
+
+	return count, names
+}
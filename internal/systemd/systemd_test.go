@@ -0,0 +1,97 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListenFds(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantCount int
+		wantNames []string
+	}{
+		{
+			name: "not activated",
+			env:  map[string]string{},
+		},
+		{
+			name: "another process",
+			env:  map[string]string{LISTEN_PID_ENV: "1", LISTEN_FDS_ENV: "1"},
+		},
+		{
+			name: "invalid count",
+			env:  map[string]string{LISTEN_PID_ENV: "100", LISTEN_FDS_ENV: "many"},
+		},
+		{
+			name:      "unnamed",
+			env:       map[string]string{LISTEN_PID_ENV: "100", LISTEN_FDS_ENV: "2"},
+			wantCount: 2,
+			wantNames: []string{DEFAULT_FD_NAME, DEFAULT_FD_NAME},
+		},
+		{
+			name:      "named",
+			env:       map[string]string{LISTEN_PID_ENV: "100", LISTEN_FDS_ENV: "3", LISTEN_FDNAMES_ENV: "public:admin"},
+			wantCount: 3,
+			wantNames: []string{"public", "admin", DEFAULT_FD_NAME},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, names := listenFds(100, func(key string) string {
+				return tt.env[key]
+			})
+
+			if count != tt.wantCount || !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("listenFds() = %d, %v, wanted %d, %v", count, names, tt.wantCount, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	_ = os.Unsetenv(NOTIFY_SOCKET_ENV)
+
+	if err := Notify(STATE_READY); err != nil {
+		t.Errorf("Notify() without a notify socket error = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "rc-systemd")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+
+	if err != nil {
+		t.Fatalf("Error listening on the notify socket: %v", err)
+	}
+
+	defer conn.Close()
+
+	_ = os.Setenv(NOTIFY_SOCKET_ENV, path)
+	defer os.Unsetenv(NOTIFY_SOCKET_ENV)
+
+	if err := Notify(STATE_STOPPING); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+
+	if err != nil || string(buf[:n]) != STATE_STOPPING {
+		t.Errorf("notify socket received %q (error = %v), wanted %q", buf[:n], err, STATE_STOPPING)
+	}
+}
@@ -0,0 +1,6 @@
+//+build windows
+
+package systemd
+
+// closeOnExec does nothing since there is no socket activation on windows
+func closeOnExec(int) {}
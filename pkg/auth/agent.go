@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	SSH_AUTH_SOCK_ENV = "SSH_AUTH_SOCK"
+)
+
+// NewAgentSigner signs with a key held by the ssh-agent listening on SSH_AUTH_SOCK
+//
+// The key is the one whose comment or SHA256 fingerprint is name, or the first supported key when name is empty.  The
+// signer's name is the fingerprint of the key, which the server looks up in its authorized_keys file.
+func NewAgentSigner(name string) (*Signer, error) {
+	keys, err := withAgent(func(a agent.ExtendedAgent) (interface{}, error) {
+		return a.List()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys.([]*agent.Key) {
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		if name != "" && name != key.Comment && name != fingerprint {
+			continue
+		}
+
+		pubKey, err := ssh.ParsePublicKey(key.Blob)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cryptoKey, ok := pubKey.(ssh.CryptoPublicKey); !ok || checkPublicKey(cryptoKey.CryptoPublicKey()) != nil {
+			if name == "" {
+				continue
+			}
+
+			return nil, errors.New("unsupported ssh-agent key type " + key.Type())
+		}
+
+		return newAgentSigner(fingerprint, pubKey), nil
+	}
+
+	if name == "" {
+		return nil, errors.New("ssh-agent has no supported keys")
+	}
+
+	return nil, errors.New("ssh-agent has no key named " + name)
+}
+
+func newAgentSigner(name string, key ssh.PublicKey) *Signer {
+	var flags agent.SignatureFlags
+
+	if key.Type() == ssh.KeyAlgoRSA {
+		// RSA keys must not use the default (SHA-1) signature algorithm
+		flags = agent.SignatureFlagRsaSha256
+	}
+
+	sign := func(data []byte) ([]byte, error) {
+		sig, err := withAgent(func(a agent.ExtendedAgent) (interface{}, error) {
+			return a.SignWithFlags(key, data, flags)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return ssh.Marshal(sig.(*ssh.Signature)), nil
+	}
+
+	return &Signer{Name: name, sign: sign}
+}
+
+// withAgent calls f with a new connection to the ssh-agent
+func withAgent(f func(agent.ExtendedAgent) (interface{}, error)) (interface{}, error) {
+	sock := os.Getenv(SSH_AUTH_SOCK_ENV)
+
+	if sock == "" {
+		return nil, errors.New(SSH_AUTH_SOCK_ENV + " is not set")
+	}
+
+	conn, err := net.Dial("unix", sock)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to ssh-agent")
+	}
+
+	defer conn.Close()
+
+	return f(agent.NewClient(conn))
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startAgent serves an in memory ssh-agent holding the keys on SSH_AUTH_SOCK
+func startAgent(t *testing.T, keys map[string]string) func() {
+	dir, err := ioutil.TempDir("", "rc-agent")
+
+	if err != nil {
+		t.Fatalf("Error creating agent dir: %v", err)
+	}
+
+	keyring := agent.NewKeyring()
+
+	for comment, name := range keys {
+		key, _, err := loadPrivateKey(filepath.Join(keyDir, name), nil)
+
+		if err != nil {
+			t.Fatalf("Error loading key %s: %v", name, err)
+		}
+
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: comment}); err != nil {
+			t.Fatalf("Error adding key %s to agent: %v", name, err)
+		}
+	}
+
+	sock := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", sock)
+
+	if err != nil {
+		t.Fatalf("Error listening on %s: %v", sock, err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	oldSock := os.Getenv(SSH_AUTH_SOCK_ENV)
+	_ = os.Setenv(SSH_AUTH_SOCK_ENV, sock)
+
+	return func() {
+		_ = os.Setenv(SSH_AUTH_SOCK_ENV, oldSock)
+		_ = listener.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestNewAgentSigner(t *testing.T) {
+	stop := startAgent(t, map[string]string{"rsa": "client.key", "alice@laptop": "id_ed25519"})
+	defer stop()
+
+	v := NewVerifier(certDir, authorizedKeysFile, time.Minute)
+
+	keys, _ := loadAuthorizedKeys(authorizedKeysFile)
+	alice, _ := findAuthorizedKey(keys, "alice")
+
+	// the agent signs with the key that has a matching comment and identifies it by fingerprint
+	signer, err := NewAgentSigner("alice@laptop")
+
+	if err != nil || signer.Name != alice.fingerprint {
+		t.Errorf("NewAgentSigner() = %v, %v, wanted a signer named %s", signer, err, alice.fingerprint)
+		return
+	}
+
+	h, err := signer.CreateHeader("")
+
+	if err != nil {
+		t.Errorf("CreateHeader() error = %v, wanted %v", err, nil)
+		return
+	}
+
+	if identity, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != nil || identity.Command != "echo restricted" {
+		t.Errorf("Verify() = %v, %v, wanted the alice key", identity, err)
+	}
+
+	// rsa agent signatures use SHA-256 and verify against PEM keys
+	signer, err = NewAgentSigner("rsa")
+
+	if err != nil {
+		t.Errorf("NewAgentSigner() error = %v, wanted %v", err, nil)
+		return
+	}
+
+	sig, _ := signer.Sign([]byte("data"))
+
+	var sshSig ssh.Signature
+
+	if err := ssh.Unmarshal(sig, &sshSig); err != nil || sshSig.Format != ssh.SigAlgoRSASHA2256 {
+		t.Errorf("Sign() format = %s, %v, wanted %s", sshSig.Format, err, ssh.SigAlgoRSASHA2256)
+	}
+
+	if err := v.VerifySignature("client", []byte("data"), sig); err != nil {
+		t.Errorf("VerifySignature() error = %v, wanted %v", err, nil)
+	}
+
+	if _, err := NewAgentSigner("bob"); err == nil {
+		t.Error("NewAgentSigner() should fail for unknown keys")
+	}
+}
+
+func TestNewAgentSigner_No_Agent(t *testing.T) {
+	oldSock := os.Getenv(SSH_AUTH_SOCK_ENV)
+	defer os.Setenv(SSH_AUTH_SOCK_ENV, oldSock)
+
+	_ = os.Unsetenv(SSH_AUTH_SOCK_ENV)
+
+	if _, err := NewAgentSigner(""); err == nil {
+		t.Error("NewAgentSigner() should fail without SSH_AUTH_SOCK")
+	}
+}
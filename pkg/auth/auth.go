@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	HEADER_NAME      = "Authorization"
+	HEADER_SCHEME    = "RC"
+	TIMESTAMP_FORMAT = "2006-01-02T15:04:05-0700"
+	NONCE_SIZE       = 16
+	KEY_EXTENSION    = ".key"
+)
+
+var (
+	ErrInvalidHeader       = errors.New("invalid format for authorization header")
+	ErrUnknownKey          = errors.New("unknown key")
+	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrStaleTimestamp      = errors.New("timestamp outside of the allowed clock skew")
+	ErrReplayedNonce       = errors.New("nonce has already been used")
+	ErrWrongServer         = errors.New("header is not bound to this server")
+	ErrAddressNotAllowed   = errors.New("key is not allowed from the client's address")
+	ErrKeyRevoked          = errors.New("key has been revoked")
+	ErrKeyExpired          = errors.New("key has expired")
+	ErrKeyNotYetValid      = errors.New("key is not valid yet")
+	ErrPassphraseRequired  = errors.New("private key is encrypted and no passphrase is available")
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase for private key")
+)
+
+var headerPattern = regexp.MustCompile(`^` + HEADER_SCHEME + ` ([^\s;]+);([^\s;]+);([0-9a-f]+);(?:([^\s;]+);)?([A-Za-z0-9+/=]+)$`)
+
+// Header is the parsed value of the Authorization header
+//
+// Format: `RC <name>;<iso_8601_timestamp>;<nonce>;<host>;<signature>`, where the signature covers
+// `<name>;<iso_8601_timestamp>;<nonce>;<host>` and the name is a file name in the server's certDir or the comment or
+// SHA256 fingerprint of an authorized_keys entry.  The host is the name of the server that the client connects to, so
+// that a header can't be used on another server.  Older clients leave it out (and only sign
+// `<iso_8601_timestamp>;<nonce>`).
+type Header struct {
+	Name      string
+	Timestamp string
+	Nonce     string
+	Host      string
+	Signature []byte
+}
+
+func ParseHeader(header string) (*Header, error) {
+	matches := headerPattern.FindStringSubmatch(header)
+
+	if matches == nil {
+		return nil, ErrInvalidHeader
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(matches[5])
+
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	h := Header{
+		Name:      matches[1],
+		Timestamp: matches[2],
+		Nonce:     matches[3],
+		Host:      matches[4],
+		Signature: sig,
+	}
+
+	return &h, nil
+}
+
+func (h *Header) String() string {
+	fields := []string{h.Name, h.Timestamp, h.Nonce}
+
+	if h.Host != "" {
+		fields = append(fields, h.Host)
+	}
+
+	return HEADER_SCHEME + " " + strings.Join(append(fields, base64.StdEncoding.EncodeToString(h.Signature)), ";")
+}
+
+// SignedData is the data covered by the signature
+func (h *Header) SignedData() []byte {
+	if h.Host == "" {
+		return []byte(h.Timestamp + ";" + h.Nonce)
+	}
+
+	return []byte(h.Name + ";" + h.Timestamp + ";" + h.Nonce + ";" + h.Host)
+}
+
+func (h *Header) Time() (time.Time, error) {
+	return time.Parse(TIMESTAMP_FORMAT, h.Timestamp)
+}
+
+// Signer signs with a private key that is only loaded once (or with a key held by ssh-agent)
+type Signer struct {
+	Name string
+	sign func(data []byte) ([]byte, error)
+}
+
+// PassphraseFunc returns the passphrase of the encrypted private key at path
+type PassphraseFunc func(path string) ([]byte, error)
+
+// decryptedKeys holds the encrypted private keys that have already been decrypted (by path) so that a process only
+// asks for a passphrase once
+var decryptedKeys = struct {
+	keys map[string]crypto.Signer
+	lock sync.Mutex
+}{keys: map[string]crypto.Signer{}}
+
+// NewSigner loads the private key `<keyDir>/<name>.key` (or `<keyDir>/<name>`, ex: an OpenSSH key in `~/.ssh`)
+func NewSigner(name string, keyDir string) (*Signer, error) {
+	return NewSignerWithPassphrase(name, keyDir, nil)
+}
+
+// NewSignerWithPassphrase loads the private key like NewSigner and decrypts it with the passphrase returned by
+// passphrase if it is encrypted.  Decrypted keys are kept for the lifetime of the process.
+func NewSignerWithPassphrase(name string, keyDir string, passphrase PassphraseFunc) (*Signer, error) {
+	path := filepath.Join(keyDir, name+KEY_EXTENSION)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		path = filepath.Join(keyDir, name)
+	}
+
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+
+	// only one key is loaded at a time so that concurrent clients don't all ask for the passphrase
+	decryptedKeys.lock.Lock()
+	defer decryptedKeys.lock.Unlock()
+
+	if key, ok := decryptedKeys.keys[path]; ok {
+		return newKeySigner(name, key), nil
+	}
+
+	key, encrypted, err := loadPrivateKey(path, passphrase)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypted {
+		decryptedKeys.keys[path] = key
+	}
+
+	return newKeySigner(name, key), nil
+}
+
+func newKeySigner(name string, key crypto.Signer) *Signer {
+	sign := func(data []byte) ([]byte, error) {
+		if _, ok := key.(ed25519.PrivateKey); ok {
+			// ed25519 signs the message itself
+			return key.Sign(rand.Reader, data, crypto.Hash(0))
+		}
+
+		hashSum := sha256.Sum256(data)
+
+		return key.Sign(rand.Reader, hashSum[:], crypto.SHA256)
+	}
+
+	return &Signer{Name: name, sign: sign}
+}
+
+// CreateSig creates the Authorization header value for the private key `<keyDir>/<name>.key`, for the server host
+// ("" for a header that isn't bound to a server)
+func CreateSig(name string, keyDir string, host string) (string, error) {
+	return createSig(name, keyDir, host, time.Now())
+}
+
+func createSig(name string, keyDir string, host string, timestamp time.Time) (string, error) {
+	signer, err := NewSigner(name, keyDir)
+
+	if err != nil {
+		return "", err
+	}
+
+	h, err := signer.createHeader(host, timestamp)
+
+	if err != nil {
+		return "", err
+	}
+
+	return h.String(), nil
+}
+
+// CreateHeader creates a new (single use) Authorization header for the server host (its name without the port, ""
+// for a header that isn't bound to a server)
+func (s *Signer) CreateHeader(host string) (*Header, error) {
+	return s.createHeader(host, time.Now())
+}
+
+func (s *Signer) createHeader(host string, timestamp time.Time) (*Header, error) {
+	nonce := make([]byte, NONCE_SIZE)
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	h := Header{
+		Name:      s.Name,
+		Timestamp: timestamp.Format(TIMESTAMP_FORMAT),
+		Nonce:     hex.EncodeToString(nonce),
+		Host:      strings.ToLower(host),
+	}
+
+	sig, err := s.Sign(h.SignedData())
+
+	if err != nil {
+		return nil, err
+	}
+
+	h.Signature = sig
+
+	return &h, nil
+}
+
+// Sign creates a signature of data: RSA-SHA256 (PKCS #1 v1.5), ECDSA-SHA256 (ASN.1) or Ed25519 depending on the key.
+// Signatures made by ssh-agent are in the SSH wire format.
+func (s *Signer) Sign(data []byte) ([]byte, error) {
+	return s.sign(data)
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var (
+	keyDir  = filepath.Join("..", "..", "test", "client", "keys")
+	certDir = filepath.Join("..", "..", "test", "server", "certs")
+)
+
+func TestCreateSig(t *testing.T) {
+	want := regexp.MustCompile(`^RC client;\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[-+]\d{4};[0-9a-f]{32};.{50,}$`)
+
+	sig, err := CreateSig("client", keyDir, "")
+
+	if err != nil || !want.MatchString(sig) {
+		t.Errorf("CreateSig() = %q, %v, wanted %q", sig, err, want.String())
+	}
+
+	if _, err := CreateSig("missing", keyDir, ""); err == nil {
+		t.Error("CreateSig() should fail for a missing key")
+	}
+
+	want = regexp.MustCompile(`^RC client;[^;]+;[0-9a-f]{32};rc1\.example\.com;.{50,}$`)
+
+	if sig, err := CreateSig("client", keyDir, "RC1.example.com"); err != nil || !want.MatchString(sig) {
+		t.Errorf("CreateSig() for a host = %q, %v, wanted %q", sig, err, want.String())
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	sig, _ := CreateSig("client", keyDir, "")
+
+	h, err := ParseHeader(sig)
+
+	if err != nil {
+		t.Errorf("ParseHeader() error = %v, wanted %v", err, nil)
+		return
+	}
+
+	if h.Name != "client" || h.Host != "" || h.String() != sig {
+		t.Errorf("ParseHeader() = %v, wanted name client and %q", h, sig)
+	}
+
+	sig, _ = CreateSig("client", keyDir, "rc1.example.com")
+
+	if h, err := ParseHeader(sig); err != nil || h.Host != "rc1.example.com" || h.String() != sig {
+		t.Errorf("ParseHeader() = %v, %v, wanted host rc1.example.com and %q", h, err, sig)
+	}
+
+	for _, header := range []string{"", "RC client;2020-01-01T04:01:59-0700;c0ffee", "RC cli ent;2020-01-01T04:01:59-0700;c0ffee;c2ln", "Basic Zm9vOmJhcg=="} {
+		if _, err := ParseHeader(header); err != ErrInvalidHeader {
+			t.Errorf("ParseHeader(%q) error = %v, wanted %v", header, err, ErrInvalidHeader)
+		}
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	v := NewVerifier(certDir, "", time.Minute)
+
+	sig, _ := CreateSig("client", keyDir, "")
+
+	if h, err := v.Verify(sig, "", "127.0.0.1:4000"); err != nil || h.Name != "client" {
+		t.Errorf("Verify() = %v, %v, wanted a valid header for client", h, err)
+	}
+
+	// a header can only be used once
+	if _, err := v.Verify(sig, "", "127.0.0.1:4000"); err != ErrReplayedNonce {
+		t.Errorf("Verify() replayed header error = %v, wanted %v", err, ErrReplayedNonce)
+	}
+
+	// timestamps must be within the clock skew
+	for _, offset := range []time.Duration{-2 * time.Minute, 2 * time.Minute} {
+		stale, _ := createSig("client", keyDir, "", time.Now().Add(offset))
+
+		if _, err := v.Verify(stale, "", "127.0.0.1:4000"); err != ErrStaleTimestamp {
+			t.Errorf("Verify() stale header error = %v, wanted %v", err, ErrStaleTimestamp)
+		}
+	}
+
+	// the signature must match the header
+	h, _ := ParseHeader(sig)
+	h.Nonce = "c0ffee"
+
+	if _, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != ErrInvalidSignature {
+		t.Errorf("Verify() tampered header error = %v, wanted %v", err, ErrInvalidSignature)
+	}
+
+	// names are file names in certDir
+	for _, name := range []string{"missing", "../certs/client", ".."} {
+		h.Name = name
+
+		if _, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != ErrUnknownKey {
+			t.Errorf("Verify() unknown key %s error = %v, wanted %v", name, err, ErrUnknownKey)
+		}
+	}
+}
+
+func TestVerifier_Verify_Alias(t *testing.T) {
+	v := NewVerifier(certDir, authorizedKeysFile, time.Minute)
+
+	// id_ed25519 in certDir is also alice in authorized_keys and can be found by its fingerprint
+	sig, _ := CreateSig("id_ed25519", keyDir, "")
+
+	if _, err := v.Verify(sig, "", "127.0.0.1:4000"); err != nil {
+		t.Fatalf("Verify() error = %v, wanted %v", err, nil)
+	}
+
+	h, _ := ParseHeader(sig)
+
+	for _, name := range []string{"alice", "SHA256:kKGZeK3IfrFdBM6/Ku1Ir/hXb+MUL124Tj1GdNgERcE"} {
+		h.Name = name
+
+		if _, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != ErrReplayedNonce {
+			t.Errorf("Verify() header replayed as %s error = %v, wanted %v", name, err, ErrReplayedNonce)
+		}
+	}
+
+	// the name is signed when the header is bound to a server
+	sig, _ = CreateSig("id_ed25519", keyDir, "rc1.example.com")
+	h, _ = ParseHeader(sig)
+	h.Name = "alice"
+
+	if _, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != ErrInvalidSignature {
+		t.Errorf("Verify() renamed header error = %v, wanted %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestVerifier_BindServerNames(t *testing.T) {
+	v := NewVerifier(certDir, "", time.Minute)
+
+	// without names, the host isn't checked
+	for _, host := range []string{"", "rc2.example.com"} {
+		sig, _ := CreateSig("client", keyDir, host)
+
+		if _, err := v.Verify(sig, "", "127.0.0.1:4000"); err != nil {
+			t.Errorf("Verify() header for %q error = %v, wanted %v", host, err, nil)
+		}
+	}
+
+	v.BindServerNames([]string{"RC1.example.com", "10.0.0.1"}, false)
+
+	tests := []struct {
+		host string
+		want error
+	}{
+		{"rc1.example.com", nil},
+		{"10.0.0.1", nil},
+		{"rc2.example.com", ErrWrongServer},
+		{"", ErrWrongServer},
+	}
+
+	for _, tt := range tests {
+		sig, _ := CreateSig("client", keyDir, tt.host)
+
+		if _, err := v.Verify(sig, "", "127.0.0.1:4000"); err != tt.want {
+			t.Errorf("Verify() header for %q error = %v, wanted %v", tt.host, err, tt.want)
+		}
+	}
+
+	// the host is covered by the signature
+	sig, _ := CreateSig("client", keyDir, "rc2.example.com")
+	h, _ := ParseHeader(sig)
+	h.Host = "rc1.example.com"
+
+	if _, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != ErrInvalidSignature {
+		t.Errorf("Verify() header moved to another host error = %v, wanted %v", err, ErrInvalidSignature)
+	}
+
+	// headers of older clients can still be allowed
+	v.BindServerNames([]string{"rc1.example.com"}, true)
+	sig, _ = CreateSig("client", keyDir, "")
+
+	if _, err := v.Verify(sig, "", "127.0.0.1:4000"); err != nil {
+		t.Errorf("Verify() header without a host error = %v, wanted %v", err, nil)
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	c := newNonceCache()
+
+	if !c.add("a", time.Now().Add(time.Minute)) {
+		t.Error("add() should accept a new nonce")
+	}
+
+	if c.add("a", time.Now().Add(time.Minute)) {
+		t.Error("add() should reject a known nonce")
+	}
+
+	// expired nonces are forgotten
+	c.add("b", time.Now().Add(-time.Second))
+	c.lastPurge = time.Now().Add(-time.Minute)
+	c.add("c", time.Now().Add(time.Minute))
+
+	if _, ok := c.nonces["b"]; ok {
+		t.Error("purge() should forget expired nonces")
+	}
+}
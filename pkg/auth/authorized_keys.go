@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/cthayer/remote_control/internal/logger"
+)
+
+const (
+	AUTHORIZED_KEYS_OPTION_FROM           = "from"
+	AUTHORIZED_KEYS_OPTION_COMMAND        = "command"
+	AUTHORIZED_KEYS_OPTION_EXPIRY_TIME    = "expiry-time"
+	AUTHORIZED_KEYS_OPTION_CERT_AUTHORITY = "cert-authority"
+)
+
+// noopAuthorizedKeysOptions are the options that only take away features that the server doesn't have (ptys,
+// forwarding and ~/.ssh/rc), so there is nothing to enforce
+var noopAuthorizedKeysOptions = map[string]bool{
+	"restrict":            true,
+	"no-agent-forwarding": true,
+	"no-port-forwarding":  true,
+	"no-pty":              true,
+	"no-user-rc":          true,
+	"no-x11-forwarding":   true,
+}
+
+// expiryTimeFormats are the formats of the expiry-time option (in local time, or UTC with a Z suffix)
+var expiryTimeFormats = []string{"20060102", "200601021504", "20060102150405"}
+
+// authorizedKey is an entry of an OpenSSH authorized_keys file
+type authorizedKey struct {
+	key         crypto.PublicKey
+	comment     string
+	fingerprint string
+	// from is the pattern list of client addresses that may use the key ("" allows any address)
+	from string
+	// command is the command that is run instead of the commands sent by the client ("" allows any command)
+	command string
+	// expires is when the key stops being accepted (zero if never)
+	expires time.Time
+	// certAuthority is true when the key is a certificate authority rather than the key of a client
+	certAuthority bool
+}
+
+// loadAuthorizedKeys parses an OpenSSH authorized_keys file.  Entries with unsupported key types are skipped, and so
+// are the entries with options that the server can't enforce (ex: environment= or principals=), which are logged.
+func loadAuthorizedKeys(path string) ([]authorizedKey, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]authorizedKey, 0)
+
+	for len(bytes.TrimSpace(data)) > 0 {
+		sshKey, comment, options, rest, err := ssh.ParseAuthorizedKey(data)
+
+		if err != nil {
+			// ParseAuthorizedKey skips invalid lines, so this only happens when there are no more keys
+			break
+		}
+
+		data = rest
+
+		cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+
+		if !ok || checkPublicKey(cryptoKey.CryptoPublicKey()) != nil {
+			continue
+		}
+
+		key := authorizedKey{
+			key:         cryptoKey.CryptoPublicKey(),
+			comment:     comment,
+			fingerprint: ssh.FingerprintSHA256(sshKey),
+		}
+
+		if err := key.setOptions(options); err != nil {
+			logUnsupportedKey(path, key, err)
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// logUnsupportedKey logs an authorized_keys entry that is skipped because of its options (the logger isn't set up when
+// the package is used as a library without it)
+func logUnsupportedKey(path string, key authorizedKey, err error) {
+	if log := logger.GetLogger(); log != nil {
+		log.Warn("Skipping authorized key with an unsupported option", zap.String("file", path), zap.String("key", key.fingerprint), zap.String("comment", key.comment), zap.Error(err))
+	}
+}
+
+// setOptions applies the options of an authorized_keys entry to the key
+func (k *authorizedKey) setOptions(options []string) error {
+	for _, option := range options {
+		name, value := parseAuthorizedKeysOption(option)
+
+		switch {
+		case name == AUTHORIZED_KEYS_OPTION_FROM:
+			k.from = value
+		case name == AUTHORIZED_KEYS_OPTION_COMMAND:
+			k.command = value
+		case name == AUTHORIZED_KEYS_OPTION_EXPIRY_TIME:
+			expires, err := parseExpiryTime(value)
+
+			if err != nil {
+				return errors.Wrap(err, "invalid "+AUTHORIZED_KEYS_OPTION_EXPIRY_TIME)
+			}
+
+			k.expires = expires
+		case name == AUTHORIZED_KEYS_OPTION_CERT_AUTHORITY:
+			k.certAuthority = true
+		case noopAuthorizedKeysOptions[name]:
+		default:
+			return errors.New("unsupported option " + name)
+		}
+	}
+
+	return nil
+}
+
+// parseExpiryTime parses the value of the expiry-time option: YYYYMMDD[HHMM[SS]] in local time, or in UTC with a Z
+// suffix
+func parseExpiryTime(value string) (time.Time, error) {
+	location := time.Local
+
+	if strings.HasSuffix(value, "Z") {
+		location = time.UTC
+		value = strings.TrimSuffix(value, "Z")
+	}
+
+	for _, format := range expiryTimeFormats {
+		if len(value) == len(format) {
+			return time.ParseInLocation(format, value, location)
+		}
+	}
+
+	return time.Time{}, errors.New("expected YYYYMMDD[HHMM[SS]][Z]: " + value)
+}
+
+// expired tells whether the key is past its expiry-time
+func (k *authorizedKey) expired(now time.Time) bool {
+	return !k.expires.IsZero() && !now.Before(k.expires)
+}
+
+// findAuthorizedKey returns the key whose fingerprint or comment is name (certificate authorities aren't the keys of
+// clients, see findCertAuthority)
+func findAuthorizedKey(keys []authorizedKey, name string) (*authorizedKey, bool) {
+	for i := range keys {
+		if keys[i].certAuthority {
+			continue
+		}
+
+		if keys[i].fingerprint == name || keys[i].comment == name {
+			return &keys[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// findCertAuthority returns the certificate authority whose fingerprint is fingerprint
+func findCertAuthority(keys []authorizedKey, fingerprint string) (*authorizedKey, bool) {
+	for i := range keys {
+		if keys[i].certAuthority && keys[i].fingerprint == fingerprint {
+			return &keys[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func parseAuthorizedKeysOption(option string) (string, string) {
+	parts := strings.SplitN(option, "=", 2)
+	name := strings.ToLower(parts[0])
+
+	if len(parts) == 1 {
+		return name, ""
+	}
+
+	value := parts[1]
+
+	if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		value = strings.ReplaceAll(value[1:len(value)-1], "\\\"", "\"")
+	}
+
+	return name, value
+}
+
+// allowsAddress checks the remote address of a client against the key's `from` pattern list
+func (k *authorizedKey) allowsAddress(remoteAddr string) bool {
+	return allowsAddress(k.from, remoteAddr)
+}
+
+// allowsAddress checks the remote address of a client against a pattern list ("" allows any address)
+//
+// Patterns are IP addresses, CIDR ranges or IP address wildcards (`*` and `?`).  A pattern prefixed with `!` denies
+// the addresses it matches.  Host name patterns are not supported since that would require reverse DNS lookups.
+func allowsAddress(from string, remoteAddr string) bool {
+	if from == "" {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return false
+	}
+
+	allowed := false
+
+	for _, pattern := range strings.Split(from, ",") {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		if !matchAddress(pattern, ip) {
+			continue
+		}
+
+		if negate {
+			return false
+		}
+
+		allowed = true
+	}
+
+	return allowed
+}
+
+func matchAddress(pattern string, ip net.IP) bool {
+	if strings.Contains(pattern, "/") {
+		_, network, err := net.ParseCIDR(pattern)
+
+		return err == nil && network.Contains(ip)
+	}
+
+	if patternIp := net.ParseIP(pattern); patternIp != nil {
+		return patternIp.Equal(ip)
+	}
+
+	matched, err := path.Match(pattern, ip.String())
+
+	return err == nil && matched
+}
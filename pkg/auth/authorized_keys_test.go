@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var authorizedKeysFile = filepath.Join("..", "..", "test", "server", "authorized_keys")
+
+func TestLoadAuthorizedKeys(t *testing.T) {
+	keys, err := loadAuthorizedKeys(authorizedKeysFile)
+
+	if err != nil || len(keys) != 2 {
+		t.Errorf("loadAuthorizedKeys() = %v, %v, wanted 2 keys", keys, err)
+		return
+	}
+
+	alice, ok := findAuthorizedKey(keys, "alice")
+
+	if !ok || alice.from != "127.0.0.1,10.*,!10.0.0.1" || alice.command != "echo restricted" {
+		t.Errorf("findAuthorizedKey() = %v, wanted the alice key with its options", alice)
+	}
+
+	if key, ok := findAuthorizedKey(keys, keys[1].fingerprint); !ok || key.comment != "ecdsa-ssh" {
+		t.Errorf("findAuthorizedKey() by fingerprint = %v, wanted the ecdsa-ssh key", key)
+	}
+
+	if _, ok := findAuthorizedKey(keys, "bob"); ok {
+		t.Error("findAuthorizedKey() should not find unknown keys")
+	}
+}
+
+func TestLoadAuthorizedKeys_Options(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-authorized-keys")
+
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	const (
+		aliceKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPT/CE/C7/WLXgQak0hDK9JH4QLsHSXGnGode7ZCl10s"
+		caKey    = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlHHojXtRu2DrO3wQydirHTfBu6ORXp0RlCvY0cbDgN"
+	)
+
+	path := filepath.Join(dir, "authorized_keys")
+	entries := []string{
+		`restrict,no-pty,expiry-time="20200101Z" ` + aliceKey + ` alice`,
+		`environment="PATH=/tmp" ` + aliceKey + ` environment`,
+		`expiry-time="tomorrow" ` + aliceKey + ` invalid-expiry`,
+		`cert-authority,principals="bob" ` + caKey + ` principals`,
+		`cert-authority,from="127.0.0.1" ` + caKey + ` ca`,
+	}
+	data := ""
+
+	for _, entry := range entries {
+		data += entry + "\n"
+	}
+
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	keys, err := loadAuthorizedKeys(path)
+
+	// the entries with options that can't be enforced are skipped
+	if err != nil || len(keys) != 2 || keys[0].comment != "alice" || keys[1].comment != "ca" {
+		t.Fatalf("loadAuthorizedKeys() = %v, %v, wanted the alice and ca entries", keys, err)
+	}
+
+	if want := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC); !keys[0].expires.Equal(want) || !keys[0].expired(time.Now()) {
+		t.Errorf("expiry-time = %v, wanted %v", keys[0].expires, want)
+	}
+
+	// certificate authorities aren't the keys of clients
+	if _, ok := findAuthorizedKey(keys, "ca"); ok {
+		t.Error("findAuthorizedKey() should not find certificate authorities")
+	}
+
+	if ca, ok := findCertAuthority(keys, keys[1].fingerprint); !ok || ca.from != "127.0.0.1" {
+		t.Errorf("findCertAuthority() = %v, wanted the ca entry", ca)
+	}
+
+	v := NewVerifier("", path, time.Minute)
+
+	signer, _ := NewSigner("id_ed25519", keyDir)
+	signer.Name = "alice"
+	h, _ := signer.CreateHeader("")
+
+	if _, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != ErrKeyExpired {
+		t.Errorf("Verify() past the expiry-time error = %v, wanted %v", err, ErrKeyExpired)
+	}
+
+	// the options of a cert-authority entry apply to its certificates
+	for remoteAddr, want := range map[string]error{"127.0.0.1:4000": nil, "10.1.2.3:4000": ErrAddressNotAllowed} {
+		header, cert := certificateHeaders(t, "id_ed25519", "id_ed25519-cert.pub", "deploy")
+
+		if _, err := v.Verify(header, cert, remoteAddr); err != want {
+			t.Errorf("Verify() certificate from %s error = %v, wanted %v", remoteAddr, err, want)
+		}
+	}
+}
+
+func TestAuthorizedKey_AllowsAddress(t *testing.T) {
+	key := authorizedKey{from: "127.0.0.1,10.*,!10.0.0.1,192.168.0.0/16,::1"}
+
+	tests := map[string]bool{
+		"127.0.0.1:4000":   true,
+		"10.1.2.3:4000":    true,
+		"10.0.0.1:4000":    false,
+		"192.168.1.1:4000": true,
+		"[::1]:4000":       true,
+		"172.16.0.1:4000":  false,
+		"invalid":          false,
+	}
+
+	for addr, want := range tests {
+		if got := key.allowsAddress(addr); got != want {
+			t.Errorf("allowsAddress(%s) = %v, wanted %v", addr, got, want)
+		}
+	}
+
+	if key := (authorizedKey{}); !key.allowsAddress("172.16.0.1:4000") {
+		t.Error("allowsAddress() should allow any address without a from option")
+	}
+}
+
+func TestVerifier_Authorized_Keys(t *testing.T) {
+	v := NewVerifier(certDir, authorizedKeysFile, time.Minute)
+
+	// authorized_keys entries are found by comment and take their options with them
+	signer, _ := NewSigner("id_ed25519", keyDir)
+	signer.Name = "alice"
+	h, _ := signer.CreateHeader("")
+
+	identity, err := v.Verify(h.String(), "", "127.0.0.1:4000")
+
+	if err != nil || identity.Name != "alice" || identity.Command != "echo restricted" {
+		t.Errorf("Verify() = %v, %v, wanted alice with a forced command", identity, err)
+	}
+
+	h, _ = signer.CreateHeader("")
+
+	if _, err := v.Verify(h.String(), "", "10.0.0.1:4000"); err != ErrAddressNotAllowed {
+		t.Errorf("Verify() from a denied address error = %v, wanted %v", err, ErrAddressNotAllowed)
+	}
+
+	// keys in certDir are still found
+	sig, _ := CreateSig("client", keyDir, "")
+
+	if identity, err := v.Verify(sig, "", "172.16.0.1:4000"); err != nil || identity.Command != "" {
+		t.Errorf("Verify() certDir key = %v, %v, wanted no error and no forced command", identity, err)
+	}
+
+	// OpenSSH public keys in certDir
+	sig, _ = CreateSig("id_ed25519", keyDir, "")
+
+	if _, err := v.Verify(sig, "", "172.16.0.1:4000"); err != nil {
+		t.Errorf("Verify() OpenSSH public key error = %v, wanted %v", err, nil)
+	}
+}
+
+func TestVerifier_Reload_Authorized_Keys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-authorized-keys")
+
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	const aliceKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPT/CE/C7/WLXgQak0hDK9JH4QLsHSXGnGode7ZCl10s"
+
+	path := filepath.Join(dir, "authorized_keys")
+
+	if err := ioutil.WriteFile(path, []byte(aliceKey+" alice\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	v := NewVerifier("", path, time.Minute)
+	signer, _ := NewSigner("id_ed25519", keyDir)
+
+	verify := func(name string) error {
+		signer.Name = name
+		h, _ := signer.CreateHeader("")
+
+		_, err := v.Verify(h.String(), "", "127.0.0.1:4000")
+
+		return err
+	}
+
+	if err := verify("alice"); err != nil {
+		t.Errorf("Verify() error = %v, wanted %v", err, nil)
+	}
+
+	// the file is only read again by ReloadKeyPolicy
+	if err := ioutil.WriteFile(path, []byte(aliceKey+" bob\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if err := verify("alice"); err != nil {
+		t.Errorf("Verify() before the reload error = %v, wanted %v", err, nil)
+	}
+
+	if err := v.ReloadKeyPolicy(); err != nil {
+		t.Fatalf("ReloadKeyPolicy() error = %v", err)
+	}
+
+	if err := verify("alice"); err != ErrUnknownKey {
+		t.Errorf("Verify() of a removed entry error = %v, wanted %v", err, ErrUnknownKey)
+	}
+
+	// the current keys are kept when the file can't be read
+	_ = os.Remove(path)
+
+	if err := v.ReloadKeyPolicy(); err == nil {
+		t.Error("ReloadKeyPolicy() of a missing file should fail")
+	}
+
+	if err := verify("bob"); err != nil {
+		t.Errorf("Verify() after a failed reload error = %v, wanted %v", err, nil)
+	}
+}
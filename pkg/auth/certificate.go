@@ -0,0 +1,439 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	CERTIFICATE_HEADER_NAME = "X-RC-Certificate"
+
+	CERTIFICATE_TYPE_SSH  = "ssh"
+	CERTIFICATE_TYPE_X509 = "x509"
+
+	SSH_CERT_OPTION_FORCE_COMMAND  = "force-command"
+	SSH_CERT_OPTION_SOURCE_ADDRESS = "source-address"
+
+	SPKI_FINGERPRINT_PREFIX = "sha256/"
+)
+
+var (
+	ErrInvalidCertificate   = errors.New("invalid certificate")
+	ErrUntrustedCertificate = errors.New("certificate is not issued by a trusted certificate authority")
+	ErrPrincipalNotAllowed  = errors.New("certificate is not valid for the name")
+	ErrMissingExtension     = errors.New("certificate lacks a required extension")
+)
+
+// Certificate is a client certificate that is sent along with the Authorization header
+//
+// The header value is `ssh <base64 certificate>` for OpenSSH certificates or `x509 <base64 DER>[,<base64 DER>...]`
+// for X.509 certificates, where the leaf certificate is followed by its intermediate certificates.
+type Certificate struct {
+	// Principals are the names that the certificate is valid for (SSH principals or the X.509 common name, DNS
+	// names and email addresses)
+	Principals []string
+	header     string
+}
+
+// LoadCertificate loads an OpenSSH certificate (ex: `id_ed25519-cert.pub`) or a PEM encoded X.509 certificate
+// (followed by its intermediate certificates)
+func LoadCertificate(path string) (*Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		return parseX509CertificatePEM(data)
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse certificate "+path)
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+
+	if !ok {
+		return nil, errors.New("not a certificate: " + path)
+	}
+
+	c := Certificate{
+		Principals: cert.ValidPrincipals,
+		header:     CERTIFICATE_TYPE_SSH + " " + base64.StdEncoding.EncodeToString(cert.Marshal()),
+	}
+
+	return &c, nil
+}
+
+func parseX509CertificatePEM(data []byte) (*Certificate, error) {
+	var encoded []string
+	var leaf *x509.Certificate
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		if leaf == nil {
+			cert, err := x509.ParseCertificate(block.Bytes)
+
+			if err != nil {
+				return nil, err
+			}
+
+			leaf = cert
+		}
+
+		encoded = append(encoded, base64.StdEncoding.EncodeToString(block.Bytes))
+	}
+
+	if leaf == nil {
+		return nil, errors.New("no certificate found")
+	}
+
+	c := Certificate{
+		Principals: x509Principals(leaf),
+		header:     CERTIFICATE_TYPE_X509 + " " + strings.Join(encoded, ","),
+	}
+
+	return &c, nil
+}
+
+// Name returns name when the certificate is valid for it and the first principal of the certificate otherwise
+func (c *Certificate) Name(name string) string {
+	if containsString(c.Principals, name) {
+		return name
+	}
+
+	if len(c.Principals) > 0 {
+		return c.Principals[0]
+	}
+
+	return name
+}
+
+// String is the value of the certificate header
+func (c *Certificate) String() string {
+	return c.header
+}
+
+func x509Principals(cert *x509.Certificate) []string {
+	var principals []string
+
+	if cert.Subject.CommonName != "" {
+		principals = append(principals, cert.Subject.CommonName)
+	}
+
+	principals = append(principals, cert.DNSNames...)
+	principals = append(principals, cert.EmailAddresses...)
+
+	return principals
+}
+
+// certificateKey returns the key of a client certificate that is valid for name and issued by a trusted authority
+func (v *Verifier) certificateKey(name string, certificate string, now time.Time) (*clientKey, error) {
+	parts := strings.SplitN(certificate, " ", 2)
+
+	if len(parts) != 2 {
+		return nil, ErrInvalidCertificate
+	}
+
+	switch parts[0] {
+	case CERTIFICATE_TYPE_SSH:
+		return v.sshCertificateKey(name, parts[1], now)
+	case CERTIFICATE_TYPE_X509:
+		return v.x509CertificateKey(name, parts[1], now)
+	}
+
+	return nil, ErrInvalidCertificate
+}
+
+func (v *Verifier) sshCertificateKey(name string, encoded string, now time.Time) (*clientKey, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, ErrInvalidCertificate
+	}
+
+	pub, err := ssh.ParsePublicKey(data)
+
+	if err != nil {
+		return nil, ErrInvalidCertificate
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+
+	if !ok || cert.CertType != ssh.UserCert {
+		return nil, ErrInvalidCertificate
+	}
+
+	authorities, err := v.sshCertAuthorities()
+
+	if err != nil {
+		return nil, err
+	}
+
+	checker := ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			_, ok := findCertAuthority(authorities, ssh.FingerprintSHA256(auth))
+
+			return ok
+		},
+		SupportedCriticalOptions: []string{SSH_CERT_OPTION_FORCE_COMMAND, SSH_CERT_OPTION_SOURCE_ADDRESS},
+		Clock: func() time.Time {
+			return now
+		},
+	}
+
+	authority, ok := findCertAuthority(authorities, ssh.FingerprintSHA256(cert.SignatureKey))
+
+	if !ok {
+		return nil, ErrUntrustedCertificate
+	}
+
+	if authority.expired(now) {
+		return nil, ErrKeyExpired
+	}
+
+	// the lifetime and principals are checked first since ssh.CertChecker doesn't tell its errors apart
+	if after := int64(cert.ValidAfter); after != 0 && now.Unix() < after {
+		return nil, ErrKeyNotYetValid
+	}
+
+	if before := cert.ValidBefore; before != ssh.CertTimeInfinity && now.Unix() >= int64(before) {
+		return nil, ErrKeyExpired
+	}
+
+	if !containsString(cert.ValidPrincipals, name) || (len(v.sshCertPrincipals) > 0 && !containsString(v.sshCertPrincipals, name)) {
+		return nil, ErrPrincipalNotAllowed
+	}
+
+	for _, extension := range v.sshCertExtensions {
+		if _, ok := cert.Extensions[extension]; !ok {
+			return nil, ErrMissingExtension
+		}
+	}
+
+	if err := checker.CheckCert(name, cert); err != nil {
+		return nil, ErrInvalidCertificate
+	}
+
+	cryptoPub, ok := cert.Key.(ssh.CryptoPublicKey)
+
+	if !ok {
+		return nil, ErrInvalidCertificate
+	}
+
+	key := cryptoPub.CryptoPublicKey()
+
+	if err := checkPublicKey(key); err != nil {
+		return nil, ErrInvalidCertificate
+	}
+
+	ids := []string{name, fingerprint(key)}
+
+	if cert.KeyId != "" {
+		ids = append(ids, cert.KeyId)
+	}
+
+	// the options of the authority's entry apply to the certificates it issues too.  Like OpenSSH, a forced command
+	// of the certificate must be the same as the authority's.
+	command := cert.CriticalOptions[SSH_CERT_OPTION_FORCE_COMMAND]
+
+	if authority.command != "" {
+		if command != "" && command != authority.command {
+			return nil, ErrInvalidCertificate
+		}
+
+		command = authority.command
+	}
+
+	k := clientKey{
+		key:     key,
+		ids:     ids,
+		from:    []string{cert.CriticalOptions[SSH_CERT_OPTION_SOURCE_ADDRESS], authority.from},
+		command: command,
+		expires: authority.expires,
+	}
+
+	return &k, nil
+}
+
+// sshCertAuthorities returns the SSH certificate authorities: the keys of sshCaFile and the cert-authority entries
+// of the authorized_keys file
+func (v *Verifier) sshCertAuthorities() ([]authorizedKey, error) {
+	var authorities []authorizedKey
+
+	if v.sshCaFile != "" {
+		keys, err := loadAuthorizedKeys(v.sshCaFile)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load SSH certificate authorities "+v.sshCaFile)
+		}
+
+		for _, key := range keys {
+			key.certAuthority = true
+			authorities = append(authorities, key)
+		}
+	}
+
+	if v.authorizedKeysFile != "" {
+		keys, err := v.authorizedKeyEntries()
+
+		if err != nil {
+			return nil, err
+		}
+
+		authorities = append(authorities, keys...)
+	}
+
+	return authorities, nil
+}
+
+func (v *Verifier) x509CertificateKey(name string, encoded string, now time.Time) (*clientKey, error) {
+	if v.x509CaFile == "" {
+		return nil, ErrUntrustedCertificate
+	}
+
+	var chain []*x509.Certificate
+
+	for _, part := range strings.Split(encoded, ",") {
+		der, err := base64.StdEncoding.DecodeString(part)
+
+		if err != nil {
+			return nil, ErrInvalidCertificate
+		}
+
+		cert, err := x509.ParseCertificate(der)
+
+		if err != nil {
+			return nil, ErrInvalidCertificate
+		}
+
+		chain = append(chain, cert)
+	}
+
+	roots, err := LoadCertPool(v.x509CaFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := chain[0]
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if _, err := leaf.Verify(opts); err != nil {
+		if certErr, ok := err.(x509.CertificateInvalidError); ok && certErr.Reason == x509.Expired {
+			if now.Before(leaf.NotBefore) {
+				return nil, ErrKeyNotYetValid
+			}
+
+			return nil, ErrKeyExpired
+		}
+
+		return nil, ErrUntrustedCertificate
+	}
+
+	if !containsString(x509Principals(leaf), name) {
+		return nil, ErrPrincipalNotAllowed
+	}
+
+	if err := checkPublicKey(leaf.PublicKey); err != nil {
+		return nil, ErrInvalidCertificate
+	}
+
+	k := clientKey{
+		key: leaf.PublicKey,
+		ids: []string{name, fingerprint(leaf.PublicKey), leaf.SerialNumber.String()},
+	}
+
+	return &k, nil
+}
+
+// VerifyTlsClient returns the identity of a client that authenticated with a TLS client certificate (that the TLS
+// handshake has already verified).  The identity is named after the common name of the certificate, or its first DNS
+// name or email address, and is subject to the key policy.
+func (v *Verifier) VerifyTlsClient(cert *x509.Certificate) (*Identity, error) {
+	principals := x509Principals(cert)
+
+	if len(principals) == 0 {
+		return nil, ErrInvalidCertificate
+	}
+
+	key := clientKey{
+		key: cert.PublicKey,
+		ids: []string{principals[0], fingerprint(cert.PublicKey), cert.SerialNumber.String()},
+	}
+
+	identity := Identity{Name: principals[0], key: &key}
+
+	if err := v.checkPolicy(&key, time.Now()); err != nil {
+		return &identity, err
+	}
+
+	return &identity, nil
+}
+
+// CertificateAllows checks that name is the common name, a DNS name or an email address of an X.509 certificate
+func CertificateAllows(cert *x509.Certificate, name string) bool {
+	return containsString(x509Principals(cert), name)
+}
+
+// SpkiFingerprint returns the SHA256 fingerprint of the public key (subject public key info) of a certificate in the
+// `sha256/<base64>` format of HTTP public key pinning.  It doesn't change when a certificate is renewed with the same key.
+func SpkiFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	return SPKI_FINGERPRINT_PREFIX + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// LoadCertPool loads a PEM bundle of X.509 certificate authorities
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load certificate authorities "+path)
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(bytes.TrimSpace(data)) {
+		return nil, errors.New("no certificates found in " + path)
+	}
+
+	return pool, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
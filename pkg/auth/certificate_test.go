@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	sshCaFile  = filepath.Join("..", "..", "test", "server", "ssh_ca")
+	x509CaFile = filepath.Join("..", "..", "test", "server", "x509_ca.pem")
+)
+
+// certificateHeaders creates the Authorization and certificate headers of a client key with a certificate
+func certificateHeaders(t *testing.T, keyName string, certFile string, name string) (string, string) {
+	cert, err := LoadCertificate(filepath.Join(keyDir, certFile))
+
+	if err != nil {
+		t.Fatalf("LoadCertificate(%s) error = %v", certFile, err)
+	}
+
+	signer, err := NewSigner(keyName, keyDir)
+
+	if err != nil {
+		t.Fatalf("NewSigner(%s) error = %v", keyName, err)
+	}
+
+	signer.Name = cert.Name(name)
+
+	h, err := signer.CreateHeader("")
+
+	if err != nil {
+		t.Fatalf("CreateHeader() error = %v", err)
+	}
+
+	return h.String(), cert.String()
+}
+
+func TestLoadCertificate(t *testing.T) {
+	tests := []struct {
+		file       string
+		principals []string
+	}{
+		{"id_ed25519-cert.pub", []string{"alice", "deploy"}},
+		{"ecdsa-cert.pem", []string{"ecdsa-client", "ecdsa@example.com"}},
+	}
+
+	for _, tt := range tests {
+		cert, err := LoadCertificate(filepath.Join(keyDir, tt.file))
+
+		if err != nil || len(cert.Principals) != len(tt.principals) || cert.Principals[0] != tt.principals[0] || cert.Principals[1] != tt.principals[1] {
+			t.Errorf("LoadCertificate(%s) = %v, %v, wanted principals %v", tt.file, cert, err, tt.principals)
+			continue
+		}
+
+		if got := cert.Name(tt.principals[1]); got != tt.principals[1] {
+			t.Errorf("Name(%s) = %s, wanted the principal itself", tt.principals[1], got)
+		}
+
+		if got := cert.Name("other"); got != tt.principals[0] {
+			t.Errorf("Name(other) = %s, wanted the first principal %s", got, tt.principals[0])
+		}
+	}
+
+	if _, err := LoadCertificate(filepath.Join(certDir, "id_ed25519")); err == nil {
+		t.Error("LoadCertificate() should fail for a public key")
+	}
+}
+
+func TestVerifier_Certificates(t *testing.T) {
+	v := NewVerifier("", "", time.Minute)
+	v.TrustCertificates(sshCaFile, x509CaFile)
+
+	tests := []struct {
+		name       string
+		keyName    string
+		certFile   string
+		principal  string
+		remoteAddr string
+		wantErr    error
+		wantName   string
+		wantCmd    string
+	}{
+		{"ssh certificate", "id_ed25519", "id_ed25519-cert.pub", "deploy", "10.0.0.1:4000", nil, "deploy", ""},
+		{"ssh certificate options", "id_ed25519", "id_ed25519-restricted-cert.pub", "alice", "127.0.0.1:4000", nil, "alice", "echo restricted"},
+		{"ssh certificate source address", "id_ed25519", "id_ed25519-restricted-cert.pub", "alice", "10.0.0.1:4000", ErrAddressNotAllowed, "", ""},
+		{"expired ssh certificate", "id_ed25519", "id_ed25519-expired-cert.pub", "alice", "127.0.0.1:4000", ErrKeyExpired, "", ""},
+		{"untrusted ssh certificate", "id_ed25519", "id_ed25519-untrusted-cert.pub", "alice", "127.0.0.1:4000", ErrUntrustedCertificate, "", ""},
+		{"ssh certificate of another key", "ed25519", "id_ed25519-cert.pub", "alice", "127.0.0.1:4000", ErrInvalidSignature, "", ""},
+		{"x509 certificate", "ecdsa", "ecdsa-cert.pem", "ecdsa@example.com", "127.0.0.1:4000", nil, "ecdsa@example.com", ""},
+		{"x509 certificate without client auth", "ecdsa", "ecdsa-server-cert.pem", "ecdsa-client", "127.0.0.1:4000", ErrUntrustedCertificate, "", ""},
+		{"x509 certificate of another key", "client", "ecdsa-cert.pem", "ecdsa-client", "127.0.0.1:4000", ErrInvalidSignature, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, cert := certificateHeaders(t, tt.keyName, tt.certFile, tt.principal)
+
+			identity, err := v.Verify(header, cert, tt.remoteAddr)
+
+			if err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wanted %v", err, tt.wantErr)
+				return
+			}
+
+			if err == nil && (identity.Name != tt.wantName || identity.Command != tt.wantCmd) {
+				t.Errorf("Verify() = %v, wanted %s with command %q", identity, tt.wantName, tt.wantCmd)
+			}
+		})
+	}
+}
+
+func TestVerifier_Certificate_Principals(t *testing.T) {
+	v := NewVerifier("", "", time.Minute)
+	v.TrustCertificates(sshCaFile, x509CaFile)
+
+	for _, certFile := range []string{"id_ed25519-cert.pub", "ecdsa-cert.pem"} {
+		cert, _ := LoadCertificate(filepath.Join(keyDir, certFile))
+		keyName := map[string]string{"id_ed25519-cert.pub": "id_ed25519", "ecdsa-cert.pem": "ecdsa"}[certFile]
+		signer, _ := NewSigner(keyName, keyDir)
+		signer.Name = "bob"
+		h, _ := signer.CreateHeader("")
+
+		if _, err := v.Verify(h.String(), cert.String(), "127.0.0.1:4000"); err != ErrPrincipalNotAllowed {
+			t.Errorf("Verify() %s for another principal error = %v, wanted %v", certFile, err, ErrPrincipalNotAllowed)
+		}
+	}
+
+	header, cert := certificateHeaders(t, "id_ed25519", "id_ed25519-cert.pub", "alice")
+
+	if _, err := NewVerifier("", "", time.Minute).Verify(header, cert, "127.0.0.1:4000"); err != ErrUntrustedCertificate {
+		t.Errorf("Verify() without trusted authorities error = %v, wanted %v", err, ErrUntrustedCertificate)
+	}
+
+	if _, err := v.Verify(header, "ssh invalid", "127.0.0.1:4000"); err != ErrInvalidCertificate {
+		t.Errorf("Verify() invalid certificate error = %v, wanted %v", err, ErrInvalidCertificate)
+	}
+}
+
+func TestVerifier_Ssh_Certificate_Principals(t *testing.T) {
+	v := NewVerifier("", "", time.Minute)
+	v.TrustCertificates(sshCaFile, "")
+	v.RestrictSshCertificates([]string{"deploy"}, nil)
+
+	// the certificate is valid for alice and deploy but only deploy is allowed
+	for principal, want := range map[string]error{"deploy": nil, "alice": ErrPrincipalNotAllowed} {
+		header, cert := certificateHeaders(t, "id_ed25519", "id_ed25519-cert.pub", principal)
+
+		if _, err := v.Verify(header, cert, "127.0.0.1:4000"); err != want {
+			t.Errorf("Verify() certificate for %s error = %v, wanted %v", principal, err, want)
+		}
+	}
+}
+
+func TestVerifier_Ssh_Certificate_Extensions(t *testing.T) {
+	v := NewVerifier("", "", time.Minute)
+	v.TrustCertificates(sshCaFile, "")
+
+	tests := []struct {
+		extensions []string
+		want       error
+	}{
+		{[]string{"permit-pty"}, nil},
+		{[]string{"permit-pty", "permit-remote-control@example.com"}, ErrMissingExtension},
+	}
+
+	for _, tt := range tests {
+		v.RestrictSshCertificates(nil, tt.extensions)
+
+		header, cert := certificateHeaders(t, "id_ed25519", "id_ed25519-cert.pub", "alice")
+
+		if _, err := v.Verify(header, cert, "127.0.0.1:4000"); err != tt.want {
+			t.Errorf("Verify() certificate requiring %v error = %v, wanted %v", tt.extensions, err, tt.want)
+		}
+	}
+}
+
+func TestVerifier_Certificate_Identity(t *testing.T) {
+	v := NewVerifier("", "", time.Minute)
+	v.TrustCertificates(sshCaFile, x509CaFile)
+
+	header, cert := certificateHeaders(t, "id_ed25519", "id_ed25519-cert.pub", "alice")
+	identity, err := v.Verify(header, cert, "127.0.0.1:4000")
+
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	signer, _ := NewSigner("id_ed25519", keyDir)
+	sig, _ := signer.Sign([]byte("data"))
+
+	if err := v.VerifyIdentitySignature(identity, []byte("data"), sig); err != nil {
+		t.Errorf("VerifyIdentitySignature() error = %v, wanted %v", err, nil)
+	}
+
+	// the principal isn't a key that the verifier knows by name
+	if err := v.VerifySignature(identity.Name, []byte("data"), sig); err != ErrUnknownKey {
+		t.Errorf("VerifySignature() error = %v, wanted %v", err, ErrUnknownKey)
+	}
+
+	// certificates can be revoked by key id
+	v.policy = &keyPolicy{revoked: map[string]bool{"alice-cert": true}}
+
+	if err := v.VerifyIdentitySignature(identity, []byte("data"), sig); err != ErrKeyRevoked {
+		t.Errorf("VerifyIdentitySignature() revoked certificate error = %v, wanted %v", err, ErrKeyRevoked)
+	}
+}
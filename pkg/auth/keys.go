@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Supported key types: RSA, ECDSA P-256 and Ed25519.  The type of a key is detected from its encoding so that a key
+// directory can mix key types.  Keys can also be in the OpenSSH formats and signatures can be in the SSH wire format
+// (as made by ssh-agent).
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func loadPEM(path string) (*pem.Block, error) {
+	pemStr, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemStr)
+
+	if block == nil {
+		return nil, errors.New("failed to parse pem file " + path)
+	}
+
+	return block, nil
+}
+
+// loadPrivateKey loads a PKCS #1 (RSA), SEC 1 (ECDSA), PKCS #8 or OpenSSH (any supported type) private key
+//
+// Encrypted PKCS #8 and OpenSSH keys are decrypted with the passphrase returned by passphrase (which can be nil if no
+// passphrase is available).  encrypted reports whether the key was encrypted.
+func loadPrivateKey(path string, passphrase PassphraseFunc) (signer crypto.Signer, encrypted bool, err error) {
+	block, err := loadPEM(path)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	var key interface{}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		key, err = ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			encrypted = true
+			key, err = parseEncryptedOpenSSHKey(path, block, passphrase)
+		}
+	case "ENCRYPTED PRIVATE KEY":
+		encrypted = true
+		key, err = parseEncryptedPKCS8Key(path, block, passphrase)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, encrypted, errors.Wrap(err, "failed to parse private key "+path)
+	}
+
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		// the ssh package returns ed25519 keys by reference
+		key = *k
+	}
+
+	signer, ok := key.(crypto.Signer)
+
+	if !ok {
+		return nil, encrypted, errors.New("invalid private key " + path + ".  Must be an RSA, ECDSA P-256 or Ed25519 private key")
+	}
+
+	if err := checkPublicKey(signer.Public()); err != nil {
+		return nil, encrypted, errors.Wrap(err, "invalid private key "+path)
+	}
+
+	return signer, encrypted, nil
+}
+
+func parseEncryptedOpenSSHKey(path string, block *pem.Block, passphrase PassphraseFunc) (interface{}, error) {
+	if passphrase == nil {
+		return nil, ErrPassphraseRequired
+	}
+
+	p, err := passphrase(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase(pem.EncodeToMemory(block), p)
+
+	if err == x509.IncorrectPasswordError {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return key, err
+}
+
+func parseEncryptedPKCS8Key(path string, block *pem.Block, passphrase PassphraseFunc) (interface{}, error) {
+	if passphrase == nil {
+		return nil, ErrPassphraseRequired
+	}
+
+	p, err := passphrase(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := decryptPKCS8(block.Bytes, p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+
+	if err != nil {
+		// the padding happened to be valid
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return key, nil
+}
+
+// loadPublicKey loads a PKIX (PEM) or OpenSSH (authorized_keys format) public key
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	keyStr, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.PublicKey
+
+	if block, _ := pem.Decode(keyStr); block != nil {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	} else {
+		key, err = parseSSHPublicKey(keyStr)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse public key "+path)
+	}
+
+	if err := checkPublicKey(key); err != nil {
+		return nil, errors.Wrap(err, "invalid public key "+path)
+	}
+
+	return key, nil
+}
+
+func parseSSHPublicKey(keyStr []byte) (crypto.PublicKey, error) {
+	sshKey, _, _, _, err := ssh.ParseAuthorizedKey(keyStr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+
+	if !ok {
+		return nil, errors.New("unsupported ssh key type " + sshKey.Type())
+	}
+
+	return cryptoKey.CryptoPublicKey(), nil
+}
+
+func checkPublicKey(key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return errors.New("ECDSA keys must use the P-256 curve")
+		}
+
+		return nil
+	case ed25519.PublicKey:
+		return nil
+	}
+
+	return errors.New("must be an RSA, ECDSA P-256 or Ed25519 key")
+}
+
+// verifySignature checks a raw signature or a signature in the SSH wire format
+func verifySignature(key crypto.PublicKey, data []byte, sig []byte) bool {
+	return verifyRawSignature(key, data, sig) || verifySSHSignature(key, data, sig)
+}
+
+func verifyRawSignature(key crypto.PublicKey, data []byte, sig []byte) bool {
+	hashSum := sha256.Sum256(data)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hashSum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		var esig ecdsaSignature
+
+		if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) > 0 || esig.R == nil || esig.S == nil {
+			return false
+		}
+
+		return ecdsa.Verify(k, hashSum[:], esig.R, esig.S)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, data, sig)
+	}
+
+	return false
+}
+
+func verifySSHSignature(key crypto.PublicKey, data []byte, sig []byte) bool {
+	var sshSig ssh.Signature
+
+	if err := ssh.Unmarshal(sig, &sshSig); err != nil {
+		return false
+	}
+
+	// ssh-rsa signatures use SHA-1
+	if sshSig.Format == ssh.SigAlgoRSA {
+		return false
+	}
+
+	sshKey, err := ssh.NewPublicKey(key)
+
+	if err != nil {
+		return false
+	}
+
+	return sshKey.Verify(data, &sshSig) == nil
+}
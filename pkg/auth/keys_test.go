@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestSigner_Key_Types(t *testing.T) {
+	v := NewVerifier(certDir, "", time.Minute)
+
+	for _, name := range []string{"client", "ecdsa", "ed25519"} {
+		t.Run(name, func(t *testing.T) {
+			signer, err := NewSigner(name, keyDir)
+
+			if err != nil {
+				t.Errorf("NewSigner() error = %v, wanted %v", err, nil)
+				return
+			}
+
+			sig, err := signer.Sign([]byte("data"))
+
+			if err != nil {
+				t.Errorf("Sign() error = %v, wanted %v", err, nil)
+				return
+			}
+
+			if err := v.VerifySignature(name, []byte("data"), sig); err != nil {
+				t.Errorf("VerifySignature() error = %v, wanted %v", err, nil)
+			}
+
+			if err := v.VerifySignature(name, []byte("other data"), sig); err != ErrInvalidSignature {
+				t.Errorf("VerifySignature() other data error = %v, wanted %v", err, ErrInvalidSignature)
+			}
+
+			// the signature of one key doesn't verify with another key (of another type)
+			other := "ed25519"
+
+			if name == other {
+				other = "client"
+			}
+
+			if err := v.VerifySignature(other, []byte("data"), sig); err != ErrInvalidSignature {
+				t.Errorf("VerifySignature() other key error = %v, wanted %v", err, ErrInvalidSignature)
+			}
+
+			header, err := CreateSig(name, keyDir, "")
+
+			if err != nil {
+				t.Errorf("CreateSig() error = %v, wanted %v", err, nil)
+				return
+			}
+
+			if _, err := v.Verify(header, "", "127.0.0.1:4000"); err != nil {
+				t.Errorf("Verify() error = %v, wanted %v", err, nil)
+			}
+		})
+	}
+}
+
+func TestLoadKey_Unsupported_Curve(t *testing.T) {
+	if _, err := NewSigner("ecdsa-p384", keyDir); err == nil {
+		t.Error("NewSigner() should reject ECDSA keys that don't use P-256")
+	}
+
+	v := NewVerifier(certDir, "", time.Minute)
+
+	if err := v.VerifySignature("ecdsa-p384", []byte("data"), []byte("sig")); err == nil || err == ErrInvalidSignature {
+		t.Errorf("VerifySignature() error = %v, wanted an invalid key error", err)
+	}
+}
+
+func TestLoadPrivateKey_Encrypted(t *testing.T) {
+	secret := func(string) ([]byte, error) {
+		return []byte("secret"), nil
+	}
+
+	wrong := func(string) ([]byte, error) {
+		return []byte("wrong"), nil
+	}
+
+	for _, name := range []string{"client-encrypted.key", "ed25519-encrypted.key", "id_ed25519-encrypted"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(keyDir, name)
+
+			if _, _, err := loadPrivateKey(path, nil); errors.Cause(err) != ErrPassphraseRequired {
+				t.Errorf("loadPrivateKey() without passphrase error = %v, wanted %v", err, ErrPassphraseRequired)
+			}
+
+			if _, _, err := loadPrivateKey(path, wrong); errors.Cause(err) != ErrIncorrectPassphrase {
+				t.Errorf("loadPrivateKey() with wrong passphrase error = %v, wanted %v", err, ErrIncorrectPassphrase)
+			}
+
+			if _, encrypted, err := loadPrivateKey(path, secret); err != nil || !encrypted {
+				t.Errorf("loadPrivateKey() = %v, %v, wanted an encrypted key", encrypted, err)
+			}
+		})
+	}
+
+	if _, encrypted, err := loadPrivateKey(filepath.Join(keyDir, "client.key"), nil); err != nil || encrypted {
+		t.Errorf("loadPrivateKey() = %v, %v, wanted an unencrypted key", encrypted, err)
+	}
+}
+
+func TestNewSignerWithPassphrase(t *testing.T) {
+	prompts := 0
+
+	passphrase := func(string) ([]byte, error) {
+		prompts++
+		return []byte("secret"), nil
+	}
+
+	v := NewVerifier(certDir, "", time.Minute)
+
+	// the key is only decrypted once
+	for i := 0; i < 3; i++ {
+		signer, err := NewSignerWithPassphrase("ed25519-encrypted", keyDir, passphrase)
+
+		if err != nil {
+			t.Errorf("NewSignerWithPassphrase() error = %v, wanted %v", err, nil)
+			return
+		}
+
+		sig, _ := signer.Sign([]byte("data"))
+
+		if err := v.VerifySignature("ed25519", []byte("data"), sig); err != nil {
+			t.Errorf("VerifySignature() error = %v, wanted %v", err, nil)
+		}
+	}
+
+	if prompts != 1 {
+		t.Errorf("passphrase requested %d times, wanted 1", prompts)
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// nonceCache remembers nonces until they expire
+type nonceCache struct {
+	nonces    map[string]time.Time
+	lastPurge time.Time
+	lock      sync.Mutex
+}
+
+func newNonceCache() *nonceCache {
+	c := nonceCache{
+		nonces:    map[string]time.Time{},
+		lastPurge: time.Now(),
+	}
+
+	return &c
+}
+
+// add remembers nonce until expires.  It returns false if the nonce is already known.
+func (c *nonceCache) add(nonce string, expires time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+
+	if seen, ok := c.nonces[nonce]; ok && seen.After(now) {
+		return false
+	}
+
+	c.nonces[nonce] = expires
+
+	c.purge(now)
+
+	return true
+}
+
+// purge forgets the expired nonces (at most once a second)
+func (c *nonceCache) purge(now time.Time) {
+	if now.Sub(c.lastPurge) < time.Second {
+		return
+	}
+
+	for nonce, expires := range c.nonces {
+		if !expires.After(now) {
+			delete(c.nonces, nonce)
+		}
+	}
+
+	c.lastPurge = now
+}
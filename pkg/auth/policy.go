@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyValidity is the period during which a client key may be used.  Unset times don't restrict the period.
+type KeyValidity struct {
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
+}
+
+// keyPolicy is the revocation list and the validity periods of client keys.  Keys are identified by name or by SHA256
+// fingerprint.
+type keyPolicy struct {
+	revoked  map[string]bool
+	validity map[string]KeyValidity
+}
+
+// loadKeyPolicy reads the revocation list (one key name or fingerprint per line, `#` starts a comment) and the
+// validity periods (a json object of KeyValidity by key name or fingerprint).  Empty paths are skipped.
+func loadKeyPolicy(revokedKeysFile string, keyValidityFile string) (*keyPolicy, error) {
+	p := keyPolicy{
+		revoked:  map[string]bool{},
+		validity: map[string]KeyValidity{},
+	}
+
+	if revokedKeysFile != "" {
+		data, err := ioutil.ReadFile(revokedKeysFile)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load revoked keys")
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+
+			if line = strings.TrimSpace(line); line != "" {
+				p.revoked[line] = true
+			}
+		}
+	}
+
+	if keyValidityFile != "" {
+		data, err := ioutil.ReadFile(keyValidityFile)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load key validity")
+		}
+
+		if err := json.Unmarshal(data, &p.validity); err != nil {
+			return nil, errors.Wrap(err, "failed to parse key validity "+keyValidityFile)
+		}
+	}
+
+	return &p, nil
+}
+
+// check returns an error when any of the identifiers of a key is revoked or when now is outside of its validity period
+func (p *keyPolicy) check(ids []string, now time.Time) error {
+	for _, id := range ids {
+		if p.revoked[id] {
+			return ErrKeyRevoked
+		}
+	}
+
+	for _, id := range ids {
+		validity, ok := p.validity[id]
+
+		if !ok {
+			continue
+		}
+
+		if validity.NotBefore != nil && now.Before(*validity.NotBefore) {
+			return ErrKeyNotYetValid
+		}
+
+		if validity.NotAfter != nil && now.After(*validity.NotAfter) {
+			return ErrKeyExpired
+		}
+	}
+
+	return nil
+}
+
+// fingerprint is the SHA256 fingerprint of a public key in the OpenSSH format (`SHA256:...`)
+func fingerprint(key crypto.PublicKey) string {
+	sshKey, err := ssh.NewPublicKey(key)
+
+	if err != nil {
+		return ""
+	}
+
+	return ssh.FingerprintSHA256(sshKey)
+}
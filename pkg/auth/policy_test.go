@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifier_Key_Policy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-policy")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	revokedKeysFile := filepath.Join(dir, "revoked")
+	keyValidityFile := filepath.Join(dir, "validity.json")
+
+	keys, _ := loadAuthorizedKeys(authorizedKeysFile)
+	ecdsa, _ := findAuthorizedKey(keys, "ecdsa-ssh")
+
+	_ = ioutil.WriteFile(revokedKeysFile, []byte("# revoked keys\nclient\n  "+ecdsa.fingerprint+"  # by fingerprint\n"), 0600)
+	_ = ioutil.WriteFile(keyValidityFile, []byte(`{
+		"ed25519": {"notAfter": "2020-01-01T00:00:00Z"},
+		"alice": {"notBefore": "2999-01-01T00:00:00Z"},
+		"id_ed25519": {"notBefore": "2020-01-01T00:00:00Z", "notAfter": "2999-01-01T00:00:00Z"}
+	}`), 0600)
+
+	v := NewVerifier(certDir, authorizedKeysFile, time.Minute)
+
+	if err := v.LoadKeyPolicy(revokedKeysFile, keyValidityFile); err != nil {
+		t.Errorf("LoadKeyPolicy() error = %v, wanted %v", err, nil)
+		return
+	}
+
+	tests := []struct {
+		name    string
+		keyName string
+		wantErr error
+	}{
+		{"revoked by name", "client", ErrKeyRevoked},
+		{"revoked by fingerprint", "ecdsa", ErrKeyRevoked},
+		{"expired", "ed25519", ErrKeyExpired},
+		{"valid", "id_ed25519", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, _ := CreateSig(tt.keyName, keyDir, "")
+
+			if _, err := v.Verify(sig, "", "127.0.0.1:4000"); err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wanted %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// authorized_keys comments are checked as well
+	signer, _ := NewSigner("id_ed25519", keyDir)
+	signer.Name = "alice"
+	h, _ := signer.CreateHeader("")
+
+	if _, err := v.Verify(h.String(), "", "127.0.0.1:4000"); err != ErrKeyNotYetValid {
+		t.Errorf("Verify() error = %v, wanted %v", err, ErrKeyNotYetValid)
+	}
+
+	// revoked keys can't sign messages either
+	sig, _ := signer.Sign([]byte("data"))
+	_ = ioutil.WriteFile(revokedKeysFile, []byte("id_ed25519\n"), 0600)
+
+	if err := v.VerifySignature("id_ed25519", []byte("data"), sig); err != nil {
+		t.Errorf("VerifySignature() before reload error = %v, wanted %v", err, nil)
+	}
+
+	if err := v.ReloadKeyPolicy(); err != nil {
+		t.Errorf("ReloadKeyPolicy() error = %v, wanted %v", err, nil)
+	}
+
+	if err := v.VerifySignature("id_ed25519", []byte("data"), sig); err != ErrKeyRevoked {
+		t.Errorf("VerifySignature() after reload error = %v, wanted %v", err, ErrKeyRevoked)
+	}
+
+	// the current policy is kept when the files can't be read
+	_ = os.Remove(revokedKeysFile)
+
+	if err := v.ReloadKeyPolicy(); err == nil {
+		t.Error("ReloadKeyPolicy() should fail when the revocation list is missing")
+	}
+
+	if err := v.VerifySignature("id_ed25519", []byte("data"), sig); err != ErrKeyRevoked {
+		t.Errorf("VerifySignature() after failed reload error = %v, wanted %v", err, ErrKeyRevoked)
+	}
+}
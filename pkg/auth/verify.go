@@ -0,0 +1,354 @@
+package auth
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Verifier checks Authorization headers against the public keys in a directory (`<certDir>/<name>`) and/or in an
+// OpenSSH authorized_keys file
+//
+// A header is only accepted once: its timestamp must be within maxClockSkew of the server's clock and its nonce is
+// remembered for as long as the timestamp is valid.  Its host must be one of the server's names (see
+// BindServerNames).  Keys can be revoked or limited to a validity period (see LoadKeyPolicy).
+type Verifier struct {
+	certDir            string
+	authorizedKeysFile string
+	maxClockSkew       time.Duration
+	nonces             *nonceCache
+	sshCaFile          string
+	x509CaFile         string
+	revokedKeysFile    string
+	keyValidityFile    string
+	policy             *keyPolicy
+	// authorizedKeys are the entries of authorizedKeysFile (nil until it has been read)
+	authorizedKeys []authorizedKey
+	policyLock     sync.RWMutex
+	// sshCertPrincipals are the principals that SSH certificates may be used for (any principal when empty) and
+	// sshCertExtensions the extensions that they must have
+	sshCertPrincipals []string
+	sshCertExtensions []string
+	// serverNames are the hosts that headers may be bound to (lowercase, any host when empty)
+	serverNames  map[string]bool
+	allowUnbound bool
+}
+
+// Identity is an authenticated client
+type Identity struct {
+	// Name is the name of the client's key (or the principal of its certificate)
+	Name string
+	// Nonce is the nonce of the client's Authorization header
+	Nonce string
+	// Command is the command forced by the key's authorized_keys options or certificate ("" when the client may run any
+	// command)
+	Command string
+	key     *clientKey
+}
+
+// clientKey is the public key of a client and the restrictions that come with it
+type clientKey struct {
+	key crypto.PublicKey
+	// ids are the names of the key in the key policy: its name, fingerprint and comment or certificate key id
+	ids []string
+	// from are the pattern lists of client addresses that may use the key (the address must be allowed by each of them,
+	// "" allows any address)
+	from []string
+	// command is the forced command ("" allows any command)
+	command string
+	// expires is when the key stops being accepted (zero if never)
+	expires time.Time
+}
+
+func NewVerifier(certDir string, authorizedKeysFile string, maxClockSkew time.Duration) *Verifier {
+	v := Verifier{
+		certDir:            certDir,
+		authorizedKeysFile: authorizedKeysFile,
+		maxClockSkew:       maxClockSkew,
+		nonces:             newNonceCache(),
+		policy:             &keyPolicy{},
+	}
+
+	return &v
+}
+
+// TrustCertificates accepts clients that present a certificate issued by one of the SSH certificate authorities in
+// sshCaFile (authorized_keys format) or by one of the X.509 certificate authorities in x509CaFile (PEM).  Either path
+// can be empty.
+func (v *Verifier) TrustCertificates(sshCaFile string, x509CaFile string) {
+	v.sshCaFile = sshCaFile
+	v.x509CaFile = x509CaFile
+}
+
+// RestrictSshCertificates only accepts the SSH certificates used for one of principals (any principal of the
+// certificate when empty) and that have all of extensions (ex: a `permit-remote-control@example.com` extension that the
+// CA only adds to the certificates meant for the servers)
+func (v *Verifier) RestrictSshCertificates(principals []string, extensions []string) {
+	v.sshCertPrincipals = principals
+	v.sshCertExtensions = extensions
+}
+
+// BindServerNames only accepts the headers made for one of names, the names that clients connect to the server by (ex:
+// its host name, FQDN or IP address), so that a header captured by one server can't be used on the others.  Headers
+// without a host (made by older clients) are rejected unless allowUnbound is set.  With no names, the host of the
+// headers isn't checked.
+func (v *Verifier) BindServerNames(names []string, allowUnbound bool) {
+	v.serverNames = map[string]bool{}
+
+	for _, name := range names {
+		v.serverNames[strings.ToLower(name)] = true
+	}
+
+	v.allowUnbound = allowUnbound
+}
+
+// LoadKeyPolicy loads the revocation list and the key validity periods from files.  Either path can be empty.
+func (v *Verifier) LoadKeyPolicy(revokedKeysFile string, keyValidityFile string) error {
+	policy, err := loadKeyPolicy(revokedKeysFile, keyValidityFile)
+
+	if err != nil {
+		return err
+	}
+
+	v.policyLock.Lock()
+	defer v.policyLock.Unlock()
+
+	v.revokedKeysFile = revokedKeysFile
+	v.keyValidityFile = keyValidityFile
+	v.policy = policy
+
+	return nil
+}
+
+// ReloadKeyPolicy reads the files of the revocation list, the key validity periods and the authorized_keys file
+// again.  The current policy and keys are kept when they can't be read.
+func (v *Verifier) ReloadKeyPolicy() error {
+	v.policyLock.RLock()
+	revokedKeysFile, keyValidityFile := v.revokedKeysFile, v.keyValidityFile
+	v.policyLock.RUnlock()
+
+	err := v.LoadKeyPolicy(revokedKeysFile, keyValidityFile)
+
+	if v.authorizedKeysFile != "" {
+		if _, keysErr := v.loadAuthorizedKeysFile(); err == nil {
+			err = keysErr
+		}
+	}
+
+	return err
+}
+
+// authorizedKeyEntries returns the entries of the authorized_keys file, which is read the first time and then only
+// by ReloadKeyPolicy
+func (v *Verifier) authorizedKeyEntries() ([]authorizedKey, error) {
+	v.policyLock.RLock()
+	keys := v.authorizedKeys
+	v.policyLock.RUnlock()
+
+	if keys != nil {
+		return keys, nil
+	}
+
+	return v.loadAuthorizedKeysFile()
+}
+
+func (v *Verifier) loadAuthorizedKeysFile() ([]authorizedKey, error) {
+	keys, err := loadAuthorizedKeys(v.authorizedKeysFile)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load authorized keys "+v.authorizedKeysFile)
+	}
+
+	v.policyLock.Lock()
+	defer v.policyLock.Unlock()
+
+	v.authorizedKeys = keys
+
+	return keys, nil
+}
+
+// Verify returns the identity of the client when the header is valid and has not been seen before.  certificate is
+// the value of the certificate header (if any) and remoteAddr is checked against the address restrictions of the key.
+func (v *Verifier) Verify(header string, certificate string, remoteAddr string) (*Identity, error) {
+	h, err := ParseHeader(header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	identity := Identity{Name: h.Name, Nonce: h.Nonce}
+
+	timestamp, err := h.Time()
+
+	if err != nil {
+		return &identity, ErrInvalidHeader
+	}
+
+	now := time.Now()
+
+	if timestamp.Before(now.Add(-v.maxClockSkew)) || timestamp.After(now.Add(v.maxClockSkew)) {
+		return &identity, ErrStaleTimestamp
+	}
+
+	if !v.boundToServer(h.Host) {
+		return &identity, ErrWrongServer
+	}
+
+	var key *clientKey
+
+	if certificate != "" {
+		key, err = v.certificateKey(h.Name, certificate, now)
+	} else {
+		key, err = v.findKey(h.Name)
+	}
+
+	if err != nil {
+		return &identity, err
+	}
+
+	if !verifySignature(key.key, h.SignedData(), h.Signature) {
+		return &identity, ErrInvalidSignature
+	}
+
+	if err := v.checkPolicy(key, now); err != nil {
+		return &identity, err
+	}
+
+	for _, from := range key.from {
+		if !allowsAddress(from, remoteAddr) {
+			return &identity, ErrAddressNotAllowed
+		}
+	}
+
+	identity.Command = key.command
+	identity.key = key
+
+	// only remember nonces of valid signatures so that the cache can't be filled by unauthenticated clients.  They are
+	// remembered by key since a key can be found by several names (ex: its comment and its fingerprint).
+	if !v.nonces.add(identity.KeyId()+";"+h.Nonce, timestamp.Add(v.maxClockSkew)) {
+		return &identity, ErrReplayedNonce
+	}
+
+	return &identity, nil
+}
+
+// boundToServer tells whether a header for host may be used on the server
+func (v *Verifier) boundToServer(host string) bool {
+	if len(v.serverNames) == 0 {
+		return true
+	}
+
+	if host == "" {
+		return v.allowUnbound
+	}
+
+	return v.serverNames[strings.ToLower(host)]
+}
+
+// KeyId is the SHA256 fingerprint of the client's key, which is the same whatever name the key was found by (the name
+// for the clients that were authenticated by their connection)
+func (i *Identity) KeyId() string {
+	if i.key == nil || i.key.key == nil {
+		return i.Name
+	}
+
+	return fingerprint(i.key.key)
+}
+
+// VerifySignature checks that sig is a signature of data made with the private key of name and that the key has not
+// been revoked or expired since
+func (v *Verifier) VerifySignature(name string, data []byte, sig []byte) error {
+	key, err := v.findKey(name)
+
+	if err != nil {
+		return err
+	}
+
+	return v.verifyKeySignature(key, data, sig)
+}
+
+// VerifyIdentitySignature checks that sig is a signature of data made with the key that authenticated identity (which
+// also works for clients that authenticated with a certificate)
+func (v *Verifier) VerifyIdentitySignature(identity *Identity, data []byte, sig []byte) error {
+	if identity == nil || identity.key == nil {
+		return ErrUnknownKey
+	}
+
+	return v.verifyKeySignature(identity.key, data, sig)
+}
+
+// VerifyPeer returns the identity of a client that was authenticated by its connection (ex: by the peer credentials
+// of a unix socket) instead of a key.  The identity is subject to the key policy under name and ids.
+func (v *Verifier) VerifyPeer(name string, ids ...string) (*Identity, error) {
+	key := clientKey{ids: append([]string{name}, ids...)}
+	identity := Identity{Name: name, key: &key}
+
+	if err := v.checkPolicy(&key, time.Now()); err != nil {
+		return &identity, err
+	}
+
+	return &identity, nil
+}
+
+func (v *Verifier) verifyKeySignature(key *clientKey, data []byte, sig []byte) error {
+	if !verifySignature(key.key, data, sig) {
+		return ErrInvalidSignature
+	}
+
+	return v.checkPolicy(key, time.Now())
+}
+
+// checkPolicy checks the expiry of a key and its ids against the key policy
+func (v *Verifier) checkPolicy(key *clientKey, now time.Time) error {
+	if !key.expires.IsZero() && !now.Before(key.expires) {
+		return ErrKeyExpired
+	}
+
+	v.policyLock.RLock()
+	defer v.policyLock.RUnlock()
+
+	return v.policy.check(key.ids, now)
+}
+
+// findKey looks up the public key of name in the authorized_keys file (by fingerprint or comment) and then in certDir
+func (v *Verifier) findKey(name string) (*clientKey, error) {
+	if v.authorizedKeysFile != "" {
+		keys, err := v.authorizedKeyEntries()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if key, ok := findAuthorizedKey(keys, name); ok {
+			ids := []string{name, key.fingerprint}
+
+			if key.comment != "" {
+				ids = append(ids, key.comment)
+			}
+
+			return &clientKey{key: key.key, ids: ids, from: []string{key.from}, command: key.command, expires: key.expires}, nil
+		}
+	}
+
+	// names are file names in certDir
+	if v.certDir == "" || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return nil, ErrUnknownKey
+	}
+
+	key, err := loadPublicKey(filepath.Join(v.certDir, name))
+
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, ErrUnknownKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientKey{key: key, ids: []string{name, fingerprint(key)}}, nil
+}
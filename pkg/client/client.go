@@ -1,37 +1,54 @@
 package client
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"golang.org/x/tools/container/intsets"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/exec"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cthayer/remote_control/internal/logger"
 	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/pkg/auth"
 	config "github.com/cthayer/remote_control/pkg/client_config"
+	"github.com/cthayer/remote_control/pkg/facts"
+	"github.com/cthayer/remote_control/pkg/message"
 )
 
 const (
 	CLOSE_TIMEOUT        = 120
 	TLS_WEBSOCKET_SCHEME = "wss"
+	UNIX_SOCKET_PREFIX   = "unix://"
 	WEBSOCKET_SCHEME     = "ws"
 	WEBSOCKET_PATH       = "/"
+
+	PASSPHRASE_ENV          = "RC_KEY_PASSPHRASE"
+	PASSPHRASE_KEY_FILE_ENV = "RC_KEY_FILE"
 )
 
-var rcProto rc_protocol.RCProtocol = rc_protocol.NewRCProtocol()
+// ErrNoSigningKey is the error of a message that should be signed (signMessages) when the client's key couldn't be
+// loaded
+var ErrNoSigningKey = errors.New("message signing requested but no signing key loaded")
 
 type Client interface {
 	Start() chan error
 	Stop() chan error
 	Send(string, rc_protocol.MessageOptions) chan *rc_protocol.Response
+	Facts() chan *facts.Facts
 }
 
 type client struct {
@@ -41,8 +58,18 @@ type client struct {
 	isConnected  bool
 	url          url.URL
 	readLoopDone chan struct{}
-	msgChannels  map[int]chan rc_protocol.Response
-	msgId        int
+	// lastServerPing is when the server last sent a ping and serverPingGap the longest time between two of them (only
+	// used by the read loop).  The read deadline is only armed once the server has pinged: servers that don't (ex:
+	// with a ping interval of 0) can't answer the client's pings while they run a command either.
+	lastServerPing time.Time
+	serverPingGap  time.Duration
+	msgChannels    map[int]chan message.Response
+	msgId          int
+	msgLock        sync.Mutex
+	signer         *auth.Signer
+	certificate    *auth.Certificate
+	authNonce      string
+	socketPath     string
 }
 
 func NewClient(conf config.Config) Client {
@@ -54,14 +81,23 @@ func NewClient(conf config.Config) Client {
 		u = url.URL{Scheme: TLS_WEBSOCKET_SCHEME, Host: conf.Host + ":" + strconv.Itoa(conf.Port), Path: WEBSOCKET_PATH}
 	}
 
+	socketPath := ""
+
+	if strings.HasPrefix(conf.Host, UNIX_SOCKET_PREFIX) {
+		// the websocket protocol is the same on a unix socket, only the connection is different (and doesn't use TLS)
+		socketPath = strings.TrimPrefix(conf.Host, UNIX_SOCKET_PREFIX)
+		u = url.URL{Scheme: WEBSOCKET_SCHEME, Host: "localhost", Path: WEBSOCKET_PATH}
+	}
+
 	c := client{
 		conf:         conf,
 		logger:       logger.GetLogger(),
 		isConnected:  false,
 		url:          u,
 		readLoopDone: nil,
-		msgChannels:  map[int]chan rc_protocol.Response{},
+		msgChannels:  map[int]chan message.Response{},
 		msgId:        0,
+		socketPath:   socketPath,
 	}
 
 	return &c
@@ -85,7 +121,14 @@ func (c *client) Start() chan error {
 
 		var dialer websocket.Dialer
 
-		if c.conf.TlsDisable {
+		if c.socketPath != "" {
+			// setup ws connection on the unix socket
+			dialer = websocket.Dialer{
+				NetDial: func(network, addr string) (net.Conn, error) {
+					return net.Dial("unix", c.socketPath)
+				},
+			}
+		} else if c.conf.TlsDisable {
 			// setup ws connection
 			dialer = *websocket.DefaultDialer
 		} else {
@@ -110,12 +153,37 @@ func (c *client) Start() chan error {
 				dialer.TLSClientConfig.RootCAs = x509.NewCertPool()
 				dialer.TLSClientConfig.RootCAs.AppendCertsFromPEM(caCert)
 			}
+
+			if c.conf.TlsPin != "" || c.conf.KnownHostsFile != "" {
+				// the server is trusted by its fingerprint instead of a certificate authority (ex: a self-signed certificate)
+				dialer.TLSClientConfig.InsecureSkipVerify = true
+				dialer.TLSClientConfig.VerifyPeerCertificate = c.verifyServerCertificate
+			}
+
+			if c.conf.TlsCertFile != "" {
+				// load the client certificate for mutual TLS
+				keyPair, err := tls.LoadX509KeyPair(c.conf.TlsCertFile, c.conf.TlsKeyFile)
+
+				if err != nil {
+					c.logger.Error("Error loading client certificate", zap.Error(err), zap.String("certFile", c.conf.TlsCertFile))
+					errChan <- err
+					return
+				}
+
+				dialer.TLSClientConfig.Certificates = []tls.Certificate{keyPair}
+			}
 		}
 
 		// connect to server
-		c.socket, _, err = dialer.Dial(c.url.String(), reqHeader)
+		var resp *http.Response
+
+		c.socket, resp, err = dialer.Dial(c.url.String(), reqHeader)
 
 		if err != nil {
+			if rejected := rejectedError(resp); rejected != nil {
+				err = rejected
+			}
+
 			c.logger.Error("Failed to connect to server.", zap.String("url", c.url.String()), zap.Error(err))
 		}
 
@@ -123,6 +191,11 @@ func (c *client) Start() chan error {
 
 		if c.isConnected {
 			c.readLoopDone = make(chan struct{})
+			c.lastServerPing = time.Time{}
+			c.serverPingGap = 0
+
+			// detect a dead server (or network) by pinging it
+			c.setupHeartbeat()
 
 			// start read loop in the background
 			go c.readMessages()
@@ -191,24 +264,75 @@ func (c *client) Stop() chan error {
 
 func (c *client) Send(command string, options rc_protocol.MessageOptions) chan *rc_protocol.Response {
 	respChan := make(chan *rc_protocol.Response, 1)
-	var resp *rc_protocol.Response = nil
 
-	msg := rc_protocol.Message{
-		Command: command,
-		Id:      c.nextMessageId(),
-		Options: options,
+	msg := message.Message{
+		Message: rc_protocol.Message{
+			Command: command,
+			Options: options,
+		},
 	}
 
-	c.msgChannels[msg.Id] = make(chan rc_protocol.Response, 1)
+	go func() {
+		defer close(respChan)
+
+		resp := <-c.send(msg)
+
+		if resp == nil {
+			respChan <- nil
+			return
+		}
+
+		respChan <- &resp.Response
+	}()
+
+	return respChan
+}
+
+func (c *client) Facts() chan *facts.Facts {
+	factsChan := make(chan *facts.Facts, 1)
+
+	msg := message.Message{Type: message.TYPE_FACTS}
+
+	go func() {
+		defer close(factsChan)
+
+		resp := <-c.send(msg)
+
+		if resp == nil {
+			factsChan <- nil
+			return
+		}
+
+		if resp.Stderr != "" {
+			c.logger.Warn("Server could not gather all facts", zap.String("url", c.url.String()), zap.String("stderr", resp.Stderr))
+		}
+
+		factsChan <- resp.Facts
+	}()
+
+	return factsChan
+}
+
+func (c *client) send(msg message.Message) chan *message.Response {
+	respChan := make(chan *message.Response, 1)
+	var resp *message.Response = nil
+
+	msgChan := make(chan message.Response, 1)
+
+	c.msgLock.Lock()
+	msg.Id = c.nextMessageId()
+	c.msgChannels[msg.Id] = msgChan
+	readLoopDone := c.readLoopDone
+	c.msgLock.Unlock()
 
 	go func() {
 		defer func() {
-			// close the message channels
 			close(respChan)
-			close(c.msgChannels[msg.Id])
 
 			// remove the message channel from the channel map
+			c.msgLock.Lock()
 			delete(c.msgChannels, msg.Id)
+			c.msgLock.Unlock()
 		}()
 
 		// must be connected to send the message
@@ -217,6 +341,14 @@ func (c *client) Send(command string, options rc_protocol.MessageOptions) chan *
 			return
 		}
 
+		if err := c.signMessage(&msg); err != nil {
+			c.logger.Error("Error signing msg", zap.String("url", c.url.String()), zap.Any("msg", msg), zap.Error(err))
+
+			respChan <- resp
+
+			return
+		}
+
 		// prep message to send to the server
 		jsonStr, jErr := json.Marshal(msg)
 
@@ -239,31 +371,138 @@ func (c *client) Send(command string, options rc_protocol.MessageOptions) chan *
 			return
 		}
 
-		// wait for the response
-		resp := <-c.msgChannels[msg.Id]
-
-		// send response to caller
-		respChan <- &resp
+		// wait for the response (or for the connection to be lost)
+		select {
+		case resp := <-msgChan:
+			respChan <- &resp
+		case <-readLoopDone:
+			// the response may have arrived right before the connection was lost
+			select {
+			case resp := <-msgChan:
+				respChan <- &resp
+			default:
+				c.logger.Error("Connection to server lost while waiting for a response", zap.String("url", c.url.String()), zap.Int("msgId", msg.Id))
+				respChan <- resp
+			}
+		}
 	}()
 
 	return respChan
 }
 
+// usesKey tells whether the client authenticates with its key (the others are authenticated by their TLS client
+// certificate or the unix socket only)
+func (c *client) usesKey() bool {
+	return c.conf.KeyName != "" || c.conf.UseAgent || (c.conf.TlsCertFile == "" && c.socketPath == "")
+}
+
 func (c *client) createSig() http.Header {
 	header := http.Header{}
 
-	sig, err := rcProto.CreateSig(c.conf.KeyName, c.conf.KeyDir)
+	if !c.usesKey() {
+		return header
+	}
+
+	if c.signer == nil {
+		var signer *auth.Signer
+		var err error
+
+		if c.conf.UseAgent {
+			signer, err = auth.NewAgentSigner(c.conf.KeyName)
+		} else {
+			signer, err = auth.NewSignerWithPassphrase(c.conf.KeyName, c.conf.KeyDir, c.passphrase)
+		}
+
+		if err != nil {
+			c.logger.Error("Error loading key", zap.Error(err))
+			return header
+		}
+
+		if c.conf.CertFile != "" {
+			cert, err := auth.LoadCertificate(c.conf.CertFile)
+
+			if err != nil {
+				c.logger.Error("Error loading certificate", zap.Error(err))
+				return header
+			}
+
+			// the server checks the name against the principals of the certificate
+			signer.Name = cert.Name(signer.Name)
+			c.certificate = cert
+		}
+
+		c.signer = signer
+	}
+
+	// the header is bound to the server so that the server can't use it to connect to the others
+	sig, err := c.signer.CreateHeader(c.url.Hostname())
 
 	if err != nil {
 		c.logger.Error("Error creating signature", zap.Error(err))
 		return header
 	}
 
-	header.Add("Authorization", sig)
+	// signed messages are bound to the connection by the nonce of its authorization header
+	c.authNonce = sig.Nonce
+
+	header.Add(auth.HEADER_NAME, sig.String())
+
+	if c.certificate != nil {
+		header.Add(auth.CERTIFICATE_HEADER_NAME, c.certificate.String())
+	}
 
 	return header
 }
 
+// passphrase returns the passphrase of an encrypted private key from the environment, the passphrase command or the
+// passphrase prompt (in that order)
+func (c *client) passphrase(path string) ([]byte, error) {
+	if p, ok := os.LookupEnv(PASSPHRASE_ENV); ok {
+		return []byte(p), nil
+	}
+
+	if c.conf.PassphraseCommand != "" {
+		cmd := exec.Command("sh", "-c", c.conf.PassphraseCommand)
+		cmd.Env = append(os.Environ(), PASSPHRASE_KEY_FILE_ENV+"="+path)
+		cmd.Stderr = os.Stderr
+
+		out, err := cmd.Output()
+
+		if err != nil {
+			return nil, errors.Wrap(err, "passphrase command failed")
+		}
+
+		return bytes.TrimRight(out, "\r\n"), nil
+	}
+
+	if c.conf.PassphrasePrompt != nil {
+		return c.conf.PassphrasePrompt(path)
+	}
+
+	return nil, auth.ErrPassphraseRequired
+}
+
+func (c *client) signMessage(msg *message.Message) error {
+	// there is no key to sign the messages of the clients that don't authenticate with one
+	if !c.conf.SignMessages || !c.usesKey() {
+		return nil
+	}
+
+	if c.signer == nil {
+		return ErrNoSigningKey
+	}
+
+	data, err := msg.SignedData(c.authNonce)
+
+	if err != nil {
+		return err
+	}
+
+	msg.Signature, err = c.signer.Sign(data)
+
+	return err
+}
+
 func (c *client) nextMessageId() int {
 	if c.msgId >= intsets.MaxInt-1 {
 		// wrap around to 0 if we exhaust the range of an integer
@@ -280,11 +519,18 @@ func (c *client) readMessages() {
 	defer close(c.readLoopDone)
 
 	for {
-		messageType, message, err := c.socket.ReadMessage()
+		if err := c.extendReadDeadline(); err != nil {
+			c.logger.Error("Error setting read deadline", zap.String("url", c.url.String()), zap.Error(err))
+			return
+		}
+
+		messageType, msg, err := c.socket.ReadMessage()
 
 		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
 				c.logger.Debug("Connection closed normally", zap.String("url", c.url.String()), zap.Any("socket", c.socket), zap.Error(err))
+			} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				c.logger.Error("Server stopped answering pings, connection lost", zap.String("url", c.url.String()), zap.Error(err))
 			} else {
 				c.logger.Error("Error reading message", zap.String("url", c.url.String()), zap.Any("socket", c.socket), zap.Error(err))
 			}
@@ -292,15 +538,15 @@ func (c *client) readMessages() {
 			return
 		}
 
-		c.logger.Debug("websocket message received", zap.Any("message", message))
+		c.logger.Debug("websocket message received", zap.Any("message", msg))
 
 		if messageType != websocket.TextMessage {
 			// this is not the response to the request
 			continue
 		}
 
-		// convert the raw message to an rc_protocol.Response object
-		resp := rcProto.Response(string(message))
+		// convert the raw message to a message.Response object
+		resp := message.NewResponse(string(msg))
 
 		c.logger.Debug("response received", zap.Any("resp", resp))
 
@@ -312,9 +558,13 @@ func (c *client) readMessages() {
 			continue
 		}
 
+		c.msgLock.Lock()
+
 		if msgChan, ok := c.msgChannels[msgId]; ok {
 			msgChan <- resp
 		}
+
+		c.msgLock.Unlock()
 	}
 }
 
@@ -322,6 +572,77 @@ func (c *client) resetConn() {
 	c.socket = nil
 	c.isConnected = false
 	c.readLoopDone = nil
-	c.msgChannels = map[int]chan rc_protocol.Response{}
+
+	c.msgLock.Lock()
+	c.msgChannels = map[int]chan message.Response{}
 	c.msgId = 0
+	c.msgLock.Unlock()
+}
+
+func (c *client) setupHeartbeat() {
+	timeout := time.Duration(c.conf.PingTimeout) * time.Millisecond
+
+	// any pong (or ping) from the server proves that the connection is still alive
+	c.socket.SetPongHandler(func(string) error {
+		return c.extendReadDeadline()
+	})
+
+	c.socket.SetPingHandler(func(data string) error {
+		now := time.Now()
+
+		if !c.lastServerPing.IsZero() && now.Sub(c.lastServerPing) > c.serverPingGap {
+			c.serverPingGap = now.Sub(c.lastServerPing)
+		}
+
+		c.lastServerPing = now
+
+		_ = c.extendReadDeadline()
+
+		err := c.socket.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(timeout))
+
+		if netErr, ok := err.(net.Error); err == websocket.ErrCloseSent || (ok && netErr.Temporary()) {
+			return nil
+		}
+
+		return err
+	})
+
+	if c.conf.PingInterval <= 0 {
+		return
+	}
+
+	go func(socket *websocket.Conn, done chan struct{}) {
+		ticker := time.NewTicker(time.Duration(c.conf.PingInterval) * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if err := socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout)); err != nil {
+				c.logger.Debug("Error sending ping", zap.String("url", c.url.String()), zap.Error(err))
+				return
+			}
+		}
+	}(c.socket, c.readLoopDone)
+}
+
+// extendReadDeadline allows reads to block until the server misses a ping.  There is no deadline until the server
+// has sent a ping.
+func (c *client) extendReadDeadline() error {
+	if c.conf.PingInterval <= 0 || c.lastServerPing.IsZero() {
+		return nil
+	}
+
+	interval := time.Duration(c.conf.PingInterval) * time.Millisecond
+
+	// the server may ping less often than the client
+	if c.serverPingGap > interval {
+		interval = c.serverPingGap
+	}
+
+	return c.socket.SetReadDeadline(time.Now().Add(interval + time.Duration(c.conf.PingTimeout)*time.Millisecond))
 }
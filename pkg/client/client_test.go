@@ -1,13 +1,24 @@
 package client
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	rc_protocol "github.com/cthayer/go-rc-protocol"
 	server_config "github.com/cthayer/remote_control/internal/config"
 	"github.com/cthayer/remote_control/internal/server"
+	"github.com/cthayer/remote_control/pkg/auth"
 	config "github.com/cthayer/remote_control/pkg/client_config"
+	"github.com/cthayer/remote_control/pkg/message"
 )
 
 func TestNewClient(t *testing.T) {
@@ -36,8 +47,8 @@ func TestClient_Start_Stop_No_Auth(t *testing.T) {
 
 	err := <-errChan
 
-	if err.Error() != "websocket: bad handshake" {
-		t.Error("Client did not fail authentication when it should")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Client did not fail authentication when it should: %v", err)
 	}
 
 	// stop should be safe to call even when there is no connection
@@ -109,6 +120,129 @@ func TestClient_Send_Invalid_Command(t *testing.T) {
 	validateResponse(t, resp, "", "sh: foo: command not found\n", 127)
 }
 
+func TestClient_Facts(t *testing.T) {
+	srv, _ := startServer(t)
+	defer stopServer(t, srv)
+
+	client, _ := startClient(t)
+	defer stopClient(t, client)
+
+	f := <-(*client).Facts()
+
+	if f == nil {
+		t.Error("No facts received")
+		return
+	}
+
+	if f.Hostname == "" {
+		t.Errorf("Facts are missing the hostname: %v", f)
+	}
+}
+
+func TestClient_Send_Connection_Lost(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	// a server that pings once and then stops (and never reads from the connection)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			return
+		}
+
+		_ = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+
+		<-time.After(2 * time.Second)
+		_ = conn.Close()
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	conf := *config.GetConfig()
+	conf.Host = u.Hostname()
+	conf.Port = port
+	conf.TlsDisable = true
+	conf.PingInterval = 50
+	conf.PingTimeout = 50
+
+	client := NewClient(conf)
+
+	if err := <-client.Start(); err != nil {
+		t.Errorf("Error starting client: %v", err)
+		return
+	}
+
+	select {
+	case resp := <-client.Send("echo hello", rc_protocol.MessageOptions{}):
+		if resp != nil {
+			t.Errorf("Wanted no response when the connection is lost, got: %v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Error("Send() did not report the lost connection")
+	}
+
+	_ = <-client.Stop()
+}
+
+func TestClient_Send_Without_Server_Pings(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	// a server without a heartbeat that takes longer to answer than the client's ping interval and timeout
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		_, msg, err := conn.ReadMessage()
+
+		if err != nil {
+			return
+		}
+
+		m := message.NewMessage(string(msg))
+
+		<-time.After(300 * time.Millisecond)
+
+		_ = conn.WriteJSON(rc_protocol.Response{Id: strconv.Itoa(m.Id), Stdout: "hello\n"})
+
+		<-time.After(time.Second)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	conf := *config.GetConfig()
+	conf.Host = u.Hostname()
+	conf.Port = port
+	conf.TlsDisable = true
+	conf.PingInterval = 50
+	conf.PingTimeout = 50
+
+	client := NewClient(conf)
+
+	if err := <-client.Start(); err != nil {
+		t.Fatalf("Error starting client: %v", err)
+	}
+
+	defer func() { _ = <-client.Stop() }()
+
+	select {
+	case resp := <-client.Send("echo hello", rc_protocol.MessageOptions{}):
+		if resp == nil || resp.Stdout != "hello\n" {
+			t.Errorf("Send() = %v, wanted the response of the server", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Send() did not return")
+	}
+}
+
 func startClient(t *testing.T) (*Client, error) {
 	conf := config.GetConfig()
 
@@ -185,3 +319,115 @@ func validateResponse(t *testing.T, cmd *rc_protocol.Response, expectedStdout st
 		t.Errorf("stderr: %s != %s", cmd.Stderr, expectedStderr)
 	}
 }
+
+func TestClient_Passphrase(t *testing.T) {
+	conf := *config.GetConfig()
+	c := NewClient(conf).(*client)
+
+	oldPassphrase, hadPassphrase := os.LookupEnv(PASSPHRASE_ENV)
+	_ = os.Unsetenv(PASSPHRASE_ENV)
+
+	defer func() {
+		if hadPassphrase {
+			_ = os.Setenv(PASSPHRASE_ENV, oldPassphrase)
+		}
+	}()
+
+	if _, err := c.passphrase("client.key"); err != auth.ErrPassphraseRequired {
+		t.Errorf("passphrase() error = %v, wanted %v", err, auth.ErrPassphraseRequired)
+	}
+
+	c.conf.PassphrasePrompt = func(path string) ([]byte, error) {
+		return []byte("prompt " + path), nil
+	}
+
+	if p, _ := c.passphrase("client.key"); string(p) != "prompt client.key" {
+		t.Errorf("passphrase() = %s, wanted the passphrase from the prompt", p)
+	}
+
+	c.conf.PassphraseCommand = "echo \"command $" + PASSPHRASE_KEY_FILE_ENV + "\""
+
+	if p, _ := c.passphrase("client.key"); string(p) != "command client.key" {
+		t.Errorf("passphrase() = %s, wanted the passphrase from the command", p)
+	}
+
+	_ = os.Setenv(PASSPHRASE_ENV, "env")
+	defer os.Unsetenv(PASSPHRASE_ENV)
+
+	if p, _ := c.passphrase("client.key"); string(p) != "env" {
+		t.Errorf("passphrase() = %s, wanted the passphrase from the environment", p)
+	}
+}
+
+func TestClient_Create_Sig_Certificates(t *testing.T) {
+	keyDir := filepath.Join("..", "..", "test", "client", "keys")
+
+	conf := *config.GetConfig()
+	conf.KeyName = ""
+	conf.TlsCertFile = filepath.Join(keyDir, "ecdsa-cert.pem")
+	conf.TlsKeyFile = filepath.Join(keyDir, "ecdsa.key")
+
+	// authenticated by the TLS client certificate only
+	if header := NewClient(conf).(*client).createSig(); header.Get(auth.HEADER_NAME) != "" {
+		t.Errorf("createSig() = %v, wanted no Authorization header", header)
+	}
+
+	conf.KeyDir = keyDir
+	conf.KeyName = "id_ed25519"
+	conf.CertFile = filepath.Join(keyDir, "id_ed25519-cert.pub")
+
+	header := NewClient(conf).(*client).createSig()
+	h, err := auth.ParseHeader(header.Get(auth.HEADER_NAME))
+
+	if err != nil || h.Name != "alice" || header.Get(auth.CERTIFICATE_HEADER_NAME) == "" {
+		t.Errorf("createSig() = %v, wanted a header for the certificate principal alice", header)
+	}
+
+	// the header is bound to the server
+	conf.Host = "RC1.example.com"
+	header = NewClient(conf).(*client).createSig()
+
+	if h, err := auth.ParseHeader(header.Get(auth.HEADER_NAME)); err != nil || h.Host != "rc1.example.com" {
+		t.Errorf("createSig() = %v, wanted a header for the host rc1.example.com", header)
+	}
+}
+
+func TestClient_Sign_Message(t *testing.T) {
+	keyDir := filepath.Join("..", "..", "test", "client", "keys")
+
+	conf := *config.GetConfig()
+	conf.KeyDir = keyDir
+	conf.KeyName = "missing"
+	conf.SignMessages = true
+
+	// the key couldn't be loaded
+	c := NewClient(conf).(*client)
+	c.createSig()
+
+	if err := c.signMessage(&message.Message{Message: rc_protocol.Message{Id: 1, Command: "uptime"}}); err != ErrNoSigningKey {
+		t.Errorf("signMessage() without a key error = %v, wanted %v", err, ErrNoSigningKey)
+	}
+
+	conf.KeyName = "client"
+	c = NewClient(conf).(*client)
+	c.createSig()
+
+	msg := message.Message{Message: rc_protocol.Message{Id: 1, Command: "uptime"}}
+
+	if err := c.signMessage(&msg); err != nil || len(msg.Signature) == 0 {
+		t.Errorf("signMessage() = %v, %x, wanted a signature", err, msg.Signature)
+	}
+
+	// clients authenticated by their TLS client certificate only have no key to sign with
+	conf.KeyName = ""
+	conf.TlsCertFile = filepath.Join(keyDir, "ecdsa-cert.pem")
+	conf.TlsKeyFile = filepath.Join(keyDir, "ecdsa.key")
+	c = NewClient(conf).(*client)
+	c.createSig()
+
+	msg = message.Message{Message: rc_protocol.Message{Id: 1, Command: "uptime"}}
+
+	if err := c.signMessage(&msg); err != nil || len(msg.Signature) != 0 {
+		t.Errorf("signMessage() for a TLS client certificate = %v, %x, wanted no signature", err, msg.Signature)
+	}
+}
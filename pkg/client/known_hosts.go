@@ -0,0 +1,149 @@
+package client
+
+import (
+	"bufio"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+)
+
+var (
+	ErrFingerprintMismatch = errors.New("server certificate fingerprint does not match the pinned or known fingerprint")
+	ErrUnknownHost         = errors.New("server certificate fingerprint is not trusted")
+	errNoServerCertificate = errors.New("server did not present a certificate")
+)
+
+// knownHostsLock serializes the use of known hosts files (and prompts) by the clients of a process
+var knownHostsLock sync.Mutex
+
+// verifyServerCertificate trusts the server by the SPKI fingerprint of its certificate instead of a certificate
+// authority: the fingerprint must be one of the pinned fingerprints or the one recorded in the known hosts file.
+// Servers that aren't in the known hosts file yet are trusted on first use (after asking the HostKeyPrompt).
+func (c *client) verifyServerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errNoServerCertificate
+	}
+
+	leaf, err := x509.ParseCertificate(rawCerts[0])
+
+	if err != nil {
+		return err
+	}
+
+	fingerprint := auth.SpkiFingerprint(leaf)
+
+	if c.conf.TlsPin != "" {
+		for _, pin := range strings.Split(c.conf.TlsPin, ",") {
+			if strings.TrimSpace(pin) == fingerprint {
+				return nil
+			}
+		}
+
+		c.logger.Error("Server certificate does not match the pinned fingerprints", zap.String("host", c.url.Host), zap.String("fingerprint", fingerprint))
+		return ErrFingerprintMismatch
+	}
+
+	return c.checkKnownHost(c.url.Host, fingerprint)
+}
+
+func (c *client) checkKnownHost(host string, fingerprint string) error {
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+
+	knownHosts, err := readKnownHosts(c.conf.KnownHostsFile)
+
+	if err != nil {
+		return err
+	}
+
+	if fingerprints, ok := knownHosts[host]; ok {
+		for _, known := range fingerprints {
+			if known == fingerprint {
+				return nil
+			}
+		}
+
+		c.logger.Error("Server certificate fingerprint has changed", zap.String("host", host), zap.String("fingerprint", fingerprint), zap.Strings("known", fingerprints), zap.String("knownHostsFile", c.conf.KnownHostsFile))
+		return ErrFingerprintMismatch
+	}
+
+	if c.conf.HostKeyPrompt != nil {
+		trusted, err := c.conf.HostKeyPrompt(host, fingerprint)
+
+		if err != nil {
+			return err
+		}
+
+		if !trusted {
+			return ErrUnknownHost
+		}
+	} else {
+		c.logger.Warn("Trusting server certificate on first use", zap.String("host", host), zap.String("fingerprint", fingerprint))
+	}
+
+	return addKnownHost(c.conf.KnownHostsFile, host, fingerprint)
+}
+
+// readKnownHosts reads the fingerprints of the known hosts file by host (`<host>:<port> <fingerprint>` lines, `#`
+// starts a comment).  A missing file has no hosts.
+func readKnownHosts(path string) (map[string][]string, error) {
+	knownHosts := map[string][]string{}
+
+	f, err := os.Open(path)
+
+	if os.IsNotExist(err) {
+		return knownHosts, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) != 2 {
+			continue
+		}
+
+		knownHosts[fields[0]] = append(knownHosts[fields[0]], fields[1])
+	}
+
+	return knownHosts, scanner.Err()
+}
+
+func addKnownHost(path string, host string, fingerprint string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(host + " " + fingerprint + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+	config "github.com/cthayer/remote_control/pkg/client_config"
+)
+
+func loadRawCert(t *testing.T, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Error reading certificate: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+
+	return block.Bytes
+}
+
+func TestClient_Verify_Server_Certificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-known-hosts")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	serverCert := loadRawCert(t, filepath.Join("..", "..", "test", "client", "keys", "ecdsa-cert.pem"))
+	otherCert := loadRawCert(t, filepath.Join("..", "..", "test", "ca", "client-ca.pem"))
+
+	conf := *config.GetConfig()
+	conf.Host = "server.example.com"
+
+	c := NewClient(conf).(*client)
+
+	t.Run("pins", func(t *testing.T) {
+		c.conf.TlsPin = "sha256/other, " + fingerprintOf(t, serverCert)
+
+		if err := c.verifyServerCertificate([][]byte{serverCert}, nil); err != nil {
+			t.Errorf("verifyServerCertificate() pinned error = %v, wanted %v", err, nil)
+		}
+
+		if err := c.verifyServerCertificate([][]byte{otherCert}, nil); err != ErrFingerprintMismatch {
+			t.Errorf("verifyServerCertificate() not pinned error = %v, wanted %v", err, ErrFingerprintMismatch)
+		}
+
+		c.conf.TlsPin = ""
+	})
+
+	t.Run("known hosts", func(t *testing.T) {
+		c.conf.KnownHostsFile = filepath.Join(dir, "rc", "known_hosts")
+		prompts := 0
+
+		c.conf.HostKeyPrompt = func(host string, fingerprint string) (bool, error) {
+			prompts++
+
+			return host == "server.example.com:4515" && fingerprint == fingerprintOf(t, serverCert), nil
+		}
+
+		// trusted on first use
+		if err := c.verifyServerCertificate([][]byte{serverCert}, nil); err != nil || prompts != 1 {
+			t.Errorf("verifyServerCertificate() unknown host error = %v (%d prompts), wanted %v after a prompt", err, prompts, nil)
+		}
+
+		if err := c.verifyServerCertificate([][]byte{serverCert}, nil); err != nil || prompts != 1 {
+			t.Errorf("verifyServerCertificate() known host error = %v (%d prompts), wanted %v without a prompt", err, prompts, nil)
+		}
+
+		if err := c.verifyServerCertificate([][]byte{otherCert}, nil); err != ErrFingerprintMismatch || prompts != 1 {
+			t.Errorf("verifyServerCertificate() changed fingerprint error = %v (%d prompts), wanted %v", err, prompts, ErrFingerprintMismatch)
+		}
+
+		// declined in the prompt
+		c.url.Host = "other.example.com:4515"
+
+		if err := c.verifyServerCertificate([][]byte{otherCert}, nil); err != ErrUnknownHost {
+			t.Errorf("verifyServerCertificate() declined host error = %v, wanted %v", err, ErrUnknownHost)
+		}
+
+		if knownHosts, _ := readKnownHosts(c.conf.KnownHostsFile); len(knownHosts) != 1 {
+			t.Errorf("known hosts = %v, wanted only the trusted host", knownHosts)
+		}
+	})
+}
+
+func fingerprintOf(t *testing.T, der []byte) string {
+	cert, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+
+	return auth.SpkiFingerprint(cert)
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+var (
+	// ErrUnauthorized is returned by Start when the server couldn't authenticate the client (401)
+	ErrUnauthorized = errors.New("the server did not accept the client's credentials")
+	// ErrForbidden is returned by Start when the server authenticated the client but doesn't allow it to connect (403)
+	ErrForbidden = errors.New("the client is not allowed to connect")
+	// ErrKeyRevoked is returned by Start when the client's key has been revoked on the server
+	ErrKeyRevoked = errors.New("the client's key has been revoked")
+	// ErrKeyExpired is returned by Start when the client's key is outside of its validity period on the server
+	ErrKeyExpired = errors.New("the client's key is not valid at this time")
+	// ErrTooManyRequests is returned by Start when the server refused the connection because of its limits (429 or
+	// 503).  The RetryAfter of the RejectedError tells when to try again.
+	ErrTooManyRequests = errors.New("the server refused the connection because of its limits")
+)
+
+// RejectedError is returned by Start when the server refused the websocket upgrade.  It wraps one of the errors above
+// (use errors.Is) and carries the machine-readable reason sent by the server.
+type RejectedError struct {
+	StatusCode int
+	Reason     string
+	Message    string
+	RetryAfter time.Duration
+	err        error
+}
+
+func (e *RejectedError) Error() string {
+	msg := e.err.Error()
+
+	if e.Message != "" {
+		msg = "the server rejected the connection: " + e.Message
+	}
+
+	return msg + " (" + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode) + ")"
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.err
+}
+
+// IsAuthError tells whether err is an authentication or authorization failure, which retrying won't fix
+func IsAuthError(err error) bool {
+	for _, authErr := range []error{ErrUnauthorized, ErrForbidden, ErrKeyRevoked, ErrKeyExpired} {
+		if errors.Is(err, authErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rejectedError returns the error of a failed websocket handshake (nil when the server didn't refuse it with one of
+// the statuses above)
+func rejectedError(resp *http.Response) error {
+	if resp == nil {
+		return nil
+	}
+
+	e := RejectedError{StatusCode: resp.StatusCode}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		e.err = ErrUnauthorized
+	case http.StatusForbidden:
+		e.err = ErrForbidden
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		e.err = ErrTooManyRequests
+	default:
+		return nil
+	}
+
+	// the websocket dialer keeps the beginning of the body of a failed handshake
+	if body, err := ioutil.ReadAll(resp.Body); err == nil {
+		var rejection message.Rejection
+
+		if json.Unmarshal(body, &rejection) == nil {
+			e.Reason = rejection.Reason
+			e.Message = rejection.Error
+		}
+	}
+
+	switch e.Reason {
+	case message.REJECTION_KEY_REVOKED:
+		e.err = ErrKeyRevoked
+	case message.REJECTION_KEY_EXPIRED, message.REJECTION_KEY_NOT_YET_VALID:
+		e.err = ErrKeyExpired
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return &e
+}
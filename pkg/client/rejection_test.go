@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	server_config "github.com/cthayer/remote_control/internal/config"
+	"github.com/cthayer/remote_control/internal/server"
+	config "github.com/cthayer/remote_control/pkg/client_config"
+)
+
+func TestRejectedError(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       int
+		body       string
+		retryAfter string
+		wantErr    error
+		wantAuth   bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"reason": "invalid_signature", "error": "invalid signature"}`, "", ErrUnauthorized, true},
+		{"revoked", http.StatusForbidden, `{"reason": "revoked", "error": "key has been revoked"}`, "", ErrKeyRevoked, true},
+		{"expired", http.StatusForbidden, `{"reason": "expired", "error": "key has expired"}`, "", ErrKeyExpired, true},
+		{"forbidden", http.StatusForbidden, `{"reason": "address_not_allowed"}`, "", ErrForbidden, true},
+		{"no body", http.StatusUnauthorized, ``, "", ErrUnauthorized, true},
+		{"rate limited", http.StatusTooManyRequests, `{"reason": "ip_rate_limited"}`, "3", ErrTooManyRequests, false},
+		{"other", http.StatusNotFound, ``, "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := http.Response{
+				StatusCode: tt.code,
+				Header:     http.Header{"Retry-After": []string{tt.retryAfter}},
+				Body:       ioutil.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+
+			err := rejectedError(&resp)
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("rejectedError() = %v, wanted nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("rejectedError() = %v, wanted %v", err, tt.wantErr)
+			}
+
+			if IsAuthError(err) != tt.wantAuth {
+				t.Errorf("IsAuthError(%v) = %v, wanted %v", err, !tt.wantAuth, tt.wantAuth)
+			}
+
+			var rejected *RejectedError
+
+			if errors.As(err, &rejected) && tt.retryAfter != "" && rejected.RetryAfter != 3*time.Second {
+				t.Errorf("RetryAfter = %v, wanted 3s", rejected.RetryAfter)
+			}
+		})
+	}
+
+	if rejectedError(nil) != nil {
+		t.Error("rejectedError(nil) should be nil")
+	}
+}
+
+func TestClient_Start_Revoked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rc-revoked")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	srvConf := *server_config.GetConfig()
+	srvConf.CertDir = filepath.Join("..", "..", "test", "server", "certs")
+	srvConf.RevokedKeysFile = filepath.Join(dir, "revoked")
+
+	_ = ioutil.WriteFile(srvConf.RevokedKeysFile, []byte("client\n"), 0600)
+
+	srv := server.NewServer(&srvConf)
+
+	if err := <-srv.Start(); err != nil {
+		t.Fatalf("Error starting server: %v", err)
+	}
+
+	defer stopServer(t, &srv)
+
+	conf := *config.GetConfig()
+	conf.KeyName = "client"
+	conf.KeyDir = filepath.Join("..", "..", "test", "client", "keys")
+
+	err = <-NewClient(conf).Start()
+
+	if !errors.Is(err, ErrKeyRevoked) || !IsAuthError(err) {
+		t.Errorf("Start() with a revoked key error = %v, wanted %v", err, ErrKeyRevoked)
+	}
+
+	var rejected *RejectedError
+
+	if !errors.As(err, &rejected) || rejected.StatusCode != http.StatusForbidden || rejected.Reason != "revoked" {
+		t.Errorf("Start() with a revoked key error = %#v, wanted a 403 with the revoked reason", err)
+	}
+}
@@ -1,36 +1,71 @@
 package client_config
 
 type Config struct {
-	Port          int    `json:"port"`
-	Host          string `json:"host"`
-	KeyDir        string `json:"keyDir"`
-	KeyName       string `json:"keyName"`
-	LogLevel      string `json:"logLevel"`
-	TlsSkipVerify bool   `json:"tlsSkipVerify"`
-	TlsCaFile     string `json:"tlsCaFile"`
-	TlsDisable    bool   `json:"tlsDisable"`
+	Port              int    `json:"port"`
+	Host              string `json:"host"`
+	KeyDir            string `json:"keyDir"`
+	KeyName           string `json:"keyName"`
+	LogLevel          string `json:"logLevel"`
+	TlsSkipVerify     bool   `json:"tlsSkipVerify"`
+	TlsCaFile         string `json:"tlsCaFile"`
+	TlsDisable        bool   `json:"tlsDisable"`
+	PingInterval      int    `json:"pingInterval"`
+	PingTimeout       int    `json:"pingTimeout"`
+	SignMessages      bool   `json:"signMessages"`
+	UseAgent          bool   `json:"useAgent"`
+	PassphraseCommand string `json:"passphraseCommand"`
+	CertFile          string `json:"certFile"`
+	TlsCertFile       string `json:"tlsCertFile"`
+	TlsKeyFile        string `json:"tlsKeyFile"`
+	TlsPin            string `json:"tlsPin"`
+	KnownHostsFile    string `json:"knownHostsFile"`
+	// PassphrasePrompt asks the user for the passphrase of the encrypted private key at path (ex: on a terminal)
+	PassphrasePrompt func(path string) ([]byte, error) `json:"-"`
+	// HostKeyPrompt asks the user whether to trust a server whose fingerprint is not in the known hosts file yet.
+	// Without it, unknown servers are trusted on first use.
+	HostKeyPrompt func(host string, fingerprint string) (bool, error) `json:"-"`
 }
 
 const (
-	DEFAULT_PORT            = 4515
-	DEFAULT_HOST            = "localhost"
-	DEFAULT_KEY_DIR         = ""
-	DEFAULT_KEY_NAME        = ""
-	DEFAULT_LOG_LEVEL       = "info"
-	DEFAULT_TLS_CA_FILE     = ""
-	DEFAULT_TLS_SKIP_VERIFY = false
-	DEFAULT_TLS_DISABLE     = false
+	DEFAULT_PORT               = 4515
+	DEFAULT_HOST               = "localhost"
+	DEFAULT_KEY_DIR            = ""
+	DEFAULT_KEY_NAME           = ""
+	DEFAULT_LOG_LEVEL          = "info"
+	DEFAULT_TLS_CA_FILE        = ""
+	DEFAULT_TLS_SKIP_VERIFY    = false
+	DEFAULT_TLS_DISABLE        = false
+	DEFAULT_PING_INTERVAL      = 5000
+	DEFAULT_PING_TIMEOUT       = 1000
+	DEFAULT_SIGN_MESSAGES      = true
+	DEFAULT_USE_AGENT          = false
+	DEFAULT_PASSPHRASE_COMMAND = ""
+	DEFAULT_CERT_FILE          = ""
+	DEFAULT_TLS_CERT_FILE      = ""
+	DEFAULT_TLS_KEY_FILE       = ""
+	DEFAULT_TLS_PIN            = ""
+	DEFAULT_KNOWN_HOSTS_FILE   = ""
 )
 
 var config Config = Config{
-	Port:          DEFAULT_PORT,
-	Host:          DEFAULT_HOST,
-	KeyDir:        DEFAULT_KEY_DIR,
-	KeyName:       DEFAULT_KEY_NAME,
-	LogLevel:      DEFAULT_LOG_LEVEL,
-	TlsSkipVerify: DEFAULT_TLS_SKIP_VERIFY,
-	TlsCaFile:     DEFAULT_TLS_CA_FILE,
-	TlsDisable:    DEFAULT_TLS_DISABLE,
+	Port:              DEFAULT_PORT,
+	Host:              DEFAULT_HOST,
+	KeyDir:            DEFAULT_KEY_DIR,
+	KeyName:           DEFAULT_KEY_NAME,
+	LogLevel:          DEFAULT_LOG_LEVEL,
+	TlsSkipVerify:     DEFAULT_TLS_SKIP_VERIFY,
+	TlsCaFile:         DEFAULT_TLS_CA_FILE,
+	TlsDisable:        DEFAULT_TLS_DISABLE,
+	PingInterval:      DEFAULT_PING_INTERVAL,
+	PingTimeout:       DEFAULT_PING_TIMEOUT,
+	SignMessages:      DEFAULT_SIGN_MESSAGES,
+	UseAgent:          DEFAULT_USE_AGENT,
+	PassphraseCommand: DEFAULT_PASSPHRASE_COMMAND,
+	CertFile:          DEFAULT_CERT_FILE,
+	TlsCertFile:       DEFAULT_TLS_CERT_FILE,
+	TlsKeyFile:        DEFAULT_TLS_KEY_FILE,
+	TlsPin:            DEFAULT_TLS_PIN,
+	KnownHostsFile:    DEFAULT_KNOWN_HOSTS_FILE,
 }
 
 func GetConfig() *Config {
@@ -7,14 +7,24 @@ import (
 
 func TestGetConfig(t *testing.T) {
 	want := Config{
-		Port:          DEFAULT_PORT,
-		Host:          DEFAULT_HOST,
-		KeyDir:        DEFAULT_KEY_DIR,
-		KeyName:       DEFAULT_KEY_NAME,
-		LogLevel:      DEFAULT_LOG_LEVEL,
-		TlsSkipVerify: DEFAULT_TLS_SKIP_VERIFY,
-		TlsCaFile:     DEFAULT_TLS_CA_FILE,
-		TlsDisable:    DEFAULT_TLS_DISABLE,
+		Port:              DEFAULT_PORT,
+		Host:              DEFAULT_HOST,
+		KeyDir:            DEFAULT_KEY_DIR,
+		KeyName:           DEFAULT_KEY_NAME,
+		LogLevel:          DEFAULT_LOG_LEVEL,
+		TlsSkipVerify:     DEFAULT_TLS_SKIP_VERIFY,
+		TlsCaFile:         DEFAULT_TLS_CA_FILE,
+		TlsDisable:        DEFAULT_TLS_DISABLE,
+		PingInterval:      DEFAULT_PING_INTERVAL,
+		PingTimeout:       DEFAULT_PING_TIMEOUT,
+		SignMessages:      DEFAULT_SIGN_MESSAGES,
+		UseAgent:          DEFAULT_USE_AGENT,
+		PassphraseCommand: DEFAULT_PASSPHRASE_COMMAND,
+		CertFile:          DEFAULT_CERT_FILE,
+		TlsCertFile:       DEFAULT_TLS_CERT_FILE,
+		TlsKeyFile:        DEFAULT_TLS_KEY_FILE,
+		TlsPin:            DEFAULT_TLS_PIN,
+		KnownHostsFile:    DEFAULT_KNOWN_HOSTS_FILE,
 	}
 
 	if config := GetConfig(); !reflect.DeepEqual(*config, want) {
@@ -0,0 +1,97 @@
+package facts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+const (
+	CUSTOM_FACT_TIMEOUT        = 10 // seconds an executable custom fact is allowed to run
+	CUSTOM_FACT_JSON_EXTENSION = ".json"
+)
+
+// gatherCustom loads the custom facts from dir.
+//
+// Each `*.json` file and each executable that writes JSON to stdout becomes a fact named after the file (without its
+// extension).  Other files are ignored.
+func gatherCustom(dir string) (map[string]interface{}, error) {
+	var result *multierror.Error
+
+	custom := map[string]interface{}{}
+
+	files, err := ioutil.ReadDir(dir)
+
+	if os.IsNotExist(err) {
+		// no custom facts are configured on this host
+		return custom, nil
+	}
+
+	if err != nil {
+		return custom, err
+	}
+
+	for _, file := range files {
+		var content []byte
+		var value interface{}
+
+		path := filepath.Join(dir, file.Name())
+		ext := filepath.Ext(file.Name())
+		name := strings.TrimSuffix(file.Name(), ext)
+
+		// ReadDir doesn't follow symlinks, whose mode would make any linked file look executable
+		info, err := os.Stat(path)
+
+		if err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "custom fact "+file.Name()))
+			continue
+		}
+
+		switch {
+		case info.IsDir():
+			continue
+		case info.Mode()&0111 != 0:
+			content, err = runCustom(path)
+		case ext == CUSTOM_FACT_JSON_EXTENSION:
+			content, err = ioutil.ReadFile(path)
+		default:
+			continue
+		}
+
+		if err == nil {
+			err = json.Unmarshal(content, &value)
+		}
+
+		if err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "custom fact "+file.Name()))
+			continue
+		}
+
+		custom[name] = value
+	}
+
+	return custom, result.ErrorOrNil()
+}
+
+func runCustom(path string) ([]byte, error) {
+	var stdout bytes.Buffer
+
+	ctx, cancel := context.WithTimeout(context.Background(), CUSTOM_FACT_TIMEOUT*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+
+	return stdout.Bytes(), err
+}
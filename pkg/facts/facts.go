@@ -0,0 +1,110 @@
+package facts
+
+import (
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+type Facts struct {
+	Hostname  string                 `json:"hostname"`
+	Os        string                 `json:"os"`
+	OsVersion string                 `json:"osVersion"`
+	Platform  string                 `json:"platform"`
+	Arch      string                 `json:"arch"`
+	Kernel    string                 `json:"kernel"`
+	Cpus      int                    `json:"cpus"`
+	CpuModel  string                 `json:"cpuModel"`
+	Memory    Memory                 `json:"memory"`
+	Uptime    int64                  `json:"uptime"`
+	Load      Load                   `json:"load"`
+	Addresses []string               `json:"addresses"`
+	Disks     []Disk                 `json:"disks"`
+	Version   string                 `json:"version"`
+	Custom    map[string]interface{} `json:"custom"`
+}
+
+// Memory sizes are in bytes
+type Memory struct {
+	Total     uint64 `json:"total"`
+	Free      uint64 `json:"free"`
+	Available uint64 `json:"available"`
+}
+
+type Load struct {
+	One     float64 `json:"one"`
+	Five    float64 `json:"five"`
+	Fifteen float64 `json:"fifteen"`
+}
+
+// Disk sizes are in bytes
+type Disk struct {
+	Mount  string `json:"mount"`
+	Device string `json:"device"`
+	FsType string `json:"fsType"`
+	Total  uint64 `json:"total"`
+	Free   uint64 `json:"free"`
+	Used   uint64 `json:"used"`
+}
+
+// Gather collects facts about the host without spawning a shell.
+//
+// Facts that can't be collected are left empty and their errors are returned together, so the caller always gets as
+// much information as is available.
+func Gather(version string, customDir string) (*Facts, error) {
+	var result *multierror.Error
+	var err error
+
+	f := Facts{
+		Platform: runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Cpus:     runtime.NumCPU(),
+		Version:  version,
+		Custom:   map[string]interface{}{},
+	}
+
+	if f.Hostname, err = os.Hostname(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if f.Addresses, err = gatherAddresses(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	// collect the platform specific facts
+	if err = f.gatherPlatform(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if customDir != "" {
+		if f.Custom, err = gatherCustom(customDir); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return &f, result.ErrorOrNil()
+}
+
+func gatherAddresses() ([]string, error) {
+	var addresses []string
+
+	addrs, err := net.InterfaceAddrs()
+
+	if err != nil {
+		return addresses, err
+	}
+
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+
+		if err != nil || ip.IsLoopback() {
+			continue
+		}
+
+		addresses = append(addresses, ip.String())
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,225 @@
+package facts
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	PROC_OS_RELEASE   = "/etc/os-release"
+	PROC_KERNEL       = "/proc/sys/kernel/osrelease"
+	PROC_CPUINFO      = "/proc/cpuinfo"
+	PROC_MEMINFO      = "/proc/meminfo"
+	PROC_UPTIME       = "/proc/uptime"
+	PROC_LOADAVG      = "/proc/loadavg"
+	PROC_MOUNTS       = "/proc/mounts"
+	MEMINFO_UNIT_SIZE = 1024
+)
+
+func (f *Facts) gatherPlatform() error {
+	var result *multierror.Error
+
+	for _, fn := range []func() error{f.gatherOs, f.gatherKernel, f.gatherCpu, f.gatherMemory, f.gatherUptime, f.gatherLoad, f.gatherDisks} {
+		if err := fn(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (f *Facts) gatherOs() error {
+	content, err := ioutil.ReadFile(PROC_OS_RELEASE)
+
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "ID":
+			f.Os = strings.Trim(parts[1], "\"'")
+		case "VERSION_ID":
+			f.OsVersion = strings.Trim(parts[1], "\"'")
+		}
+	}
+
+	return nil
+}
+
+func (f *Facts) gatherKernel() error {
+	content, err := ioutil.ReadFile(PROC_KERNEL)
+
+	if err != nil {
+		return err
+	}
+
+	f.Kernel = strings.TrimSpace(string(content))
+
+	return nil
+}
+
+func (f *Facts) gatherCpu() error {
+	file, err := os.Open(PROC_CPUINFO)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	line := bufio.NewScanner(file)
+
+	for line.Scan() {
+		parts := strings.SplitN(line.Text(), ":", 2)
+
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "model name" {
+			f.CpuModel = strings.TrimSpace(parts[1])
+			break
+		}
+	}
+
+	return line.Err()
+}
+
+func (f *Facts) gatherMemory() error {
+	file, err := os.Open(PROC_MEMINFO)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	line := bufio.NewScanner(file)
+
+	for line.Scan() {
+		fields := strings.Fields(line.Text())
+
+		if len(fields) < 2 {
+			continue
+		}
+
+		// values in /proc/meminfo are in kB
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			f.Memory.Total = value * MEMINFO_UNIT_SIZE
+		case "MemFree:":
+			f.Memory.Free = value * MEMINFO_UNIT_SIZE
+		case "MemAvailable:":
+			f.Memory.Available = value * MEMINFO_UNIT_SIZE
+		}
+	}
+
+	return line.Err()
+}
+
+func (f *Facts) gatherUptime() error {
+	content, err := ioutil.ReadFile(PROC_UPTIME)
+
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(string(content))
+
+	if len(fields) < 1 {
+		return nil
+	}
+
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+
+	if err != nil {
+		return err
+	}
+
+	f.Uptime = int64(uptime)
+
+	return nil
+}
+
+func (f *Facts) gatherLoad() error {
+	content, err := ioutil.ReadFile(PROC_LOADAVG)
+
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(string(content))
+
+	if len(fields) < 3 {
+		return nil
+	}
+
+	loads := make([]float64, 3)
+
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return err
+		}
+	}
+
+	f.Load = Load{One: loads[0], Five: loads[1], Fifteen: loads[2]}
+
+	return nil
+}
+
+func (f *Facts) gatherDisks() error {
+	file, err := os.Open(PROC_MOUNTS)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	f.Disks = []Disk{}
+	line := bufio.NewScanner(file)
+
+	for line.Scan() {
+		fields := strings.Fields(line.Text())
+
+		// only report block devices (skips proc, sysfs, tmpfs, etc)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+
+		var stat syscall.Statfs_t
+
+		if err := syscall.Statfs(fields[1], &stat); err != nil {
+			continue
+		}
+
+		disk := Disk{
+			Device: fields[0],
+			Mount:  fields[1],
+			FsType: fields[2],
+			Total:  stat.Blocks * uint64(stat.Bsize),
+			Free:   stat.Bavail * uint64(stat.Bsize),
+		}
+
+		disk.Used = disk.Total - stat.Bfree*uint64(stat.Bsize)
+
+		f.Disks = append(f.Disks, disk)
+	}
+
+	return line.Err()
+}
@@ -0,0 +1,8 @@
+//+build !linux
+
+package facts
+
+// only the portable facts are available on platforms other than linux
+func (f *Facts) gatherPlatform() error {
+	return nil
+}
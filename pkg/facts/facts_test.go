@@ -0,0 +1,118 @@
+package facts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestGather(t *testing.T) {
+	f, err := Gather("1.2.3", filepath.Join("..", "..", "test", "facts"))
+
+	if err != nil {
+		t.Errorf("Gather() error = %v, wanted %v", err, nil)
+	}
+
+	if f == nil {
+		t.Fatal("Gather() returned <nil> facts")
+	}
+
+	if f.Version != "1.2.3" {
+		t.Errorf("Version = %s, wanted %s", f.Version, "1.2.3")
+	}
+
+	if f.Hostname == "" {
+		t.Error("Hostname was not gathered")
+	}
+
+	if f.Platform != runtime.GOOS || f.Arch != runtime.GOARCH {
+		t.Errorf("Platform = %s/%s, wanted %s/%s", f.Platform, f.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	if f.Cpus < 1 {
+		t.Errorf("Cpus = %d, wanted at least 1", f.Cpus)
+	}
+
+	if runtime.GOOS == "linux" {
+		if f.Kernel == "" {
+			t.Error("Kernel was not gathered")
+		}
+
+		if f.Memory.Total == 0 {
+			t.Error("Memory was not gathered")
+		}
+	}
+}
+
+func TestGather_Custom(t *testing.T) {
+	want := map[string]interface{}{
+		"role": map[string]interface{}{
+			"name": "web",
+			"tier": "frontend",
+		},
+		"datacenter": "us-east-1",
+	}
+
+	custom, err := gatherCustom(filepath.Join("..", "..", "test", "facts"))
+
+	if err != nil {
+		t.Errorf("gatherCustom() error = %v, wanted %v", err, nil)
+	}
+
+	if !reflect.DeepEqual(custom, want) {
+		t.Errorf("gatherCustom() = %v, wanted %v", custom, want)
+	}
+}
+
+func TestGather_Custom_Symlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "rc-facts")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	target, _ := filepath.Abs(filepath.Join("..", "..", "test", "facts", "role.json"))
+
+	// a symlink to a JSON fact is read, not executed
+	if err := os.Symlink(target, filepath.Join(dir, "linked.json")); err != nil {
+		t.Fatalf("Error creating symlink: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"linked": map[string]interface{}{
+			"name": "web",
+			"tier": "frontend",
+		},
+	}
+
+	custom, err := gatherCustom(dir)
+
+	if err != nil {
+		t.Errorf("gatherCustom() error = %v, wanted %v", err, nil)
+	}
+
+	if !reflect.DeepEqual(custom, want) {
+		t.Errorf("gatherCustom() = %v, wanted %v", custom, want)
+	}
+}
+
+func TestGather_Custom_Missing_Dir(t *testing.T) {
+	custom, err := gatherCustom(filepath.Join("..", "..", "test", "does-not-exist"))
+
+	if err != nil {
+		t.Errorf("gatherCustom() error = %v, wanted %v", err, nil)
+	}
+
+	if len(custom) != 0 {
+		t.Errorf("gatherCustom() = %v, wanted no custom facts", custom)
+	}
+}
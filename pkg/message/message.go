@@ -0,0 +1,101 @@
+package message
+
+import (
+	"encoding/json"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+
+	"github.com/cthayer/remote_control/pkg/facts"
+)
+
+const (
+	TYPE_COMMAND = "command"
+	TYPE_FACTS   = "facts"
+
+	// the message was rejected because the server is draining
+	STATUS_DRAINING = "draining"
+	// the command was queued but canceled before it ran because the server started draining
+	STATUS_CANCELED = "canceled"
+	// the command was queued but killed before it ran (through the admin API or by its client)
+	STATUS_KILLED = "killed"
+	// the message was rejected because the client sent too many messages (try again later)
+	STATUS_RATE_LIMITED = "rate_limited"
+
+	// the reasons of the rejections (of connections) that clients tell apart from other authentication failures
+	REJECTION_KEY_REVOKED       = "revoked"
+	REJECTION_KEY_EXPIRED       = "expired"
+	REJECTION_KEY_NOT_YET_VALID = "not_yet_valid"
+
+	// the streams of the output of a command
+	STREAM_STDOUT = "stdout"
+	STREAM_STDERR = "stderr"
+)
+
+// Message extends the rc-protocol message with a type so that the server can answer requests other than commands.
+// Messages without a type are commands, which keeps plain rc-protocol clients working.
+//
+// Signed messages carry a signature of their SignedData made with the client's key
+type Message struct {
+	rc_protocol.Message
+	Type      string `json:"type,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Response extends the rc-protocol response with the payloads of the non-command message types.  The status of a
+// message that the server didn't handle (ex: STATUS_DRAINING) tells the client why.
+type Response struct {
+	rc_protocol.Response
+	Facts  *facts.Facts `json:"facts,omitempty"`
+	Status string       `json:"status,omitempty"`
+}
+
+// Rejection is the body of the HTTP error response of a connection that the server refused before the websocket
+// upgrade (ex: because the client failed to authenticate).  Reason is machine-readable (ex: REJECTION_KEY_REVOKED).
+type Rejection struct {
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+}
+
+// ExecEvent is a line of the NDJSON stream of POST /v1/exec: either a chunk of the output of the command (Stream and
+// Data) or, on the last line, the response of the command
+type ExecEvent struct {
+	Stream   string    `json:"stream,omitempty"`
+	Data     string    `json:"data,omitempty"`
+	Response *Response `json:"response,omitempty"`
+}
+
+func NewMessage(jsonStr string) Message {
+	msg := Message{}
+
+	// invalid messages are treated as empty commands (same as rc-protocol)
+	_ = json.Unmarshal([]byte(jsonStr), &msg)
+
+	return msg
+}
+
+func NewResponse(jsonStr string) Response {
+	resp := Response{Response: rc_protocol.Response{ExitCode: -1}}
+
+	// invalid responses are treated as failed commands (same as rc-protocol)
+	_ = json.Unmarshal([]byte(jsonStr), &resp)
+
+	return resp
+}
+
+func (m *Message) IsCommand() bool {
+	return m.Type == "" || m.Type == TYPE_COMMAND
+}
+
+// SignedData is the canonical form of the message that is covered by its signature: the nonce of the connection's
+// Authorization header followed by the JSON encoding of the message without its signature
+func (m Message) SignedData(nonce string) ([]byte, error) {
+	m.Signature = nil
+
+	jsonStr, err := json.Marshal(m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nonce+";"), jsonStr...), nil
+}
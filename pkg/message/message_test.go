@@ -0,0 +1,78 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+)
+
+func TestNewMessage(t *testing.T) {
+	want := Message{
+		Message: rc_protocol.Message{Id: 1, Command: "uptime"},
+	}
+
+	msg := NewMessage("{\"id\": 1, \"command\": \"uptime\"}")
+
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("NewMessage() = %v, wanted %v", msg, want)
+	}
+
+	if !msg.IsCommand() {
+		t.Error("Messages without a type should be commands")
+	}
+
+	msg = NewMessage("{\"id\": 2, \"type\": \"facts\"}")
+
+	if msg.IsCommand() || msg.Type != TYPE_FACTS {
+		t.Errorf("Message type = %s, wanted %s", msg.Type, TYPE_FACTS)
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	want := Response{Response: rc_protocol.Response{ExitCode: -1}}
+
+	if resp := NewResponse(""); !reflect.DeepEqual(resp, want) {
+		t.Errorf("NewResponse() = %v, wanted %v", resp, want)
+	}
+
+	resp := NewResponse("{\"id\": \"3\", \"exitCode\": 0, \"facts\": {\"hostname\": \"host1\"}}")
+
+	if resp.Id != "3" || resp.ExitCode != 0 {
+		t.Errorf("NewResponse() = %v, wanted id 3 and exitCode 0", resp)
+	}
+
+	if resp.Facts == nil || resp.Facts.Hostname != "host1" {
+		t.Errorf("NewResponse() facts = %v, wanted hostname host1", resp.Facts)
+	}
+}
+
+func TestMessage_SignedData(t *testing.T) {
+	msg := NewMessage("{\"id\": 4, \"command\": \"uptime\", \"options\": {\"env\": {\"B\": \"2\", \"A\": \"1\"}}}")
+
+	want, err := msg.SignedData("c0ffee")
+
+	if err != nil {
+		t.Errorf("SignedData() error = %v, wanted %v", err, nil)
+		return
+	}
+
+	if !bytes.HasPrefix(want, []byte("c0ffee;{")) {
+		t.Errorf("SignedData() = %s, wanted the nonce followed by the message json", want)
+	}
+
+	// the signature is not part of the signed data and the json encoding doesn't depend on the order of the input
+	msg.Signature = []byte("signature")
+	jsonStr, _ := json.Marshal(msg)
+	msg = NewMessage(string(jsonStr))
+
+	if got, _ := msg.SignedData("c0ffee"); !bytes.Equal(got, want) {
+		t.Errorf("SignedData() = %s, wanted %s", got, want)
+	}
+
+	if !bytes.Equal(msg.Signature, []byte("signature")) {
+		t.Errorf("Signature = %s, wanted %s", msg.Signature, "signature")
+	}
+}
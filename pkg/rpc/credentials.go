@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/cthayer/remote_control/pkg/auth"
+)
+
+// Credentials authenticate each RPC with a new Authorization header made with the client's key (use them with
+// grpc.WithPerRPCCredentials).  They aren't needed when the server authenticates the client by its TLS client
+// certificate only.
+type Credentials struct {
+	signer      *auth.Signer
+	certificate *auth.Certificate
+	host        string
+	insecure    bool
+}
+
+// NewCredentials signs the RPCs to the server host (its name without the port) with signer.  With a certificate, the
+// certificate is sent along with the signature and the name of the signer is checked against its principals.
+func NewCredentials(signer *auth.Signer, certificate *auth.Certificate, host string) *Credentials {
+	return &Credentials{signer: signer, certificate: certificate, host: host}
+}
+
+// AllowInsecure lets the credentials be sent over connections without TLS (ex: on localhost)
+func (c *Credentials) AllowInsecure() *Credentials {
+	c.insecure = true
+
+	return c
+}
+
+func (c *Credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	// the RPC already has the header that its message was signed with (see Sign)
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(auth.HEADER_NAME)) > 0 {
+		return nil, nil
+	}
+
+	h, err := c.signer.CreateHeader(c.host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.metadata(h), nil
+}
+
+func (c *Credentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+// Sign signs the message of a request for the servers that require signed messages.  The signature is bound to the
+// Authorization header of the RPC: make the RPC with the returned context.
+func (c *Credentials) Sign(ctx context.Context, req SignedRequest) (context.Context, error) {
+	h, err := c.signer.CreateHeader(c.host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.setSignature(nil)
+
+	m := req.Message()
+
+	data, err := m.SignedData(h.Nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := c.signer.Sign(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.setSignature(signature)
+
+	var pairs []string
+
+	for k, v := range c.metadata(h) {
+		pairs = append(pairs, k, v)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, pairs...), nil
+}
+
+// metadata returns the metadata of an Authorization header (gRPC metadata keys are lowercase)
+func (c *Credentials) metadata(h *auth.Header) map[string]string {
+	md := map[string]string{strings.ToLower(auth.HEADER_NAME): h.String()}
+
+	if c.certificate != nil {
+		md[strings.ToLower(auth.CERTIFICATE_HEADER_NAME)] = c.certificate.String()
+	}
+
+	return md
+}
@@ -0,0 +1,103 @@
+// Package rpc is the gRPC API of the server (see rc.proto).  The code in rc.pb.go is generated with:
+//
+//	protoc --go_out=plugins=grpc,paths=source_relative:. rc.proto
+//
+// Clients in other languages can generate their stubs from the same rc.proto.
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. rc.proto
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/golang/protobuf/jsonpb"
+	_struct "github.com/golang/protobuf/ptypes/struct"
+
+	rc_protocol "github.com/cthayer/go-rc-protocol"
+	"github.com/cthayer/remote_control/pkg/facts"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+// SignedRequest is a request that carries a message signature (ExecRequest and FactsRequest)
+type SignedRequest interface {
+	// Message is the message of the websocket API that the request stands for (its signature covers the message)
+	Message() message.Message
+	setSignature(signature []byte)
+}
+
+func (r *ExecRequest) Message() message.Message {
+	m := message.Message{
+		Message: rc_protocol.Message{
+			Id:      int(r.GetId()),
+			Command: r.GetCommand(),
+			Options: rc_protocol.MessageOptions{
+				Cwd:     r.GetCwd(),
+				Timeout: int(r.GetTimeout()),
+				Env:     r.GetEnv(),
+			},
+		},
+		Signature: r.GetSignature(),
+	}
+
+	return m
+}
+
+func (r *ExecRequest) setSignature(signature []byte) {
+	r.Signature = signature
+}
+
+func (r *FactsRequest) Message() message.Message {
+	m := message.Message{Type: message.TYPE_FACTS, Signature: r.GetSignature()}
+	m.Id = int(r.GetId())
+
+	return m
+}
+
+func (r *FactsRequest) setSignature(signature []byte) {
+	r.Signature = signature
+}
+
+// NewFacts converts the facts of the websocket API
+func NewFacts(f *facts.Facts) (*Facts, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	pf := Facts{
+		Hostname:  f.Hostname,
+		Os:        f.Os,
+		OsVersion: f.OsVersion,
+		Platform:  f.Platform,
+		Arch:      f.Arch,
+		Kernel:    f.Kernel,
+		Cpus:      int32(f.Cpus),
+		CpuModel:  f.CpuModel,
+		Memory:    &Memory{Total: f.Memory.Total, Free: f.Memory.Free, Available: f.Memory.Available},
+		Uptime:    f.Uptime,
+		Load:      &Load{One: f.Load.One, Five: f.Load.Five, Fifteen: f.Load.Fifteen},
+		Addresses: f.Addresses,
+		Version:   f.Version,
+	}
+
+	for _, d := range f.Disks {
+		pf.Disks = append(pf.Disks, &Disk{Mount: d.Mount, Device: d.Device, FsType: d.FsType, Total: d.Total, Free: d.Free, Used: d.Used})
+	}
+
+	if len(f.Custom) > 0 {
+		// the custom facts are arbitrary JSON
+		jsonStr, err := json.Marshal(f.Custom)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pf.Custom = &_struct.Struct{}
+
+		if err := jsonpb.Unmarshal(bytes.NewReader(jsonStr), pf.Custom); err != nil {
+			return nil, err
+		}
+	}
+
+	return &pf, nil
+}
@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/cthayer/remote_control/pkg/facts"
+	"github.com/cthayer/remote_control/pkg/message"
+)
+
+func TestNewFacts(t *testing.T) {
+	f := facts.Facts{
+		Hostname: "host",
+		Cpus:     4,
+		Disks:    []facts.Disk{{Mount: "/", Total: 100}},
+		Custom:   map[string]interface{}{"role": "web", "ports": []interface{}{80.0, 443.0}},
+	}
+
+	pf, err := NewFacts(&f)
+
+	if err != nil {
+		t.Fatalf("NewFacts() error = %v", err)
+	}
+
+	if pf.Hostname != "host" || pf.Cpus != 4 || len(pf.Disks) != 1 || pf.Disks[0].Total != 100 {
+		t.Errorf("NewFacts() = %v, wanted the same facts", pf)
+	}
+
+	if got := pf.Custom.GetFields()["role"].GetStringValue(); got != "web" {
+		t.Errorf("custom fact role = %q, wanted web", got)
+	}
+
+	if got := pf.Custom.GetFields()["ports"].GetListValue().GetValues(); len(got) != 2 || got[1].GetNumberValue() != 443 {
+		t.Errorf("custom fact ports = %v, wanted [80 443]", got)
+	}
+
+	if pf, err := NewFacts(nil); pf != nil || err != nil {
+		t.Errorf("NewFacts(nil) = %v, %v, wanted nil", pf, err)
+	}
+}
+
+func TestRequest_Message(t *testing.T) {
+	exec := ExecRequest{Id: 1, Command: "uptime", Timeout: 5000, Env: map[string]string{"A": "b"}}
+	m := exec.Message()
+
+	if !m.IsCommand() || m.Id != 1 || m.Command != "uptime" || m.Options.Timeout != 5000 || m.Options.Env["A"] != "b" {
+		t.Errorf("ExecRequest.Message() = %+v, wanted the same command", m)
+	}
+
+	facts := FactsRequest{Id: 2}
+
+	if m := facts.Message(); m.Type != message.TYPE_FACTS || m.Id != 2 {
+		t.Errorf("FactsRequest.Message() = %+v, wanted a facts message", m)
+	}
+}